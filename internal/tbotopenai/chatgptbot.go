@@ -12,10 +12,26 @@ func NewChatGPTBot() *ChatGPTBot {
 	return &ChatGPTBot{}
 }
 
-func (c *ChatGPTBot) GenerateText(ctx context.Context, prompt string) ([]byte, error) {
-	return chatgptfree.GenerateText(ctx, prompt)
+func (c *ChatGPTBot) GenerateText(ctx context.Context, req *aiRequest) ([]byte, error) {
+	return chatgptfree.GenerateText(ctx, req.model, chatGPTHistory(req), req.prompt, req.imageURLs())
 }
 
-func (c *ChatGPTBot) GenerateImage(_ context.Context, _ string) ([]byte, string, error) {
-	return nil, "", nil
+func (c *ChatGPTBot) GenerateTextStream(ctx context.Context, req *aiRequest, onDelta func(delta string)) ([]byte, error) {
+	return chatgptfree.GenerateTextStream(ctx, req.model, chatGPTHistory(req), req.prompt, req.imageURLs(), onDelta)
+}
+
+// chatGPTHistory - системный промпт персоны и предыдущие сообщения диалога
+func chatGPTHistory(req *aiRequest) []chatgptfree.Message {
+	messages := make([]chatgptfree.Message, 0, len(req.history)+1)
+	if req.system != "" {
+		messages = append(messages, chatgptfree.Message{Role: chatRoleSystem, Content: req.system})
+	}
+	for idx := range req.history {
+		messages = append(messages, chatgptfree.Message{Role: req.history[idx].role, Content: req.history[idx].content})
+	}
+	return messages
+}
+
+func (c *ChatGPTBot) GenerateImage(_ context.Context, _ *aiRequest) ([]imageFile, error) {
+	return nil, nil
 }
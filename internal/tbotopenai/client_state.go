@@ -8,234 +8,158 @@ import (
 )
 
 var (
-	errChatGPTJobIsNotExist        = errors.New("ChatGPT job '%d' is not exist")
-	errDreamBoothJobIsNotExist     = errors.New("DreamBooth job '%d' is not exist")
-	errOpenAIJobIsNotExist         = errors.New("OpenAI job '%d' is not exist")
-	errFusionBrainJobIsNotExist    = errors.New("FusionBrain job '%d' is not exist")
-	errChatGPTJobIsAlreadyUsed     = errors.New("ChatGPT job '%d' is already used")
-	errOpenAIJobIsAlreadyUsed      = errors.New("OpenAI job '%d' is already used")
-	errDreamBoothJobIsAlreadyUsed  = errors.New("DreamBooth job '%d' is already used")
-	errFusionBrainJobIsAlreadyUsed = errors.New("FusionBrain job '%d' is already used")
-	chatIDIsNotExistErr            = errors.New("client with current chatID is not exist")
-	chatIDAlreadyExistErr          = errors.New("client with current chatID already exist")
+	errJobIsNotExist      = errors.New("job '%d' is not exist")
+	errJobIsAlreadyUsed   = errors.New("job '%d' is already used")
+	chatIDIsNotExistErr   = errors.New("client with current session is not exist")
+	chatIDAlreadyExistErr = errors.New("client with current session already exist")
 )
 
-func ErrorChatGPTJobIsNotExist(id int) error {
-	return fmt.Errorf(errChatGPTJobIsNotExist.Error(), id)
+func ErrorJobIsNotExist(id int) error {
+	return fmt.Errorf(errJobIsNotExist.Error(), id)
 }
 
-func ErrorDreamBoothJobIsNotExist(id int) error {
-	return fmt.Errorf(errDreamBoothJobIsNotExist.Error(), id)
+func ErrorJobIsAlreadyUsed(id int) error {
+	return fmt.Errorf(errJobIsAlreadyUsed.Error(), id)
 }
 
-func ErrorOpenAIJobIsNotExist(id int) error {
-	return fmt.Errorf(errOpenAIJobIsNotExist.Error(), id)
-}
-
-func ErrorFusionBrainJobIsNotExist(id int) error {
-	return fmt.Errorf(errFusionBrainJobIsNotExist.Error(), id)
-}
-
-func ErrorChatGPTJobIsAlreadyUsed(id int) error {
-	return fmt.Errorf(errChatGPTJobIsAlreadyUsed.Error(), id)
-}
-
-func ErrorOpenAIJobIsAlreadyUsed(id int) error {
-	return fmt.Errorf(errOpenAIJobIsAlreadyUsed.Error(), id)
-}
-
-func ErrorDreamBoothJobIsAlreadyUsed(id int) error {
-	return fmt.Errorf(errDreamBoothJobIsAlreadyUsed.Error(), id)
-}
-
-func ErrorFusionBrainJobIsAlreadyUsed(id int) error {
-	return fmt.Errorf(errFusionBrainJobIsAlreadyUsed.Error(), id)
+// clientJob - выполняющийся запрос клиента к провайдеру команды command
+type clientJob struct {
+	command string
+	cancel  context.CancelFunc
 }
 
 type clientState struct {
-	command        string
-	username       string
-	openAICancels  map[int]context.CancelFunc
-	chatGPTCancels map[int]context.CancelFunc
-	dbCancels      map[int]context.CancelFunc
-	fbCancels      map[int]context.CancelFunc
-	fbRows         []string
+	command      string
+	username     string
+	jobs         map[int]clientJob
+	fbRows       []string
+	imageFormat  string
+	document     *sessionDocument
+	history      []chatMessage
+	systemPrompt string
+	// models - модели, выбранные клиентом для команд
+	models map[string]string
 }
 
 func NewTClient(username string) *clientState {
 	return &clientState{
-		command:        commandStart,
-		username:       username,
-		openAICancels:  make(map[int]context.CancelFunc),
-		chatGPTCancels: make(map[int]context.CancelFunc),
-		dbCancels:      make(map[int]context.CancelFunc),
-		fbCancels:      make(map[int]context.CancelFunc),
-		fbRows:         make([]string, 0, countRequestFields),
+		command:     commandStart,
+		username:    username,
+		jobs:        make(map[int]clientJob),
+		fbRows:      make([]string, 0, countRequestFields),
+		imageFormat: imageFormatPhoto,
+		models:      make(map[string]string),
 	}
 }
 
-func (c *clientState) LenOpenAIJobs() int {
-	return len(c.openAICancels)
-}
-
-func (c *clientState) LenChatGPTJobs() int {
-	return len(c.chatGPTCancels)
-}
-
-func (c *clientState) LenDreamBoothJobs() int {
-	return len(c.dbCancels)
-}
-
-func (c *clientState) LenFusionBrainJobs() int {
-	return len(c.dbCancels)
-}
-
-func (c *clientState) SetUsername(username string) {
-	c.username = username
-}
-
-func (c *clientState) Username() string {
-	return c.username
+// LenJobs - количество запросов клиента к провайдеру команды
+func (c *clientState) LenJobs(command string) int {
+	var n int
+	for _, job := range c.jobs {
+		if job.command == command {
+			n++
+		}
+	}
+	return n
 }
 
-func (c *clientState) OpenAIJobs() []int {
-	jobIDs := make([]int, 0, len(c.openAICancels))
-	for id := range c.openAICancels {
-		jobIDs = append(jobIDs, id)
+func (c *clientState) Jobs(command string) []int {
+	jobIDs := make([]int, 0)
+	for id, job := range c.jobs {
+		if job.command == command {
+			jobIDs = append(jobIDs, id)
+		}
 	}
 	return jobIDs
 }
 
-func (c *clientState) ChatGPTJobs() []int {
-	jobIDs := make([]int, 0, len(c.chatGPTCancels))
-	for id := range c.chatGPTCancels {
-		jobIDs = append(jobIDs, id)
+func (c *clientState) SetCancelJob(command string, cancel context.CancelFunc, id int) error {
+	if _, ok := c.jobs[id]; ok {
+		return ErrorJobIsAlreadyUsed(id)
 	}
-	return jobIDs
+	c.jobs[id] = clientJob{command: command, cancel: cancel}
+	return nil
 }
 
-func (c *clientState) DreamBoothJobs() []int {
-	jobIDs := make([]int, 0, len(c.dbCancels))
-	for id := range c.dbCancels {
-		jobIDs = append(jobIDs, id)
+// CancelJob - отменяет запрос и возвращает его команду
+func (c *clientState) CancelJob(id int) (string, error) {
+	job, ok := c.jobs[id]
+	if !ok {
+		return "", ErrorJobIsNotExist(id)
 	}
-	return jobIDs
+	job.cancel()
+	delete(c.jobs, id)
+	return job.command, nil
 }
 
-func (c *clientState) FusionBrainJobs() []int {
-	jobIDs := make([]int, 0, len(c.fbCancels))
-	for id := range c.fbCancels {
-		jobIDs = append(jobIDs, id)
+func (c *clientState) CancelJobs() {
+	for _, job := range c.jobs {
+		job.cancel()
 	}
-	return jobIDs
+	c.jobs = make(map[int]clientJob)
 }
 
-func (c *clientState) SetCommand(command string) {
-	c.command = command
+func (c *clientState) SetUsername(username string) {
+	c.username = username
 }
 
-func (c *clientState) Command() string {
-	return c.command
+func (c *clientState) Username() string {
+	return c.username
 }
 
-func (c *clientState) SetCancelOpenAIJob(cancel context.CancelFunc, id int) error {
-	if _, ok := c.openAICancels[id]; ok {
-		return ErrorOpenAIJobIsAlreadyUsed(id)
-	}
-	c.openAICancels[id] = cancel
-	return nil
+func (c *clientState) SetImageFormat(format string) {
+	c.imageFormat = format
 }
 
-func (c *clientState) SetCancelChatGPTJob(cancel context.CancelFunc, id int) error {
-	if _, ok := c.chatGPTCancels[id]; ok {
-		return ErrorChatGPTJobIsAlreadyUsed(id)
-	}
-	c.chatGPTCancels[id] = cancel
-	return nil
+func (c *clientState) ImageFormat() string {
+	return c.imageFormat
 }
 
-func (c *clientState) SetCancelDreamBoothJob(cancel context.CancelFunc, id int) error {
-	if _, ok := c.dbCancels[id]; ok {
-		return ErrorDreamBoothJobIsAlreadyUsed(id)
-	}
-	c.dbCancels[id] = cancel
-	return nil
+func (c *clientState) SetDocument(doc *sessionDocument) {
+	c.document = doc
 }
 
-func (c *clientState) SetCancelFusionBrainJob(cancel context.CancelFunc, id int) error {
-	if _, ok := c.fbCancels[id]; ok {
-		return ErrorFusionBrainJobIsAlreadyUsed(id)
-	}
-	c.fbCancels[id] = cancel
-	return nil
+func (c *clientState) Document() *sessionDocument {
+	return c.document
 }
 
-func (c *clientState) CancelChatGPTJob(id int) error {
-	cancel, ok := c.chatGPTCancels[id]
-	if !ok {
-		return ErrorChatGPTJobIsNotExist(id)
-	}
-	cancel()
-	delete(c.chatGPTCancels, id)
-	return nil
+func (c *clientState) History() []chatMessage {
+	return append([]chatMessage(nil), c.history...)
 }
 
-func (c *clientState) CancelDreamBoothJob(id int) error {
-	cancel, ok := c.dbCancels[id]
-	if !ok {
-		return ErrorDreamBoothJobIsNotExist(id)
-	}
-	cancel()
-	delete(c.dbCancels, id)
-	return nil
+func (c *clientState) AppendHistory(prompt, answer string, maxTokens int) {
+	c.history = append(c.history,
+		chatMessage{role: chatRoleUser, content: prompt},
+		chatMessage{role: chatRoleAssistant, content: answer})
+	c.history = trimHistory(c.history, maxTokens)
 }
 
-func (c *clientState) CancelOpenAIJob(id int) error {
-	cancel, ok := c.openAICancels[id]
-	if !ok {
-		return ErrorOpenAIJobIsNotExist(id)
-	}
-	cancel()
-	delete(c.openAICancels, id)
-	return nil
+func (c *clientState) ResetHistory() {
+	c.history = nil
 }
 
-func (c *clientState) CancelFusionBrainJob(id int) error {
-	cancel, ok := c.fbCancels[id]
-	if !ok {
-		return ErrorFusionBrainJobIsNotExist(id)
-	}
-	cancel()
-	delete(c.fbCancels, id)
-	return nil
+func (c *clientState) SetSystemPrompt(systemPrompt string) {
+	c.systemPrompt = systemPrompt
 }
 
-func (c *clientState) CancelChatGPTJobs() {
-	for _, cancel := range c.chatGPTCancels {
-		cancel()
-	}
-	c.chatGPTCancels = make(map[int]context.CancelFunc)
+func (c *clientState) SystemPrompt() string {
+	return c.systemPrompt
 }
 
-func (c *clientState) CancelDreamBoothJobs() {
-	for _, cancel := range c.dbCancels {
-		cancel()
-	}
-	c.dbCancels = make(map[int]context.CancelFunc)
+func (c *clientState) SetModel(command, model string) {
+	c.models[command] = model
 }
 
-func (c *clientState) CancelOpenAIJobs() {
-	for _, cancel := range c.openAICancels {
-		cancel()
-	}
-	c.openAICancels = make(map[int]context.CancelFunc)
+func (c *clientState) Model(command string) string {
+	return c.models[command]
 }
 
-func (c *clientState) CancelFusionBrainJobs() {
-	for _, cancel := range c.fbCancels {
-		cancel()
-	}
-	c.fbCancels = make(map[int]context.CancelFunc)
+func (c *clientState) SetCommand(command string) {
+	c.command = command
+}
+
+func (c *clientState) Command() string {
+	return c.command
 }
 
 func (c *clientState) FusionBrainRequestRows() []string {
@@ -253,37 +177,48 @@ func (c *clientState) ResetFusionBrainRequestRows() {
 	c.fbRows = make([]string, 0, countRequestFields)
 }
 
-type clientStateByChatID struct {
-	value map[int64]*clientState
+// sessionKey - сессия клиента: в личном чате chatID совпадает с userID,
+// в группе у каждого участника своя сессия
+type sessionKey struct {
+	chatID int64
+	userID int64
+}
+
+func (k sessionKey) isGroup() bool {
+	return k.chatID != k.userID
+}
+
+type clientStateBySession struct {
+	value map[sessionKey]*clientState
 	mutex sync.RWMutex
 }
 
-func (c *clientStateByChatID) AddClient(chatID int64, username string) error {
+func (c *clientStateBySession) AddClient(key sessionKey, username string) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	_, ok := c.value[chatID]
+	_, ok := c.value[key]
 	if ok {
 		return chatIDAlreadyExistErr
 	}
-	c.value[chatID] = NewTClient(username)
+	c.value[key] = NewTClient(username)
 	return nil
 }
 
-func (c *clientStateByChatID) DeleteClient(chatID int64) error {
+func (c *clientStateBySession) DeleteClient(key sessionKey) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return chatIDIsNotExistErr
 	}
-	delete(c.value, chatID)
+	delete(c.value, key)
 	return nil
 }
 
-func (c *clientStateByChatID) UpdateClientCommand(chatID int64, command string) error {
+func (c *clientStateBySession) UpdateClientCommand(key sessionKey, command string) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return chatIDIsNotExistErr
 	}
@@ -291,213 +226,208 @@ func (c *clientStateByChatID) UpdateClientCommand(chatID int64, command string)
 	return nil
 }
 
-func (c *clientStateByChatID) ClientCommand(chatID int64) (string, error) {
+func (c *clientStateBySession) ClientCommand(key sessionKey) (string, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return "", chatIDIsNotExistErr
 	}
 	return tc.Command(), nil
 }
 
-func (c *clientStateByChatID) ClientChatGPTJobs(chatID int64) ([]int, error) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+func (c *clientStateBySession) UpdateClientImageFormat(key sessionKey, format string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return nil, chatIDIsNotExistErr
+		return chatIDIsNotExistErr
 	}
-	return tc.ChatGPTJobs(), nil
+	tc.SetImageFormat(format)
+	return nil
 }
 
-func (c *clientStateByChatID) ClientDreamBoothJobs(chatID int64) ([]int, error) {
+func (c *clientStateBySession) ClientImageFormat(key sessionKey) (string, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return nil, chatIDIsNotExistErr
+		return "", chatIDIsNotExistErr
 	}
-	return tc.DreamBoothJobs(), nil
+	return tc.ImageFormat(), nil
 }
 
-func (c *clientStateByChatID) ClientOpenAIJobs(chatID int64) ([]int, error) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+func (c *clientStateBySession) UpdateClientSystemPrompt(key sessionKey, systemPrompt string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return nil, chatIDIsNotExistErr
+		return chatIDIsNotExistErr
 	}
-	return tc.OpenAIJobs(), nil
+	tc.SetSystemPrompt(systemPrompt)
+	return nil
 }
 
-func (c *clientStateByChatID) ClientFusionBrainJobs(chatID int64) ([]int, error) {
+func (c *clientStateBySession) ClientSystemPrompt(key sessionKey) (string, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return nil, chatIDIsNotExistErr
+		return "", chatIDIsNotExistErr
 	}
-	return tc.FusionBrainJobs(), nil
+	return tc.SystemPrompt(), nil
 }
 
-func (c *clientStateByChatID) ClientLenChatGPTJobs(chatID int64) (int, error) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+func (c *clientStateBySession) UpdateClientModel(key sessionKey, command, model string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return -1, chatIDIsNotExistErr
+		return chatIDIsNotExistErr
 	}
-	return tc.LenChatGPTJobs(), nil
+	tc.SetModel(command, model)
+	return nil
 }
 
-func (c *clientStateByChatID) ClientLenDreamBoothJobs(chatID int64) (int, error) {
+func (c *clientStateBySession) ClientModel(key sessionKey, command string) (string, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return -1, chatIDIsNotExistErr
+		return "", chatIDIsNotExistErr
 	}
-	return tc.LenDreamBoothJobs(), nil
+	return tc.Model(command), nil
 }
 
-func (c *clientStateByChatID) ClientLenOpenAIJobs(chatID int64) (int, error) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+func (c *clientStateBySession) SetClientDocument(key sessionKey, doc *sessionDocument) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return -1, chatIDIsNotExistErr
+		return chatIDIsNotExistErr
 	}
-	return tc.LenOpenAIJobs(), nil
+	tc.SetDocument(doc)
+	return nil
 }
 
-func (c *clientStateByChatID) ClientLenFusionBrainJobs(chatID int64) (int, error) {
+func (c *clientStateBySession) ClientDocument(key sessionKey) (*sessionDocument, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return -1, chatIDIsNotExistErr
-	}
-	return tc.LenFusionBrainJobs(), nil
-}
-
-func (c *clientStateByChatID) ClientAddChatGPTJob(cancel context.CancelFunc, jobID int, chatID int64) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	tc, ok := c.value[chatID]
-	if !ok || tc == nil {
-		return chatIDIsNotExistErr
+		return nil, chatIDIsNotExistErr
 	}
-	return tc.SetCancelChatGPTJob(cancel, jobID)
+	return tc.Document(), nil
 }
 
-func (c *clientStateByChatID) ClientAddDreamBoothJob(cancel context.CancelFunc, jobID int, chatID int64) error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	tc, ok := c.value[chatID]
+func (c *clientStateBySession) ClientHistory(key sessionKey) ([]chatMessage, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return chatIDIsNotExistErr
+		return nil, chatIDIsNotExistErr
 	}
-	return tc.SetCancelDreamBoothJob(cancel, jobID)
+	return tc.History(), nil
 }
 
-func (c *clientStateByChatID) ClientAddOpenAIJob(cancel context.CancelFunc, jobID int, chatID int64) error {
+func (c *clientStateBySession) AppendClientHistory(key sessionKey, prompt, answer string, maxTokens int) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return chatIDIsNotExistErr
 	}
-	return tc.SetCancelOpenAIJob(cancel, jobID)
+	tc.AppendHistory(prompt, answer, maxTokens)
+	return nil
 }
 
-func (c *clientStateByChatID) ClientAddFusionBrainJob(cancel context.CancelFunc, jobID int, chatID int64) error {
+func (c *clientStateBySession) ResetClientHistory(key sessionKey) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return chatIDIsNotExistErr
 	}
-	return tc.SetCancelFusionBrainJob(cancel, jobID)
+	tc.ResetHistory()
+	return nil
 }
 
-func (c *clientStateByChatID) ClientCancelChatGPTJob(jobID int, chatID int64) error {
+func (c *clientStateBySession) ClientJobs(key sessionKey, command string) ([]int, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return chatIDIsNotExistErr
+		return nil, chatIDIsNotExistErr
 	}
-	return tc.CancelChatGPTJob(jobID)
+	return tc.Jobs(command), nil
 }
 
-func (c *clientStateByChatID) ClientCancelDreamBoothJob(jobID int, chatID int64) error {
+func (c *clientStateBySession) ClientLenJobs(key sessionKey, command string) (int, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return chatIDIsNotExistErr
+		return -1, chatIDIsNotExistErr
 	}
-	return tc.CancelDreamBoothJob(jobID)
+	return tc.LenJobs(command), nil
 }
 
-func (c *clientStateByChatID) ClientCancelOpenAIJob(jobID int, chatID int64) error {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+func (c *clientStateBySession) ClientAddJob(command string, cancel context.CancelFunc, jobID int, key sessionKey) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return chatIDIsNotExistErr
 	}
-	return tc.CancelOpenAIJob(jobID)
+	return tc.SetCancelJob(command, cancel, jobID)
 }
 
-func (c *clientStateByChatID) ClientCancelFusionBrainJob(jobID int, chatID int64) error {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+// ClientCancelJob - отменяет запрос клиента и возвращает его команду
+func (c *clientStateBySession) ClientCancelJob(jobID int, key sessionKey) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
-		return chatIDIsNotExistErr
+		return "", chatIDIsNotExistErr
 	}
-	return tc.CancelFusionBrainJob(jobID)
+	return tc.CancelJob(jobID)
 }
 
-func (c *clientStateByChatID) ClientCancelJobs(chatID int64) error {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+func (c *clientStateBySession) ClientCancelJobs(key sessionKey) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return chatIDIsNotExistErr
 	}
-	tc.CancelChatGPTJobs()
-	tc.CancelDreamBoothJobs()
-	tc.CancelFusionBrainJobs()
+	tc.CancelJobs()
 	return nil
 }
 
-func (c *clientStateByChatID) ClientUsername(chatID int64) (string, error) {
+func (c *clientStateBySession) ClientUsername(key sessionKey) (string, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return "", chatIDIsNotExistErr
 	}
 	return tc.Username(), nil
 }
 
-func (c *clientStateByChatID) ClientFusionBrainRequestRows(chatID int64) ([]string, error) {
+func (c *clientStateBySession) ClientFusionBrainRequestRows(key sessionKey) ([]string, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return nil, chatIDIsNotExistErr
 	}
 	return tc.FusionBrainRequestRows(), nil
 }
 
-func (c *clientStateByChatID) AppendToClientFusionBrainRequestRows(row string, chatID int64) error {
+func (c *clientStateBySession) AppendToClientFusionBrainRequestRows(row string, key sessionKey) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return chatIDIsNotExistErr
 	}
@@ -505,10 +435,10 @@ func (c *clientStateByChatID) AppendToClientFusionBrainRequestRows(row string, c
 	return nil
 }
 
-func (c *clientStateByChatID) ResetClientFusionBrainRequestRows(chatID int64) error {
+func (c *clientStateBySession) ResetClientFusionBrainRequestRows(key sessionKey) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	tc, ok := c.value[chatID]
+	tc, ok := c.value[key]
 	if !ok || tc == nil {
 		return chatIDIsNotExistErr
 	}
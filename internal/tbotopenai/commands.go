@@ -0,0 +1,98 @@
+package tbotopenai
+
+import "strings"
+
+// commandInfo - команда бота; описание используется в /help, меню команд Telegram и кнопках,
+// если оно не задано, берется из каталога ответов на языке пользователя
+type commandInfo struct {
+	name        string
+	icon        string
+	description string
+	// descriptionID - описание в каталоге ответов, если оно отличается от description_<команда>
+	descriptionID string
+}
+
+// commandRegistry - служебные команды в порядке вывода в /help и меню,
+// команды провайдеров вставляются после commandModel
+var commandRegistry = []commandInfo{
+	{name: commandStart, icon: "✅"},
+	{name: commandStop, icon: "⛔"},
+	{name: commandHelp, icon: "🔧"},
+	{name: commandReset, icon: "🧹"},
+	{name: commandPersona, icon: "🎭"},
+	{name: commandModel, icon: "🧠"},
+	{name: commandCancelJob, icon: "📛"},
+	{name: commandListJobs, icon: "📋"},
+	{name: commandImageFormat, icon: "🖼"},
+	{name: commandGroupCommands, icon: "👥"},
+	{name: commandLanguage, icon: "🌐"},
+	{name: commandTopicCommand, icon: "🧵"},
+	{name: commandStats, icon: "📈"},
+	{name: commandLogs, icon: "💻"},
+	{name: commandBan, icon: "👎"},
+	{name: commandUnban, icon: "👍"},
+	{name: commandBlacklist, icon: "💩"},
+}
+
+func isServiceCommand(command string) bool {
+	for idx := range commandRegistry {
+		if strings.EqualFold(commandRegistry[idx].name, command) {
+			return true
+		}
+	}
+	return strings.EqualFold(commandDreamBoothExample, command)
+}
+
+// newCommands - служебные команды и команды провайдеров; описание провайдера из конфигурации
+// заменяет описание из каталога ответов
+func newCommands(providers *providerRegistry) []commandInfo {
+	commands := make([]commandInfo, 0, len(commandRegistry)+len(providers.list)+1)
+	for _, command := range commandRegistry {
+		commands = append(commands, command)
+		if command.name != commandModel {
+			continue
+		}
+		for _, p := range providers.list {
+			commands = append(commands, commandInfo{
+				name:          p.cfg.Command,
+				icon:          p.icon(),
+				description:   p.cfg.Description,
+				descriptionID: p.descriptionID(),
+			})
+		}
+		if providers.hasType(providerTypeDreamBooth) {
+			commands = append(commands, commandInfo{name: commandDreamBoothExample, icon: "📄"})
+		}
+	}
+	return commands
+}
+
+func (t *TBotOpenAI) commandNames() []string {
+	names := make([]string, 0, len(t.commands))
+	for idx := range t.commands {
+		names = append(names, t.commands[idx].name)
+	}
+	return names
+}
+
+// canonicalCommand - меню Telegram допускает только команды в нижнем регистре,
+// поэтому команда ищется среди команд бота без учета регистра
+func (t *TBotOpenAI) canonicalCommand(command string) string {
+	for idx := range t.commands {
+		if strings.EqualFold(t.commands[idx].name, command) {
+			return t.commands[idx].name
+		}
+	}
+	return command
+}
+
+// allowedCommands - команды, доступные пользователю по ролям и настройкам группы
+func (t *TBotOpenAI) allowedCommands(username string, key sessionKey) []commandInfo {
+	commands := make([]commandInfo, 0, len(t.commands))
+	for _, command := range t.commands {
+		if t.checkPermissions(command.name, username) && t.isGroupCommandEnabled(key, command.name) {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
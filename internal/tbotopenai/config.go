@@ -9,29 +9,100 @@ import (
 )
 
 type Config struct {
-	Telegram                TelegramSettings    `yaml:"telegram"`
-	ChatGPT                 ChatGPTSettings     `yaml:"chatgpt"`
-	OpenAI                  OpenAISettings      `yaml:"openai"`
-	DreamBooth              DreamBoothSettings  `yaml:"dreambooth"`
-	FusionBrain             FusionBrainSettings `yaml:"fusionbrain"`
-	Roles                   RolesSettings       `yaml:"roles"`
-	Permissions             PermissionSettings  `yaml:"permissions"`
-	Stats                   StatsSettings       `yaml:"stats"`
-	Logger                  zap.Config          `yaml:"log"`
-	LenMessageChan          int                 `yaml:"len_message_chan"`
-	LenQueueTaskChan        int                 `yaml:"len_queue_task_chan"`
-	QueueMessageWorkers     int                 `yaml:"queue_message_workers"`
-	MaxClientOpenAIJobs     int                 `yaml:"max_client_openai_jobs"`
-	MaxClientChatGPTJobs    int                 `yaml:"max_client_chatgpt_jobs"`
-	MaxClientDreamBoothJobs int                 `yaml:"max_client_dreambooth_jobs"`
-	MaxLogRows              int                 `yaml:"max_log_rows"`
-	PathBlackList           string              `yaml:"path_blacklist"`
+	Messenger           string               `yaml:"messenger"`
+	Telegram            TelegramSettings     `yaml:"telegram"`
+	Console             ConsoleSettings      `yaml:"console"`
+	ChatGPT             ChatGPTSettings      `yaml:"chatgpt"`
+	OpenAI              OpenAISettings       `yaml:"openai"`
+	DreamBooth          DreamBoothSettings   `yaml:"dreambooth"`
+	FusionBrain         FusionBrainSettings  `yaml:"fusionbrain"`
+	Roles               RolesSettings        `yaml:"roles"`
+	Permissions         PermissionSettings   `yaml:"permissions"`
+	Stats               StatsSettings        `yaml:"stats"`
+	Stream              StreamSettings       `yaml:"stream"`
+	SpeechToText        SpeechToTextSettings `yaml:"speech_to_text"`
+	Groups              GroupSettings        `yaml:"groups"`
+	Inline              InlineSettings       `yaml:"inline"`
+	Progress            ProgressSettings     `yaml:"progress"`
+	Documents           DocumentSettings     `yaml:"documents"`
+	Locales             LocaleSettings       `yaml:"locales"`
+	Edits               EditSettings         `yaml:"edits"`
+	History             HistorySettings      `yaml:"history"`
+	Personas            []PersonaSettings    `yaml:"personas"`
+	Models              ModelSettings        `yaml:"models"`
+	Providers           []ProviderSettings   `yaml:"providers"`
+	Logger              zap.Config           `yaml:"log"`
+	LenMessageChan      int                  `yaml:"len_message_chan"`
+	LenQueueTaskChan    int                  `yaml:"len_queue_task_chan"`
+	QueueMessageWorkers int                  `yaml:"queue_message_workers"`
+	// MaxClient*Jobs, секции chatgpt, openai, dreambooth и fusionbrain используются, если не задана секция providers
+	MaxClientOpenAIJobs     int    `yaml:"max_client_openai_jobs"`
+	MaxClientChatGPTJobs    int    `yaml:"max_client_chatgpt_jobs"`
+	MaxClientDreamBoothJobs int    `yaml:"max_client_dreambooth_jobs"`
+	MaxLogRows              int    `yaml:"max_log_rows"`
+	MaxLenTextReply         int    `yaml:"max_len_text_reply"`
+	PathBlackList           string `yaml:"path_blacklist"`
+	// PathMenuChats - файл с известными чатами, которым устанавливается меню команд по роли пользователя
+	PathMenuChats string `yaml:"path_menu_chats"`
 }
 
 type TelegramSettings struct {
-	Token   string `yaml:"token"`
-	Debug   bool   `yaml:"debug"`
-	Timeout int    `yaml:"timeout"`
+	Token   string          `yaml:"token"`
+	Debug   bool            `yaml:"debug"`
+	Timeout int             `yaml:"timeout"`
+	Mode    string          `yaml:"mode"`
+	Webhook WebhookSettings `yaml:"webhook"`
+	// InlineCacheChatID - чат, куда загружаются изображения для ответов на inline-запросы
+	InlineCacheChatID int64 `yaml:"inline_cache_chat_id"`
+	// PathUpdateOffset - файл с номером последнего обработанного обновления
+	PathUpdateOffset string               `yaml:"path_update_offset"`
+	StaleUpdates     StaleUpdatesSettings `yaml:"stale_updates"`
+	// SendQueue - очередь исходящих сообщений с ограничением частоты отправки
+	SendQueue SendQueueSettings `yaml:"send_queue"`
+}
+
+// StaleUpdatesSettings - сообщения старше max_age, отправленные до запуска бота:
+// process - обработать, drop - пропустить, notify - ответить, что запрос нужно повторить
+type StaleUpdatesSettings struct {
+	Policy string        `yaml:"policy"`
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// SendQueueSettings - лимиты в сообщениях в секунду: общий для бота, для личного чата и для группы;
+// нулевые значения заменяются ограничениями Telegram по умолчанию
+type SendQueueSettings struct {
+	Workers       int           `yaml:"workers"`
+	QueueLen      int           `yaml:"queue_len"`
+	GlobalRate    float64       `yaml:"global_rate"`
+	GlobalBurst   float64       `yaml:"global_burst"`
+	ChatRate      float64       `yaml:"chat_rate"`
+	ChatBurst     float64       `yaml:"chat_burst"`
+	GroupRate     float64       `yaml:"group_rate"`
+	GroupBurst    float64       `yaml:"group_burst"`
+	MaxRetries    int           `yaml:"max_retries"`
+	RetryInterval time.Duration `yaml:"retry_interval"`
+}
+
+// ConsoleSettings - пользователь, от имени которого отправляются строки stdin, язык его клиента
+// и каталог для файлов ответов
+type ConsoleSettings struct {
+	Username     string `yaml:"username"`
+	LanguageCode string `yaml:"language_code"`
+	FilesDir     string `yaml:"files_dir"`
+}
+
+type WebhookSettings struct {
+	URL                string   `yaml:"url"`
+	Listen             string   `yaml:"listen"`
+	Path               string   `yaml:"path"`
+	SecretToken        string   `yaml:"secret_token"`
+	CertFile           string   `yaml:"cert_file"`
+	KeyFile            string   `yaml:"key_file"`
+	UploadCertificate  bool     `yaml:"upload_certificate"`
+	MaxConnections     int      `yaml:"max_connections"`
+	DropPendingUpdates bool     `yaml:"drop_pending_updates"`
+	ProxyHeader        string   `yaml:"proxy_header"`
+	TrustedProxies     []string `yaml:"trusted_proxies"`
 }
 
 type OpenAISettings struct {
@@ -39,6 +110,31 @@ type OpenAISettings struct {
 	RetryCount    int           `yaml:"retry_count"`
 	RetryInterval time.Duration `yaml:"retry_interval"`
 	Timeout       time.Duration `yaml:"timeout"`
+	ImagesCount   int           `yaml:"images_count"`
+	// ImageSize - размер изображений, по умолчанию 1024x1024
+	ImageSize string `yaml:"image_size"`
+	// BaseURL, Headers, Model - адрес OpenAI-совместимого сервера, заголовки его запросов
+	// и модель, если клиент не выбрал свою; для openai_compatible base_url и model обязательны
+	BaseURL string            `yaml:"base_url"`
+	Headers map[string]string `yaml:"headers"`
+	Model   string            `yaml:"model"`
+}
+
+// ProviderSettings - провайдер AI и команда бота, через которую он доступен: type - chatgptfree, openai,
+// openai_compatible, dreambooth или fusionbrain, mode - text или image, roles - роли, которым доступна команда
+// (пустой список - по спискам permissions), max_jobs - лимит запросов клиента (0 - без ограничения)
+type ProviderSettings struct {
+	Type        string              `yaml:"type"`
+	Command     string              `yaml:"command"`
+	Mode        string              `yaml:"mode"`
+	Label       string              `yaml:"label"`
+	Description string              `yaml:"description"`
+	Roles       []string            `yaml:"roles"`
+	Timeout     time.Duration       `yaml:"timeout"`
+	MaxJobs     int                 `yaml:"max_jobs"`
+	OpenAI      OpenAISettings      `yaml:"openai"`
+	DreamBooth  DreamBoothSettings  `yaml:"dreambooth"`
+	FusionBrain FusionBrainSettings `yaml:"fusionbrain"`
 }
 
 type ChatGPTSettings struct {
@@ -68,6 +164,89 @@ type PermissionSettings struct {
 	UserCommands  []string `yaml:"user"`
 }
 
+// ModelSettings - модели команд, доступные ролям: первая модель команды используется по умолчанию;
+// команда и модель используются в данных кнопки: "model:<команда> <модель>" должно помещаться в 64 байта
+type ModelSettings struct {
+	AdminModels map[string][]string `yaml:"admin"`
+	UserModels  map[string][]string `yaml:"user"`
+}
+
+type SpeechToTextSettings struct {
+	Enabled  bool          `yaml:"enabled"`
+	Token    string        `yaml:"token"`
+	BaseURL  string        `yaml:"base_url"`
+	Model    string        `yaml:"model"`
+	Language string        `yaml:"language"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// GroupSettings - команды, включенные в группе по умолчанию (пустой список - все),
+// и файл с командами, выбранными администраторами групп
+type GroupSettings struct {
+	DefaultCommands []string `yaml:"default_commands"`
+	PathCommands    string   `yaml:"path_commands"`
+	// PathTopicCommands - файл с темами форума, привязанными администраторами к командам
+	PathTopicCommands string `yaml:"path_topic_commands"`
+}
+
+// DocumentSettings - размер частей документа, объем документа в запросе к модели
+// и количество частей, по которым составляется краткое содержание длинного документа
+type DocumentSettings struct {
+	MaxFileSize     int `yaml:"max_file_size"`
+	ChunkSize       int `yaml:"chunk_size"`
+	MaxContext      int `yaml:"max_context"`
+	MaxSummaryParts int `yaml:"max_summary_parts"`
+}
+
+// LocaleSettings - язык ответов по умолчанию, каталог с файлами <язык>.yaml, которые дополняют
+// или заменяют встроенные каталоги ответов, и файл с языками, выбранными пользователями командой /language
+type LocaleSettings struct {
+	Default           string `yaml:"default"`
+	Path              string `yaml:"path"`
+	PathUserLanguages string `yaml:"path_user_languages"`
+}
+
+// HistorySettings - история диалога сессии для текстовых моделей, max_tokens - ее бюджет в токенах
+type HistorySettings struct {
+	Enabled   bool `yaml:"enabled"`
+	MaxTokens int  `yaml:"max_tokens"`
+}
+
+// PersonaSettings - пресет системного промпта, который пользователь выбирает командой /persona;
+// имя используется в данных кнопки: "persona:<имя>" должно помещаться в 64 байта, иначе конфигурация не загружается
+type PersonaSettings struct {
+	Name   string `yaml:"name"`
+	Prompt string `yaml:"prompt"`
+}
+
+// EditSettings - отредактированный клиентом запрос: rerun - запрос в очереди или выполняющийся отменяется
+// и выполняется заново с новым текстом, rerun_button - к уже выполненному предлагается кнопка повтора
+type EditSettings struct {
+	Rerun       bool `yaml:"rerun"`
+	RerunButton bool `yaml:"rerun_button"`
+}
+
+// ProgressSettings - сообщение о статусе запроса в очереди, обновляемое с интервалом interval
+type ProgressSettings struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// InlineSettings - text_command и image_command - команды провайдеров для текстовых
+// и графических ответов на inline-запросы, по умолчанию chatGPT и openAIImage
+type InlineSettings struct {
+	Enabled      bool          `yaml:"enabled"`
+	Debounce     time.Duration `yaml:"debounce"`
+	Timeout      time.Duration `yaml:"timeout"`
+	TextCommand  string        `yaml:"text_command"`
+	ImageCommand string        `yaml:"image_command"`
+}
+
+type StreamSettings struct {
+	Enabled      bool          `yaml:"enabled"`
+	EditInterval time.Duration `yaml:"edit_interval"`
+}
+
 type StatsSettings struct {
 	Interval time.Duration `yaml:"interval"`
 	Filepath string        `yaml:"filepath"`
@@ -83,5 +262,11 @@ func NewConfig(filename string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = checkPersonas(cfg.Personas); err != nil {
+		return nil, err
+	}
+	if err = checkModels(&cfg.Models); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
@@ -0,0 +1,341 @@
+package tbotopenai
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	messengerTelegram = "telegram"
+	messengerConsole  = "console"
+)
+
+const (
+	defaultConsoleUsername = "console"
+	defaultConsoleFilesDir = "./console_files"
+	// consoleChatID - у консоли один личный чат, поэтому chatID совпадает с userID
+	consoleChatID = 1
+)
+
+// Ввод консоли: "/команда" и текст - как в Telegram, "#N" - нажатие кнопки N последней клавиатуры,
+// "!photo <путь> [подпись]", "!document <путь> [подпись]" и "!voice <путь>" - отправка локального файла,
+// "^N <текст>" - ответ на сообщение бота #N, "~N <текст>" - редактирование своего сообщения #N
+const (
+	consoleButtonPrefix = "#"
+	consolePhotoPrefix  = "!photo "
+	consoleVoicePrefix  = "!voice "
+	consoleDocPrefix    = "!document "
+	consoleReplyPrefix  = "^"
+	consoleEditPrefix   = "~"
+)
+
+var (
+	errUnsupportedMessenger = errors.New("unsupported messenger")
+	errConsoleInvalidInput  = errors.New("console invalid input")
+)
+
+// Console - Messenger для локальной разработки: читает сообщения из stdin, печатает ответы в stdout
+// и сохраняет файлы ответов в каталог
+type Console struct {
+	log       *zap.Logger
+	l         localizer
+	in        io.Reader
+	out       io.Writer
+	username  string
+	language  string
+	filesDir  string
+	msgChan   chan<- *message
+	lineChan  chan string
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	mutex     sync.Mutex
+	messageID int
+	buttons   []keyboardButton
+	replies   sentReplies
+}
+
+// NewConsole - сообщения консоли печатаются на языке клиента language_code
+func NewConsole(cfg *ConsoleSettings, log *zap.Logger, locales *locales, msgChan chan<- *message) (*Console, error) {
+	c := &Console{
+		log:      log,
+		l:        localizer{locales: locales, lang: locales.match(cfg.LanguageCode)},
+		in:       os.Stdin,
+		out:      os.Stdout,
+		username: cfg.Username,
+		language: cfg.LanguageCode,
+		filesDir: cfg.FilesDir,
+		msgChan:  msgChan,
+		lineChan: make(chan string),
+		stopChan: make(chan struct{}),
+	}
+	if c.username == "" {
+		c.username = defaultConsoleUsername
+	}
+	if c.filesDir == "" {
+		c.filesDir = defaultConsoleFilesDir
+	}
+	if err := os.MkdirAll(c.filesDir, 0755); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newMessenger - Messenger, выбранный в конфигурации
+func newMessenger(cfg *Config, log *zap.Logger, locales *locales, msgChan chan<- *message) (Messenger, error) {
+	switch cfg.Messenger {
+	case "", messengerTelegram:
+		return NewTelegram(&cfg.Telegram, log, msgChan)
+	case messengerConsole:
+		return NewConsole(&cfg.Console, log, locales, msgChan)
+	}
+	return nil, errUnsupportedMessenger
+}
+
+func (c *Console) Run() {
+	go c.scanLines()
+	c.wg.Add(1)
+	go c.initReadingMessagesWorker()
+	c.print(c.l.text(respConsoleStarted, "username", c.username))
+	c.wg.Wait()
+}
+
+func (c *Console) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+// scanLines - чтение stdin блокирующее, поэтому выполняется отдельно от обработчика сообщений
+func (c *Console) scanLines() {
+	scanner := bufio.NewScanner(c.in)
+	for scanner.Scan() {
+		select {
+		case c.lineChan <- scanner.Text():
+		case <-c.stopChan:
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		c.log.Error("Reading console input err:", zap.Error(err))
+	}
+}
+
+func (c *Console) initReadingMessagesWorker() {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case line := <-c.lineChan:
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			msg, err := c.parseLine(line)
+			if err != nil {
+				c.print("❌ " + err.Error())
+				continue
+			}
+			select {
+			case c.msgChan <- msg:
+			case <-c.stopChan:
+				return
+			}
+		}
+	}
+}
+
+func (c *Console) parseLine(line string) (*message, error) {
+	c.mutex.Lock()
+	c.messageID++
+	msg := &message{
+		chatID:       consoleChatID,
+		userID:       consoleChatID,
+		messageID:    c.messageID,
+		username:     c.username,
+		languageCode: c.language,
+	}
+	buttons := c.buttons
+	c.mutex.Unlock()
+	switch {
+	case strings.HasPrefix(line, consoleButtonPrefix):
+		idx, err := strconv.Atoi(strings.TrimPrefix(line, consoleButtonPrefix))
+		if err != nil || idx < 1 || idx > len(buttons) {
+			return nil, errConsoleInvalidInput
+		}
+		msg.command, msg.text, _ = strings.Cut(buttons[idx-1].data, callbackDataSeparator)
+		msg.callbackID = line
+	case strings.HasPrefix(line, consolePhotoPrefix):
+		path, caption, _ := strings.Cut(strings.TrimPrefix(line, consolePhotoPrefix), " ")
+		msg.photo = &attachment{fileID: path, fileName: filepath.Base(path)}
+		msg.text = strings.TrimSpace(caption)
+	case strings.HasPrefix(line, consoleReplyPrefix):
+		strID, text, _ := strings.Cut(strings.TrimPrefix(line, consoleReplyPrefix), " ")
+		id, err := strconv.Atoi(strID)
+		if err != nil {
+			return nil, errConsoleInvalidInput
+		}
+		msg.text = strings.TrimSpace(text)
+		msg.replyTo = &replyRef{messageID: id}
+		if sent, ok := c.replies.load(consoleChatID, id); ok {
+			msg.replyTo.requestID, msg.replyTo.text = sent.requestID, sent.text
+		}
+	case strings.HasPrefix(line, consoleEditPrefix):
+		strID, text, _ := strings.Cut(strings.TrimPrefix(line, consoleEditPrefix), " ")
+		id, err := strconv.Atoi(strID)
+		if err != nil {
+			return nil, errConsoleInvalidInput
+		}
+		msg.messageID, msg.text, msg.isEdited = id, strings.TrimSpace(text), true
+	case strings.HasPrefix(line, consoleDocPrefix):
+		path, caption, _ := strings.Cut(strings.TrimPrefix(line, consoleDocPrefix), " ")
+		msg.document = &attachment{fileID: path, fileName: filepath.Base(path)}
+		if info, err := os.Stat(path); err == nil {
+			msg.document.fileSize = int(info.Size())
+		}
+		msg.text = strings.TrimSpace(caption)
+	case strings.HasPrefix(line, consoleVoicePrefix):
+		path := strings.TrimSpace(strings.TrimPrefix(line, consoleVoicePrefix))
+		msg.voice = &attachment{fileID: path, fileName: filepath.Base(path)}
+	case strings.HasPrefix(line, "/"):
+		command, _, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+		msg.command = command
+		msg.text = line
+	default:
+		msg.text = line
+	}
+	return msg, nil
+}
+
+func (c *Console) nextMessageID() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.messageID++
+	return c.messageID
+}
+
+func (c *Console) print(text string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err := fmt.Fprintln(c.out, text); err != nil {
+		c.log.Error("Writing console output err:", zap.Error(err))
+	}
+}
+
+func (c *Console) printReply(messageID int, text string) int {
+	id := c.nextMessageID()
+	c.replies.store(consoleChatID, id, messageID, text)
+	c.print(fmt.Sprintf("[#%d → #%d]\n%s\n", id, messageID, text))
+	return id
+}
+
+func (c *Console) writeFile(body []byte, fileName string) (string, error) {
+	path := filepath.Join(c.filesDir, strconv.Itoa(c.nextMessageID())+"_"+filepath.Base(fileName))
+	return path, os.WriteFile(path, body, 0644)
+}
+
+func (c *Console) ReplyText(messageID int, _ int64, body string) error {
+	c.printReply(messageID, body)
+	return nil
+}
+
+func (c *Console) ReplyFile(messageID int, _ int64, body []byte, fileName string) error {
+	path, err := c.writeFile(body, fileName)
+	if err != nil {
+		return err
+	}
+	c.printReply(messageID, "📄 "+path)
+	return nil
+}
+
+func (c *Console) ReplyKeyboard(messageID int, _ int64, body string, kb keyboard) error {
+	buttons := make([]keyboardButton, 0)
+	var b strings.Builder
+	b.WriteString(body)
+	for _, row := range kb {
+		b.WriteString("\n")
+		for _, button := range row {
+			buttons = append(buttons, button)
+			b.WriteString(fmt.Sprintf(" [%s%d %s]", consoleButtonPrefix, len(buttons), button.text))
+		}
+	}
+	c.mutex.Lock()
+	c.buttons = buttons
+	c.mutex.Unlock()
+	c.printReply(messageID, b.String())
+	return nil
+}
+
+func (c *Console) ReplyEditableText(messageID int, _ int64, body string) (int, error) {
+	return c.printReply(messageID, body), nil
+}
+
+func (c *Console) EditText(messageID int, _ int64, body string) error {
+	c.print(c.l.text(respConsoleEdited, "message_id", messageID) + "\n" + body + "\n")
+	return nil
+}
+
+func (c *Console) ReplyHTML(messageID int, chatID int64, body string) error {
+	return c.ReplyText(messageID, chatID, body)
+}
+
+func (c *Console) EditHTML(messageID int, chatID int64, body string) error {
+	return c.EditText(messageID, chatID, body)
+}
+
+func (c *Console) ReplyPhoto(messageID int, chatID int64, body []byte, fileName, caption string) error {
+	return c.ReplyMediaGroup(messageID, chatID, []imageFile{{body: body, fileName: fileName}}, caption)
+}
+
+func (c *Console) ReplyMediaGroup(messageID int, _ int64, files []imageFile, caption string) error {
+	paths := make([]string, 0, len(files))
+	for idx := range files {
+		path, err := c.writeFile(files[idx].body, files[idx].fileName)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, "🖼 "+path)
+	}
+	c.printReply(messageID, strings.Join(paths, "\n")+"\n"+caption)
+	return nil
+}
+
+// DownloadFile - в консоли fileID - путь к локальному файлу
+func (c *Console) DownloadFile(fileID string) ([]byte, error) {
+	return os.ReadFile(fileID)
+}
+
+func (c *Console) IsChatAdmin(_, _ int64) (bool, error) {
+	return true, nil
+}
+
+func (c *Console) AnswerInlineQuery(queryID string, results []inlineResult, switchPMText string) error {
+	if switchPMText != "" {
+		c.print(fmt.Sprintf("[inline %s] [%s]\n", queryID, switchPMText))
+	}
+	for idx := range results {
+		c.print(fmt.Sprintf("[inline %s] %s\n%s\n", queryID, results[idx].title, results[idx].text))
+	}
+	return nil
+}
+
+func (c *Console) SetCommands(_ sessionKey, _ string, _ []commandInfo) error {
+	return nil
+}
+
+func (c *Console) SendChatAction(_ int, _ int64, action string) error {
+	c.print("[" + action + "...]")
+	return nil
+}
+
+func (c *Console) DroppedMessages() int64 {
+	return 0
+}
@@ -2,6 +2,7 @@ package tbotopenai
 
 import (
 	"bytes"
+	"encoding/base64"
 	"strconv"
 	"strings"
 )
@@ -27,9 +28,12 @@ type DBBodyRequest struct {
 	clipSkip          string
 	useKarrasSigmas   string
 	scheduler         string
+	initImage         string
+	strength          float64
 }
 
-func NewSerializedDBBodyRequest(key, body string) []byte {
+// NewSerializedDBBodyRequest - initImage задает исходное изображение для img2img, передается в base64
+func NewSerializedDBBodyRequest(key, body string, initImage []byte) []byte {
 	dbBodyReq := &DBBodyRequest{
 		key:               key,
 		modelID:           "midjourney",
@@ -50,6 +54,10 @@ func NewSerializedDBBodyRequest(key, body string) []byte {
 		clipSkip:          "2",
 		useKarrasSigmas:   "yes",
 		scheduler:         "UniPCMultistepScheduler",
+		strength:          0.7,
+	}
+	if len(initImage) > 0 {
+		dbBodyReq.initImage = base64.StdEncoding.EncodeToString(initImage)
 	}
 	dbBodyReq.fillChangedFields(body)
 	return dbBodyReq.serialize()
@@ -105,6 +113,12 @@ func (d *DBBodyRequest) fillChangedFields(body string) {
 			d.useKarrasSigmas = val
 		case "scheduler":
 			d.scheduler = val
+		case "strength":
+			strength, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				continue
+			}
+			d.strength = strength
 		}
 	}
 }
@@ -149,6 +163,14 @@ func (d *DBBodyRequest) serialize() []byte {
 	b.WriteString(d.useKarrasSigmas)
 	b.WriteString(`","scheduler":"`)
 	b.WriteString(d.scheduler)
+	if d.initImage != "" {
+		b.WriteString(`","init_image":"`)
+		b.WriteString(d.initImage)
+		b.WriteString(`","base64":"yes","strength":`)
+		b.WriteString(strconv.FormatFloat(d.strength, 'f', 2, 64))
+		b.WriteString(`}`)
+		return b.Bytes()
+	}
 	b.WriteString(`"}`)
 	return b.Bytes()
 }
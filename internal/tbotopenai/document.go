@@ -0,0 +1,409 @@
+package tbotopenai
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"go.uber.org/zap"
+)
+
+const (
+	documentExtTXT  = ".txt"
+	documentExtMD   = ".md"
+	documentExtPDF  = ".pdf"
+	documentExtDOCX = ".docx"
+)
+
+const (
+	// defaultDocumentMaxFileSize - Bot API позволяет скачивать файлы до 20 МБ
+	defaultDocumentMaxFileSize     = 20 << 20
+	defaultDocumentChunkSize       = 4000
+	defaultDocumentMaxContext      = 12000
+	defaultDocumentMaxSummaryParts = 20
+	// minLenDocumentKeyword - короткие слова вопроса не учитываются при выборе частей документа
+	minLenDocumentKeyword = 3
+	// maxDOCXBodySize - ограничение распакованного word/document.xml: архив небольшого размера
+	// может распаковываться в гигабайты
+	maxDOCXBodySize = 100 << 20
+)
+
+// documentSummaryQuery - запрос кнопки "Краткое содержание" вместо вопроса по документу
+const documentSummaryQuery = "#summary"
+
+const docxBodyPath = "word/document.xml"
+
+var (
+	errDocumentUnsupportedFormat = errors.New("document format is not supported")
+	errDocumentIsEmpty           = errors.New("document text is empty")
+	errDocxBodyIsNotExist        = errors.New("docx word/document.xml is not exist")
+	errDocumentIsNotAttached     = errors.New("document is not attached to session")
+	errDocumentIsTooLarge        = errors.New("document text is too large")
+)
+
+// sessionDocument - текст документа, прикрепленного к сессии, разбитый на части
+type sessionDocument struct {
+	name   string
+	chunks []string
+}
+
+func isSupportedDocument(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case documentExtTXT, documentExtMD, documentExtPDF, documentExtDOCX:
+		return true
+	}
+	return false
+}
+
+func extractDocumentText(fileName string, body []byte) (string, error) {
+	var (
+		text string
+		err  error
+	)
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case documentExtTXT, documentExtMD:
+		text = string(body)
+	case documentExtPDF:
+		text, err = extractPDFText(body)
+	case documentExtDOCX:
+		text, err = extractDOCXText(body)
+	default:
+		return "", errDocumentUnsupportedFormat
+	}
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(strings.ToValidUTF8(strings.ReplaceAll(text, "\r", ""), ""))
+	if text == "" {
+		return "", errDocumentIsEmpty
+	}
+	return text, nil
+}
+
+func extractPDFText(body []byte) (string, error) {
+	r, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return "", err
+	}
+	plain, err := r.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	text, err := io.ReadAll(plain)
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// extractDOCXText - текст из элементов w:t файла word/document.xml, абзацы w:p разделяются переносом строки
+func extractDOCXText(body []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return "", err
+	}
+	for _, f := range zr.File {
+		if f.Name != docxBodyPath {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		lr := &io.LimitedReader{R: rc, N: maxDOCXBodySize + 1}
+		text, err := parseDOCXBody(lr)
+		if lr.N <= 0 {
+			return "", errDocumentIsTooLarge
+		}
+		return text, err
+	}
+	return "", errDocxBodyIsNotExist
+}
+
+func parseDOCXBody(r io.Reader) (string, error) {
+	var (
+		b      strings.Builder
+		isText bool
+	)
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch el := token.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "t":
+				isText = true
+			case "tab":
+				b.WriteString("\t")
+			case "br":
+				b.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "t":
+				isText = false
+			case "p":
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			if isText {
+				b.Write(el)
+			}
+		}
+	}
+}
+
+func newSessionDocument(name, text string, chunkSize int) *sessionDocument {
+	if chunkSize <= 0 {
+		chunkSize = defaultDocumentChunkSize
+	}
+	return &sessionDocument{
+		name:   name,
+		chunks: splitDocumentText(text, chunkSize),
+	}
+}
+
+// splitDocumentText - части документа не длиннее chunkSize символов без нумерации и разметки;
+// часть заканчивается на переносе строки или пробеле во второй половине части, если он есть
+func splitDocumentText(text string, chunkSize int) []string {
+	runes := []rune(text)
+	chunks := make([]string, 0, len(runes)/chunkSize+1)
+	for len(runes) > 0 {
+		end := len(runes)
+		if end > chunkSize {
+			end = documentChunkEnd(runes[:chunkSize])
+		}
+		if chunk := strings.TrimSpace(string(runes[:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		runes = runes[end:]
+	}
+	return chunks
+}
+
+func documentChunkEnd(runes []rune) int {
+	for _, sep := range []rune{'\n', ' '} {
+		for idx := len(runes) - 1; idx >= len(runes)/2; idx-- {
+			if runes[idx] == sep {
+				return idx + 1
+			}
+		}
+	}
+	return len(runes)
+}
+
+func (d *sessionDocument) text() string {
+	return strings.Join(d.chunks, "\n\n")
+}
+
+func (d *sessionDocument) lenText() int {
+	var n int
+	for _, chunk := range d.chunks {
+		n += utf8.RuneCountInString(chunk)
+	}
+	return n
+}
+
+// relevantText - части документа, в которых чаще встречаются слова вопроса, в пределах maxLen символов;
+// части выводятся в порядке следования в документе
+func (d *sessionDocument) relevantText(question string, maxLen int) string {
+	if d.lenText() <= maxLen {
+		return d.text()
+	}
+	keywords := documentKeywords(question)
+	scores := make([]int, len(d.chunks))
+	for idx, chunk := range d.chunks {
+		lower := strings.ToLower(chunk)
+		for _, keyword := range keywords {
+			scores[idx] += strings.Count(lower, keyword)
+		}
+	}
+	order := make([]int, len(d.chunks))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	selected := make([]int, 0, len(order))
+	var n int
+	for _, idx := range order {
+		lenChunk := utf8.RuneCountInString(d.chunks[idx])
+		if n+lenChunk > maxLen {
+			continue
+		}
+		n += lenChunk
+		selected = append(selected, idx)
+	}
+	sort.Ints(selected)
+	parts := make([]string, 0, len(selected))
+	for _, idx := range selected {
+		parts = append(parts, d.chunks[idx])
+	}
+	return strings.Join(parts, "\n[...]\n")
+}
+
+func documentKeywords(question string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(question), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	keywords := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if utf8.RuneCountInString(field) >= minLenDocumentKeyword {
+			keywords = append(keywords, field)
+		}
+	}
+	return keywords
+}
+
+func promptDocumentQuestion(l localizer, name, text, question string) string {
+	return l.text(respPromptDocumentQuestion, "name", name, "text", text, "question", question)
+}
+
+func promptDocumentSummary(l localizer, name, text string) string {
+	return l.text(respPromptDocumentSummary, "name", name, "text", text)
+}
+
+func promptDocumentPartSummary(l localizer, name string, part, parts int, text string) string {
+	return l.text(respPromptDocumentPartSummary, "name", name, "part", part, "parts", parts, "text", text)
+}
+
+// attachDocument - к запросу добавляется прикрепленный к сессии документ: для вопроса - подходящие
+// части документа, для краткого содержания длинного документа - краткие содержания его частей
+func (t *TBotOpenAI) attachDocument(ctx context.Context, ai AI, key sessionKey, req *aiRequest) error {
+	doc, err := t.clientStates.ClientDocument(key)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		if req.prompt == documentSummaryQuery {
+			return errDocumentIsNotAttached
+		}
+		return nil
+	}
+	l := t.localizer(key.userID)
+	maxContext := t.cfg.Documents.MaxContext
+	if maxContext <= 0 {
+		maxContext = defaultDocumentMaxContext
+	}
+	if req.prompt != documentSummaryQuery {
+		req.prompt = promptDocumentQuestion(l, doc.name, doc.relevantText(req.prompt, maxContext), req.prompt)
+		return nil
+	}
+	if doc.lenText() <= maxContext {
+		req.prompt = promptDocumentSummary(l, doc.name, doc.text())
+		return nil
+	}
+	maxParts := t.cfg.Documents.MaxSummaryParts
+	if maxParts <= 0 {
+		maxParts = defaultDocumentMaxSummaryParts
+	}
+	chunks := doc.chunks
+	if len(chunks) > maxParts {
+		chunks = chunks[:maxParts]
+	}
+	summaries := make([]string, 0, len(chunks))
+	for idx := range chunks {
+		summary, err := ai.GenerateText(ctx, &aiRequest{
+			prompt: promptDocumentPartSummary(l, doc.name, idx+1, len(doc.chunks), chunks[idx]),
+		})
+		if err != nil {
+			return err
+		}
+		summaries = append(summaries, string(summary))
+	}
+	req.prompt = promptDocumentSummary(l, doc.name, truncateText(strings.Join(summaries, "\n\n"), maxContext))
+	return nil
+}
+
+// processDocumentMessage - документ принимают только текстовые команды, он обрабатывается в очереди
+func (t *TBotOpenAI) processDocumentMessage(msg *message) {
+	respBody := t.checkDocumentMessage(msg)
+	if respBody != "" {
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, t.localizer(msg.userID).text(respBody)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	t.enqueueTask(msg)
+}
+
+func (t *TBotOpenAI) checkDocumentMessage(msg *message) string {
+	command, err := t.taskCommandOf(msg)
+	if err != nil {
+		return respBodySessionIsNotExist
+	}
+	if p, ok := t.providers.get(command); !ok || p.isImage() {
+		return respErrBodyDocumentIsNotSupported
+	}
+	if !isSupportedDocument(msg.document.fileName) {
+		return respErrBodyDocumentFormat
+	}
+	maxFileSize := t.cfg.Documents.MaxFileSize
+	if maxFileSize <= 0 {
+		maxFileSize = defaultDocumentMaxFileSize
+	}
+	if msg.document.fileSize > maxFileSize {
+		return respErrBodyDocumentIsTooLarge
+	}
+	return ""
+}
+
+// processDocumentUpload - текст документа прикрепляется к сессии до /stop или загрузки другого документа;
+// подпись к документу обрабатывается как вопрос по нему
+func (t *TBotOpenAI) processDocumentUpload(msg *message) {
+	l := t.localizer(msg.userID)
+	body, err := t.telegram.DownloadFile(msg.document.fileID)
+	if err != nil {
+		t.log.Error("Download document err:", zap.Error(err))
+		if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respErrBodyDocument)); err != nil {
+			t.log.Error("Reply to client err:", zap.Error(err))
+		}
+		return
+	}
+	text, err := extractDocumentText(msg.document.fileName, body)
+	if err != nil {
+		t.log.Error("Extract document text err:", zap.Error(err),
+			zap.String("file_name", msg.document.fileName))
+		respBody := respErrBodyDocument
+		if errors.Is(err, errDocumentIsTooLarge) {
+			respBody = respErrBodyDocumentIsTooLarge
+		}
+		if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBody)); err != nil {
+			t.log.Error("Reply to client err:", zap.Error(err))
+		}
+		return
+	}
+	doc := newSessionDocument(msg.document.fileName, text, t.cfg.Documents.ChunkSize)
+	if err = t.clientStates.SetClientDocument(msg.session(), doc); err != nil {
+		t.log.Error("Set client document err:", zap.Error(err))
+		if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodySessionIsNotExist)); err != nil {
+			t.log.Error("Reply to client err:", zap.Error(err))
+		}
+		return
+	}
+	respBody := l.text(respBodyDocumentAttached, "name", doc.name, "count", doc.lenText(), "parts", len(doc.chunks))
+	if err = t.telegram.ReplyKeyboard(msg.messageID, msg.chatID, respBody, keyboardDocument(l)); err != nil {
+		t.log.Error("Reply to client err:", zap.Error(err))
+	}
+	if msg.text == "" {
+		return
+	}
+	t.processMessage(msg.followUp(msg.text))
+}
@@ -0,0 +1,57 @@
+package tbotopenai
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitDocumentText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		chunkSize int
+		expChunks []string
+	}{
+		{
+			name:      "Short text is one chunk",
+			text:      "Короткий текст",
+			chunkSize: 100,
+			expChunks: []string{"Короткий текст"},
+		},
+		{
+			name:      "Chunk ends at a line break",
+			text:      "first line\nsecond line",
+			chunkSize: 15,
+			expChunks: []string{"first line", "second line"},
+		},
+		{
+			name:      "Chunk ends at a space",
+			text:      "one two three four",
+			chunkSize: 10,
+			expChunks: []string{"one two", "three four"},
+		},
+		{
+			name:      "Long word is cut by size",
+			text:      "abcdefghij",
+			chunkSize: 4,
+			expChunks: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:      "Chunks have no markers and fences",
+			text:      "```\ncode\n```",
+			chunkSize: 6,
+			expChunks: []string{"```", "code", "```"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitDocumentText(tt.text, tt.chunkSize)
+			assert.Equal(t, tt.expChunks, chunks)
+			for _, chunk := range chunks {
+				assert.LessOrEqual(t, utf8.RuneCountInString(chunk), tt.chunkSize)
+			}
+		})
+	}
+}
@@ -32,8 +32,9 @@ var (
 )
 
 const (
-	dbURL      = "https://stablediffusionapi.com/api/v4/dreambooth"
-	dbFetchURL = "https://stablediffusionapi.com/api/v4/dreambooth/fetch"
+	dbURL        = "https://stablediffusionapi.com/api/v4/dreambooth"
+	dbImg2ImgURL = "https://stablediffusionapi.com/api/v4/dreambooth/img2img"
+	dbFetchURL   = "https://stablediffusionapi.com/api/v4/dreambooth/fetch"
 )
 
 const (
@@ -57,93 +58,119 @@ func NewDreamBoothAPI(log *zap.Logger, cfg *DreamBoothSettings) *DreamBooth {
 	}
 }
 
-func (d *DreamBooth) GenerateText(_ context.Context, _ string) (body []byte, err error) {
+func (d *DreamBooth) GenerateText(_ context.Context, _ *aiRequest) (body []byte, err error) {
 	return nil, nil
 }
 
-func (d *DreamBooth) GenerateImage(ctx context.Context, prompt string) (body []byte, fileName string, err error) {
+// GenerateImage - при наличии изображения в запросе оно используется как исходное (img2img)
+func (d *DreamBooth) GenerateImage(ctx context.Context, req *aiRequest) (files []imageFile, err error) {
 	if len(d.tokens) == 0 {
-		return nil, "", errDBEmptyTokens
+		return nil, errDBEmptyTokens
 	}
 	lastIDDBKey := atomic.LoadInt64(&d.lastIDDBKey)
 	for idx := lastIDDBKey; idx < int64(len(d.tokens)); idx++ {
-		body, fileName, err = d.TextToImage(ctx, prompt, d.tokens[idx])
+		if len(req.images) > 0 {
+			files, err = d.ImageToImage(ctx, req.prompt, req.images[0].body, d.tokens[idx])
+		} else {
+			files, err = d.TextToImage(ctx, req.prompt, d.tokens[idx])
+		}
 		if err == nil || !errors.Is(err, errDBMonthLimit) {
 			if idx != lastIDDBKey {
 				atomic.StoreInt64(&d.lastIDDBKey, idx)
 			}
-			return body, fileName, err
+			return files, err
 		}
 		if idx == int64(len(d.tokens))-1 {
 			idx = 0
 		}
 	}
-	return nil, "", err
+	return nil, err
 }
 
 // TextToImage - https://stablediffusionapi.com/docs/community-models-api-v4/dreamboothtext2img
-func (d *DreamBooth) TextToImage(ctx context.Context, text, key string) ([]byte, string, error) {
+func (d *DreamBooth) TextToImage(ctx context.Context, text, key string) ([]imageFile, error) {
+	return d.generate(ctx, dbURL, NewSerializedDBBodyRequest(key, text, nil), key)
+}
+
+// ImageToImage - https://stablediffusionapi.com/docs/community-models-api-v4/dreamboothimg2img
+func (d *DreamBooth) ImageToImage(ctx context.Context, text string, initImage []byte, key string) ([]imageFile, error) {
+	return d.generate(ctx, dbImg2ImgURL, NewSerializedDBBodyRequest(key, text, initImage), key)
+}
+
+func (d *DreamBooth) generate(ctx context.Context, uri string, reqBody []byte, key string) ([]imageFile, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 	req.Header.SetMethod(fasthttp.MethodPost)
 	req.Header.SetContentType("application/json")
-	req.SetRequestURI(dbURL)
-	reqBody := NewSerializedDBBodyRequest(key, text)
+	req.SetRequestURI(uri)
 	req.SetBody(reqBody)
 	d.log.Debug("DreamBooth request body:", zap.String("body", string(reqBody)))
 	if err := fasthttp.Do(req, resp); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 	respBody := resp.Body()
 	d.log.Debug("DreamBooth response body:", zap.String("body", string(respBody)))
 	if resp.StatusCode() != fasthttp.StatusOK {
-		return nil, "", errDBInvalidRespCode
+		return nil, errDBInvalidRespCode
 	}
 	return d.processResponseBody(ctx, respBody, key)
 }
 
-func (d *DreamBooth) processResponseBody(ctx context.Context, respBody []byte, token string) ([]byte, string, error) {
+func (d *DreamBooth) processResponseBody(ctx context.Context, respBody []byte, token string) ([]imageFile, error) {
 	var p fastjson.Parser
 	v, err := p.ParseBytes(respBody)
 	if err != nil {
-		return nil, "", errDBParsingRespBody
+		return nil, errDBParsingRespBody
 	}
 	status := string(v.GetStringBytes("status"))
 	switch status {
 	case dbStatusSuccess:
-		output := string(v.GetStringBytes("output", "0"))
-		if output == "" {
-			return nil, "", errDBOutputIsEmpty
+		outputURLs := parseOutputURLs(v)
+		if len(outputURLs) == 0 {
+			return nil, errDBOutputIsEmpty
 		}
-		return d.downloadFile(output)
+		return d.processStatusSuccess(outputURLs)
 	case dbStatusProcessing:
+		reportProgress(ctx, upstreamStatus{
+			api:    labelDreamBooth,
+			status: dbStatusProcessing,
+			eta:    time.Duration(v.GetFloat64("eta")) * time.Second,
+		})
 		return d.processStatusProcessing(ctx, token, strconv.Itoa(v.GetInt("id")))
 	case dbStatusError:
 		if err = d.processStatusError(string(v.GetStringBytes("message"))); err != nil {
-			return nil, "", err
+			return nil, err
 		}
 	}
-	return nil, "", errDBUnsupportedStatus
+	return nil, errDBUnsupportedStatus
 }
 
-func (d *DreamBooth) processStatusSuccess(outputURL string) ([]byte, string, error) {
-	return d.downloadFile(outputURL)
+func (d *DreamBooth) processStatusSuccess(outputURLs []string) ([]imageFile, error) {
+	files := make([]imageFile, 0, len(outputURLs))
+	for _, outputURL := range outputURLs {
+		body, fileName, err := d.downloadFile(outputURL)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, imageFile{body: body, fileName: fileName})
+	}
+	return files, nil
 }
 
-func (d *DreamBooth) processStatusProcessing(ctx context.Context, token, requestID string) ([]byte, string, error) {
+func (d *DreamBooth) processStatusProcessing(ctx context.Context, token, requestID string) ([]imageFile, error) {
 	if requestID == "" {
-		return nil, "", errDBRequestIDIsEmpty
+		return nil, errDBRequestIDIsEmpty
 	}
-	outputURL, err := d.processRetryFetchQueuedImages(ctx, requestID, token)
+	outputURLs, err := d.processRetryFetchQueuedImages(ctx, requestID, token)
 	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		return nil, "", err
+		return nil, err
 	}
-	if err != nil || len(outputURL) == 0 {
-		return nil, "", errDBOutputIsEmpty
+	if err != nil || len(outputURLs) == 0 {
+		return nil, errDBOutputIsEmpty
 	}
-	return d.downloadFile(string(outputURL))
+	return d.processStatusSuccess(outputURLs)
 }
 
 func (d *DreamBooth) processStatusError(message string) error {
@@ -154,15 +181,15 @@ func (d *DreamBooth) processStatusError(message string) error {
 	return err
 }
 
-func (d *DreamBooth) processRetryFetchQueuedImages(ctx context.Context, requestID, key string) ([]byte, error) {
+func (d *DreamBooth) processRetryFetchQueuedImages(ctx context.Context, requestID, key string) ([]string, error) {
 	for {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		default:
-			outputURL, err := d.FetchQueuedImages(requestID, key)
+			outputURLs, err := d.FetchQueuedImages(requestID, key)
 			if err == nil {
-				return outputURL, err
+				return outputURLs, err
 			}
 			time.Sleep(d.retryTimeout)
 		}
@@ -170,7 +197,7 @@ func (d *DreamBooth) processRetryFetchQueuedImages(ctx context.Context, requestI
 }
 
 // FetchQueuedImages - https://stablediffusionapi.com/docs/community-models-api-v4/dreamboothfetchqueimg
-func (d *DreamBooth) FetchQueuedImages(requestID, key string) ([]byte, error) {
+func (d *DreamBooth) FetchQueuedImages(requestID, key string) ([]string, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	resp := fasthttp.AcquireResponse()
@@ -194,11 +221,11 @@ func (d *DreamBooth) FetchQueuedImages(requestID, key string) ([]byte, error) {
 	if err != nil {
 		return nil, errDBFQIParsingRespBody
 	}
-	output := v.GetStringBytes("output", "0")
-	if len(output) == 0 {
+	outputURLs := parseOutputURLs(v)
+	if len(outputURLs) == 0 {
 		return nil, errDBOutputIsEmpty
 	}
-	return output, nil
+	return outputURLs, nil
 }
 
 func (d *DreamBooth) downloadFile(fileURL string) ([]byte, string, error) {
@@ -229,6 +256,17 @@ func (d *DreamBooth) downloadFile(fileURL string) ([]byte, string, error) {
 	return respBody, fileName, nil
 }
 
+func parseOutputURLs(v *fastjson.Value) []string {
+	outputs := v.GetArray("output")
+	outputURLs := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		if outputURL := string(output.GetStringBytes()); outputURL != "" {
+			outputURLs = append(outputURLs, outputURL)
+		}
+	}
+	return outputURLs
+}
+
 func prepareFetchQueueImagesRequest(key, requestID string) []byte {
 	var reqBody bytes.Buffer
 	reqBody.WriteString(`{"key":"`)
@@ -0,0 +1,204 @@
+package tbotopenai
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Клиент может отредактировать запрос к AI: запрос в очереди или выполняющийся отменяется и выполняется
+// заново с новым текстом, а к уже выполненному бот предлагает кнопку повтора с изменениями.
+
+// maxLenEditableJobs - хранятся последние запросы, старые вытесняются
+const maxLenEditableJobs = 10000
+
+// callbackRerun - команда кнопки повтора, текст кнопки - номер сообщения с запросом
+const callbackRerun = "rerun"
+
+// editableJob - запрос клиента, отменяемый при редактировании его сообщения
+type editableJob struct {
+	mutex      sync.Mutex
+	msg        *message
+	command    string
+	ctx        context.Context
+	cancel     context.CancelFunc
+	isFinished bool
+	// edited - сообщение, отредактированное после выполнения запроса, ждет нажатия кнопки повтора
+	edited *message
+}
+
+// isCanceled - запрос отредактирован и уже поставлен в очередь заново
+func (j *editableJob) isCanceled() bool {
+	return j != nil && j.ctx.Err() != nil
+}
+
+// supersede - отмена запроса, который еще не выполнен
+func (j *editableJob) supersede() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.isFinished {
+		return false
+	}
+	j.cancel()
+	return true
+}
+
+// finish - false, если запрос был отредактирован во время выполнения и его ответ не нужен
+func (j *editableJob) finish() bool {
+	if j == nil {
+		return true
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.ctx.Err() != nil {
+		return false
+	}
+	j.isFinished = true
+	return true
+}
+
+func (j *editableJob) setEdited(msg *message) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if !j.isFinished {
+		return false
+	}
+	j.edited = msg
+	return true
+}
+
+func (j *editableJob) takeEdited(userID int64) *message {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	edited := j.edited
+	if edited == nil || edited.userID != userID {
+		return nil
+	}
+	j.edited = nil
+	return edited
+}
+
+// jobContext - контекст запроса, отменяемый при редактировании сообщения клиента
+func (m *message) jobContext() context.Context {
+	if m.job == nil {
+		return context.Background()
+	}
+	return m.job.ctx
+}
+
+type editableJobs struct {
+	mutex sync.Mutex
+	value map[messageRef]*editableJob
+	order []messageRef
+}
+
+func (e *editableJobs) store(chatID int64, messageID int, job *editableJob) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.value == nil {
+		e.value = make(map[messageRef]*editableJob)
+	}
+	ref := messageRef{chatID: chatID, messageID: messageID}
+	if _, ok := e.value[ref]; !ok {
+		e.order = append(e.order, ref)
+	}
+	e.value[ref] = job
+	if len(e.order) > maxLenEditableJobs {
+		delete(e.value, e.order[0])
+		e.order = e.order[1:]
+	}
+}
+
+func (e *editableJobs) load(chatID int64, messageID int) (*editableJob, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	job, ok := e.value[messageRef{chatID: chatID, messageID: messageID}]
+	return job, ok
+}
+
+// trackEditableJob - запрос к AI запоминается по сообщению клиента
+func (t *TBotOpenAI) trackEditableJob(msg *message, command string) {
+	if !t.cfg.Edits.Rerun && !t.cfg.Edits.RerunButton {
+		return
+	}
+	if msg.callbackID != "" || !t.isProviderCommand(command) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	msg.job = &editableJob{msg: msg, command: command, ctx: ctx, cancel: cancel}
+	t.editableJobs.store(msg.chatID, msg.messageID, msg.job)
+}
+
+// processEditedMessage - запрос, который еще не выполнен, перезапускается с новым текстом,
+// а к выполненному отправляется кнопка повтора
+func (t *TBotOpenAI) processEditedMessage(msg *message) {
+	job, ok := t.editableJobs.load(msg.chatID, msg.messageID)
+	if !ok || msg.text == "" || msg.command != "" {
+		return
+	}
+	l := t.localizer(msg.userID)
+	if t.cfg.Edits.Rerun && job.supersede() {
+		t.log.Info("Rerun edited job",
+			zap.Int64("chat_id", msg.chatID),
+			zap.Int("message_id", msg.messageID))
+		t.cancelProgress(job.msg.progress, l.text(respBodyJobRestarted))
+		t.rerunJob(job, msg)
+		return
+	}
+	if !t.cfg.Edits.RerunButton || !job.setEdited(msg) {
+		return
+	}
+	err := t.telegram.ReplyKeyboard(msg.messageID, msg.chatID, l.text(respBodyJobEdited), keyboardRerun(l, msg.messageID))
+	if err != nil {
+		t.log.Error("Reply message error:", zap.Error(err))
+	}
+}
+
+// processRerunCallback - кнопка повтора ставит в очередь запрос с текстом из отредактированного сообщения
+func (t *TBotOpenAI) processRerunCallback(msg *message) {
+	l := t.localizer(msg.userID)
+	job, edited := t.takeEditedJob(msg)
+	if edited == nil {
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respErrBodyRerunIsNotExist)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	if respBody := t.checkJobsLimit(job.command, edited.session()); respBody != "" {
+		job.setEdited(edited)
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBody)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	t.rerunJob(job, edited)
+}
+
+// takeEditedJob - запрос и его отредактированное сообщение по данным кнопки повтора
+func (t *TBotOpenAI) takeEditedJob(msg *message) (*editableJob, *message) {
+	messageID, err := strconv.Atoi(msg.text)
+	if err != nil {
+		return nil, nil
+	}
+	job, ok := t.editableJobs.load(msg.chatID, messageID)
+	if !ok || !t.checkPermissions(job.command, msg.username) {
+		return nil, nil
+	}
+	return job, job.takeEdited(msg.userID)
+}
+
+// rerunJob - отредактированный запрос выполняется командой исходного запроса, даже если клиент
+// уже выбрал другую; ответ на изображение заново уточняет его исходный промпт
+func (t *TBotOpenAI) rerunJob(job *editableJob, msg *message) {
+	msg.isEdited = false
+	command := job.command
+	if refinedCommand, prompt, ok := t.refineImageRequest(msg); ok {
+		command, msg.text = refinedCommand, prompt
+	}
+	msg.taskCommand = command
+	t.trackEditableJob(msg, command)
+	t.enqueueProgress(msg, command)
+	t.enqueueTask(msg)
+}
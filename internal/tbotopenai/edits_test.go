@@ -0,0 +1,106 @@
+package tbotopenai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEditableJob(msg *message) *editableJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &editableJob{msg: msg, command: commandChatGPT, ctx: ctx, cancel: cancel}
+}
+
+func TestEditableJob_Supersede(t *testing.T) {
+	tests := []struct {
+		name          string
+		isFinished    bool
+		expSuperseded bool
+		expFinished   bool
+	}{
+		{
+			name:          "Job in the queue is canceled",
+			expSuperseded: true,
+			expFinished:   false,
+		},
+		{
+			name:          "Finished job is not canceled",
+			isFinished:    true,
+			expSuperseded: false,
+			expFinished:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestEditableJob(&message{})
+			if tt.isFinished {
+				assert.True(t, job.finish())
+			}
+			assert.Equal(t, tt.expSuperseded, job.supersede())
+			assert.Equal(t, tt.expSuperseded, job.isCanceled())
+			assert.Equal(t, tt.expFinished, job.finish())
+		})
+	}
+}
+
+func TestEditableJob_TakeEdited(t *testing.T) {
+	edited := &message{userID: 1, text: "edited"}
+	tests := []struct {
+		name       string
+		isFinished bool
+		userID     int64
+		expEdited  *message
+	}{
+		{
+			name:       "Edited message of the finished job",
+			isFinished: true,
+			userID:     1,
+			expEdited:  edited,
+		},
+		{
+			name:   "Job is not finished",
+			userID: 1,
+		},
+		{
+			name:       "Button is pressed by another user",
+			isFinished: true,
+			userID:     2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestEditableJob(&message{userID: 1})
+			if tt.isFinished {
+				job.finish()
+			}
+			assert.Equal(t, tt.isFinished, job.setEdited(edited))
+			assert.Equal(t, tt.expEdited, job.takeEdited(tt.userID))
+			// отредактированное сообщение выполняется повтором не больше одного раза
+			assert.Nil(t, job.takeEdited(tt.userID))
+		})
+	}
+}
+
+func TestEditableJobs_Store(t *testing.T) {
+	var jobs editableJobs
+	for messageID := 1; messageID <= maxLenEditableJobs+1; messageID++ {
+		jobs.store(1, messageID, newTestEditableJob(&message{messageID: messageID}))
+	}
+	_, ok := jobs.load(1, 1)
+	assert.False(t, ok)
+	job, ok := jobs.load(1, maxLenEditableJobs+1)
+	assert.True(t, ok)
+	assert.Equal(t, maxLenEditableJobs+1, job.msg.messageID)
+	_, ok = jobs.load(2, maxLenEditableJobs+1)
+	assert.False(t, ok)
+	assert.Len(t, jobs.order, maxLenEditableJobs)
+}
+
+func TestMessage_JobContext(t *testing.T) {
+	msg := &message{}
+	assert.NoError(t, msg.jobContext().Err())
+	msg.job = newTestEditableJob(msg)
+	msg.job.supersede()
+	assert.ErrorIs(t, msg.jobContext().Err(), context.Canceled)
+}
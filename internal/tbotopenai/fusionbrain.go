@@ -14,7 +14,8 @@ import (
 )
 
 const (
-	countRequestFields = 5
+	countRequestFields    = 5
+	fusionBrainStyleField = 4
 
 	defaultWidth  = 512
 	defaultHeight = 512
@@ -47,64 +48,73 @@ func NewFusionBrainAPI(log *zap.Logger, cfg *FusionBrainSettings) *FusionBrainAP
 	}
 }
 
-func (f *FusionBrainAPI) GenerateText(_ context.Context, _ string) (body []byte, err error) {
+func (f *FusionBrainAPI) GenerateText(_ context.Context, _ *aiRequest) (body []byte, err error) {
 	return nil, nil
 }
 
-func (f *FusionBrainAPI) GenerateImage(ctx context.Context, prompt string) (body []byte, fileName string, err error) {
+func (f *FusionBrainAPI) GenerateImage(ctx context.Context, req *aiRequest) (files []imageFile, err error) {
 	var models []fbAPI.Model
 	models, err = f.fb.GetModels(ctx)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 	if len(models) == 0 {
-		return nil, "", errFusionBrainEmptyModels
+		return nil, errFusionBrainEmptyModels
 	}
 	if err = f.fb.CheckAvailable(ctx, models[0].ID); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 	var styles []fbAPI.Style
 	styles, err = f.fb.GetStyles(ctx)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 	if len(styles) == 0 {
-		return nil, "", errFusionBrainEmptyStyles
+		return nil, errFusionBrainEmptyStyles
 	}
 	stylesNames := make(map[string]struct{}, len(styles))
 	for idx := range styles {
 		stylesNames[styles[idx].Name] = struct{}{}
 	}
-	reqBody := validateAndPrepareFBRequestBody(prompt, stylesNames)
+	reqBody := validateAndPrepareFBRequestBody(req.prompt, stylesNames)
 	if reqBody == nil {
-		return nil, "", errFusionBrainInvalidRequestBody
+		return nil, errFusionBrainInvalidRequestBody
 	}
 	var uuid string
 	uuid, err = f.fb.TextToImage(ctx, *reqBody, models[0].ID)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 	for {
 		select {
 		case <-ctx.Done():
-			return nil, "", ctx.Err()
+			return nil, ctx.Err()
 		default:
 			var status fbAPI.GenerationStatus
 			status, err = f.fb.CheckStatus(ctx, uuid)
 			if err != nil {
-				return nil, "", err
+				return nil, err
 			}
+			reportProgress(ctx, upstreamStatus{api: labelFusionBrain, status: status.Status})
 			if status.Status == fbAPI.StatusFail {
-				return nil, "", err
+				return nil, err
 			}
 			if status.Status == fbAPI.StatusDone {
-				var imgBody []byte
-				// избавляемся от кавычек с начала и с конца
-				imgBodyBase64 := status.Images[0][1:][:len(status.Images[0][1:])-1]
-				if imgBody, err = base64.StdEncoding.DecodeString(imgBodyBase64); err != nil {
-					return nil, "", err
+				files = make([]imageFile, 0, len(status.Images))
+				for idx := range status.Images {
+					var imgBody []byte
+					// избавляемся от кавычек с начала и с конца
+					imgBodyBase64 := status.Images[idx][1:][:len(status.Images[idx][1:])-1]
+					if imgBody, err = base64.StdEncoding.DecodeString(imgBodyBase64); err != nil {
+						return nil, err
+					}
+					fileName := status.UUID + formatImgFile
+					if idx > 0 {
+						fileName = status.UUID + "_" + strconv.Itoa(idx) + formatImgFile
+					}
+					files = append(files, imageFile{body: imgBody, fileName: fileName})
 				}
-				return imgBody, status.UUID + formatImgFile, err
+				return files, err
 			}
 			time.Sleep(f.retryTimeout)
 		}
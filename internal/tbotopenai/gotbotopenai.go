@@ -3,11 +3,15 @@ package tbotopenai
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
 
 	"go.uber.org/zap"
+
+	"github.com/dm1trypon/go-telebot-open-ai/pkg/tgmarkdown"
 )
 
 const (
@@ -27,6 +31,13 @@ const (
 	commandBan               = "ban"
 	commandUnban             = "unban"
 	commandBlacklist         = "blacklist"
+	commandImageFormat       = "imageFormat"
+	commandGroupCommands     = "groupCommands"
+	commandLanguage          = "language"
+	commandTopicCommand      = "topicCommand"
+	commandReset             = "reset"
+	commandPersona           = "persona"
+	commandModel             = "model"
 )
 
 const (
@@ -34,19 +45,58 @@ const (
 	roleUser  = "user"
 )
 
+const (
+	imageFormatPhoto    = "photo"
+	imageFormatDocument = "document"
+	imageFormatBoth     = "both"
+)
+
+type imageFile struct {
+	body     []byte
+	fileName string
+}
+
+// aiRequest - запрос к AI: текст клиента, приложенные к нему изображения, предыдущие сообщения диалога,
+// системный промпт персоны и модель, "" - модель провайдера по умолчанию
+type aiRequest struct {
+	prompt  string
+	images  []imageFile
+	history []chatMessage
+	system  string
+	model   string
+}
+
+// imageURLs - изображения запроса в виде data URL для моделей с поддержкой vision
+func (r *aiRequest) imageURLs() []string {
+	urls := make([]string, 0, len(r.images))
+	for idx := range r.images {
+		urls = append(urls, "data:"+http.DetectContentType(r.images[idx].body)+";base64,"+
+			base64.StdEncoding.EncodeToString(r.images[idx].body))
+	}
+	return urls
+}
+
 type AI interface {
-	GenerateText(ctx context.Context, prompt string) ([]byte, error)
-	GenerateImage(ctx context.Context, prompt string) ([]byte, string, error)
+	GenerateText(ctx context.Context, req *aiRequest) ([]byte, error)
+	GenerateImage(ctx context.Context, req *aiRequest) ([]imageFile, error)
+}
+
+// TextStreamer - необязательное расширение AI для потоковой генерации текста.
+// onDelta вызывается для каждой новой части ответа, возвращается ответ целиком
+// (при ошибке или отмене - полученная к этому моменту часть).
+type TextStreamer interface {
+	GenerateTextStream(ctx context.Context, req *aiRequest, onDelta func(delta string)) ([]byte, error)
 }
 
 type TBotOpenAI struct {
 	cfg                 *Config
 	telegram            Messenger
-	dreamBooth          AI
-	openAI              AI
-	chatGPTBot          AI
-	fusionBrain         AI
-	clientStates        clientStateByChatID
+	providers           *providerRegistry
+	commands            []commandInfo
+	speechToText        SpeechToText
+	clientStates        clientStateBySession
+	locales             *locales
+	languages           userLanguages
 	stats               *Stats
 	log                 *zap.Logger
 	msgChan             chan *message
@@ -56,48 +106,83 @@ type TBotOpenAI struct {
 	taskByCmd           sync.Map
 	clientStateByCmd    sync.Map
 	blacklist           sync.Map
+	groupCommands       sync.Map
+	topicCommandByKey   sync.Map
+	inlineJobs          inlineJobByUserID
+	jobsProgress        jobProgressList
+	threads             threadStore
+	editableJobs        editableJobs
+	menuSessions        sync.Map
+	menuUpdates         menuUpdates
 	respBodiesAfterTask sync.Map
 }
 
+// messengerFactory - создает Messenger, который передает сообщения клиентов в msgChan
+type messengerFactory func(locales *locales, msgChan chan<- *message) (Messenger, error)
+
 func NewTBotOpenAI(cfg *Config, log *zap.Logger) (*TBotOpenAI, error) {
+	return newTBotOpenAIWithMessenger(cfg, log, func(locales *locales, msgChan chan<- *message) (Messenger, error) {
+		return newMessenger(cfg, log, locales, msgChan)
+	})
+}
+
+func newTBotOpenAIWithMessenger(cfg *Config, log *zap.Logger, newMessenger messengerFactory) (*TBotOpenAI, error) {
 	msgChan := make(chan *message, cfg.LenMessageChan)
 	queueTaskChan := make(chan *message, cfg.LenQueueTaskChan)
-	telegram, err := NewTelegram(&cfg.Telegram, log, msgChan)
+	locales, err := loadLocales(&cfg.Locales, log)
+	if err != nil {
+		return nil, err
+	}
+	providers, err := newProviderRegistry(log, cfg)
+	if err != nil {
+		return nil, err
+	}
+	telegram, err := newMessenger(locales, msgChan)
 	if err != nil {
 		return nil, err
 	}
 	t := &TBotOpenAI{
 		cfg:           cfg,
 		telegram:      telegram,
-		dreamBooth:    NewDreamBoothAPI(log, &cfg.DreamBooth),
-		openAI:        NewOpenAI(&cfg.OpenAI),
-		chatGPTBot:    NewChatGPTBot(),
-		fusionBrain:   NewFusionBrainAPI(log, &cfg.FusionBrain),
-		clientStates:  clientStateByChatID{value: make(map[int64]*clientState)},
-		stats:         NewStats(log, cfg.Stats.Interval, cfg.Stats.Filepath),
+		providers:     providers,
+		commands:      newCommands(providers),
+		clientStates:  clientStateBySession{value: make(map[sessionKey]*clientState)},
+		locales:       locales,
+		stats:         NewStats(log, cfg.Stats.Interval, cfg.Stats.Filepath, statsHeader(locales)),
 		log:           log,
 		msgChan:       msgChan,
 		queueTaskChan: queueTaskChan,
+		inlineJobs:    inlineJobByUserID{value: make(map[int64]*inlineJob)},
+		jobsProgress:  jobProgressList{stopChan: make(chan struct{})},
+		menuUpdates:   newMenuUpdates(),
+	}
+	if cfg.SpeechToText.Enabled {
+		t.speechToText = NewWhisper(&cfg.SpeechToText)
 	}
 	t.setUserRoles(&cfg.Roles)
 	t.setPermissions(&cfg.Permissions)
-	t.taskByCmd.Store(commandChatGPT, t.processChatGPT)
-	t.taskByCmd.Store(commandDreamBooth, t.processDreamBooth)
+	for _, p := range providers.list {
+		t.taskByCmd.Store(p.cfg.Command, t.processProvider(p))
+		t.clientStateByCmd.Store(p.cfg.Command, t.commandProvider(p))
+		if p.cfg.Type == providerTypeFusionBrain {
+			t.respBodiesAfterTask.Store(p.cfg.Command, respBodyFusionBrainInput[0])
+		}
+	}
 	t.taskByCmd.Store(commandCancelJob, t.processCancelJob)
-	t.taskByCmd.Store(commandOpenAIText, t.processOpenAIText)
-	t.taskByCmd.Store(commandOpenAIImage, t.processOpenAIImage)
-	t.taskByCmd.Store(commandFusionBrain, t.processFusionBrain)
 	t.taskByCmd.Store(commandBan, t.processBan)
 	t.taskByCmd.Store(commandUnban, t.processUnban)
+	t.taskByCmd.Store(commandImageFormat, t.processImageFormat)
+	t.taskByCmd.Store(commandGroupCommands, t.processGroupCommands)
+	t.taskByCmd.Store(commandLanguage, t.processLanguage)
+	t.taskByCmd.Store(commandPersona, t.processPersona)
+	t.taskByCmd.Store(commandModel, t.processModel)
+	t.taskByCmd.Store(commandTopicCommand, t.processTopicCommand)
+	if providers.hasType(providerTypeDreamBooth) {
+		t.clientStateByCmd.Store(commandDreamBoothExample, t.commandDreamBoothExample)
+	}
 	t.clientStateByCmd.Store(commandHelp, t.commandHelp)
-	t.clientStateByCmd.Store(commandDreamBoothExample, t.commandDreamBoothExample)
 	t.clientStateByCmd.Store(commandStart, t.commandStart)
 	t.clientStateByCmd.Store(commandStop, t.commandStop)
-	t.clientStateByCmd.Store(commandChatGPT, t.commandChatGPT)
-	t.clientStateByCmd.Store(commandDreamBooth, t.commandDreamBooth)
-	t.clientStateByCmd.Store(commandOpenAIText, t.commandOpenAIText)
-	t.clientStateByCmd.Store(commandOpenAIImage, t.commandOpenAIImage)
-	t.clientStateByCmd.Store(commandFusionBrain, t.commandFusionBrain)
 	t.clientStateByCmd.Store(commandCancelJob, t.commandCancelJob)
 	t.clientStateByCmd.Store(commandListJobs, t.commandListJobs)
 	t.clientStateByCmd.Store(commandStats, t.commandStats)
@@ -105,10 +190,28 @@ func NewTBotOpenAI(cfg *Config, log *zap.Logger) (*TBotOpenAI, error) {
 	t.clientStateByCmd.Store(commandBan, t.commandBan)
 	t.clientStateByCmd.Store(commandUnban, t.commandUnban)
 	t.clientStateByCmd.Store(commandBlacklist, t.commandBlacklist)
-	t.respBodiesAfterTask.Store(commandFusionBrain, respBodyFusionBrainInput[0])
+	t.clientStateByCmd.Store(commandImageFormat, t.commandImageFormat)
+	t.clientStateByCmd.Store(commandGroupCommands, t.commandGroupCommands)
+	t.clientStateByCmd.Store(commandLanguage, t.commandLanguage)
+	t.clientStateByCmd.Store(commandTopicCommand, t.commandTopicCommand)
+	t.clientStateByCmd.Store(commandReset, t.commandReset)
+	t.clientStateByCmd.Store(commandPersona, t.commandPersona)
+	t.clientStateByCmd.Store(commandModel, t.commandModel)
 	if err = t.storeBlacklist(); err != nil {
 		return nil, err
 	}
+	if err = t.storeGroupCommands(); err != nil {
+		return nil, err
+	}
+	if err = t.storeTopicCommands(); err != nil {
+		return nil, err
+	}
+	if err = t.storeMenuSessions(); err != nil {
+		return nil, err
+	}
+	if err = t.storeUserLanguages(); err != nil {
+		return nil, err
+	}
 	return t, nil
 }
 
@@ -121,6 +224,11 @@ func (t *TBotOpenAI) Run() {
 	t.initQueueTaskWorkers(&wg)
 	wg.Add(1)
 	go t.initProcessMessagesWorker(&wg)
+	go t.initCommandMenusWorker()
+	go t.refreshCommandMenus()
+	if t.cfg.Progress.Enabled {
+		go t.initProgressWorker()
+	}
 	t.telegram.Run()
 	wg.Wait()
 }
@@ -128,16 +236,23 @@ func (t *TBotOpenAI) Run() {
 func (t *TBotOpenAI) Stop() {
 	t.telegram.Stop()
 	t.stats.Stop()
+	close(t.jobsProgress.stopChan)
+	close(t.menuUpdates.stopChan)
 	close(t.msgChan)
 	close(t.queueTaskChan)
 }
 
-func (t *TBotOpenAI) initProcessMessagesWorker(wg *sync.WaitGroup) {
+// withRecover - паника при обработке одного сообщения не останавливает обработчик
+func (t *TBotOpenAI) withRecover(process func()) {
 	defer func() {
 		if r := recover(); r != nil {
 			t.log.Error("Recovered panic err:", zap.Any("panic", r))
 		}
 	}()
+	process()
+}
+
+func (t *TBotOpenAI) initProcessMessagesWorker(wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
 		select {
@@ -145,115 +260,211 @@ func (t *TBotOpenAI) initProcessMessagesWorker(wg *sync.WaitGroup) {
 			if !ok {
 				return
 			}
-			t.log.Debug("Received message",
-				zap.String("user", msg.username),
-				zap.String("body", msg.text),
-				zap.String("command", msg.command))
-			if t.isBanned(msg.username) {
-				if err := t.telegram.ReplyText(msg.messageID, msg.chatID, respBodyAccessDenied); err != nil {
-					t.log.Error("Reply message error:", zap.Error(err))
-				}
-				continue
-			}
-			respBody := t.checkChanMessagesBuffer()
-			if respBody != "" {
-				if err := t.telegram.ReplyText(msg.messageID, msg.chatID, respBody); err != nil {
-					t.log.Error("Reply message error:", zap.Error(err))
-				}
-				continue
+			t.withRecover(func() {
+				t.processMessage(msg)
+			})
+			// сообщение, переданное в очередь, подтверждается после выполнения запроса
+			if !msg.isQueued {
+				msg.done()
 			}
-			resp := t.processCommand(msg.command, msg.username, msg.chatID)
-			if resp != nil {
-				if err := t.clientStates.ResetClientFusionBrainRequestRows(msg.chatID); err != nil && msg.command != commandStop {
-					if err = t.telegram.ReplyText(msg.messageID, msg.chatID, respBodySessionIsNotExist); err != nil {
-						t.log.Error("Reply message error:", zap.Error(err))
-					}
-					continue
-				}
-				switch {
-				case resp.text != "":
-					if err := t.telegram.ReplyText(msg.messageID, msg.chatID, resp.text); err != nil {
-						t.log.Error("Reply message error:", zap.Error(err))
-					}
-					continue
-				case resp.fileBody != nil:
-					if err := t.telegram.ReplyFile(msg.messageID, msg.chatID, resp.fileBody, resp.fileName); err != nil {
-						t.log.Error("Reply message error:", zap.Error(err))
-					}
-					continue
-				}
-			}
-			if msg.text == "" {
-				continue
-			}
-			var (
-				command string
-				err     error
-			)
-			command, err = t.clientStates.ClientCommand(msg.chatID)
-			if err != nil {
-				t.log.Error("Get client command err:", zap.Error(err))
-				if err = t.telegram.ReplyText(msg.messageID, msg.chatID, respBodySessionIsNotExist); err != nil {
-					t.log.Error("Reply message error:", zap.Error(err))
-				}
-				continue
+		}
+	}
+}
+
+func (t *TBotOpenAI) processMessage(msg *message) {
+	t.log.Debug("Received message",
+		zap.String("user", msg.username),
+		zap.String("body", msg.text),
+		zap.String("command", msg.command))
+	t.rememberClientLanguage(msg)
+	l := t.localizer(msg.userID)
+	if msg.isStale {
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodyStaleMessage)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	if msg.inlineQueryID != "" {
+		t.processInlineQuery(msg)
+		return
+	}
+	msg.command = t.canonicalCommand(msg.command)
+	t.rememberMenuSession(msg)
+	if t.isBanned(msg.username) {
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodyAccessDenied)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	if msg.isEdited {
+		t.processEditedMessage(msg)
+		return
+	}
+	if msg.callbackID != "" && msg.command == callbackRerun {
+		t.processRerunCallback(msg)
+		return
+	}
+	respBody := t.checkChanMessagesBuffer()
+	if respBody != "" {
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBody)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	if respBody = t.checkGroupCommand(msg); respBody != "" {
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBody)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	// текст из кнопки с командой сразу выполняется этой командой, без ответа-подсказки;
+	// команда сессии клиента при этом не меняется
+	if msg.callbackID != "" && msg.text != "" {
+		if !t.checkPermissions(msg.command, msg.username) {
+			if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodyUndefinedCommand)); err != nil {
+				t.log.Error("Reply message error:", zap.Error(err))
 			}
-			text, isReady := t.processPrepareFusionBrainRequest(msg.text, command, msg.chatID)
-			if !isReady {
-				if err = t.telegram.ReplyText(msg.messageID, msg.chatID, text); err != nil {
-					t.log.Error("Reply message error:", zap.Error(err))
-				}
-				continue
+			return
+		}
+		msg.taskCommand = msg.command
+	} else if resp := t.processCommand(msg.command, msg.username, msg.session()); resp != nil {
+		if err := t.clientStates.ResetClientFusionBrainRequestRows(msg.session()); err != nil && msg.command != commandStop {
+			if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodySessionIsNotExist)); err != nil {
+				t.log.Error("Reply message error:", zap.Error(err))
 			}
-			if text != "" {
-				msg.text = text
+			return
+		}
+		switch {
+		case len(resp.keyboard) > 0:
+			if err := t.telegram.ReplyKeyboard(msg.messageID, msg.chatID, resp.text, resp.keyboard); err != nil {
+				t.log.Error("Reply message error:", zap.Error(err))
 			}
-			if err = t.clientStates.ResetClientFusionBrainRequestRows(msg.chatID); err != nil {
-				if err = t.telegram.ReplyText(msg.messageID, msg.chatID, respBodySessionIsNotExist); err != nil {
-					t.log.Error("Reply message error:", zap.Error(err))
-				}
-				continue
+			return
+		case resp.fileBody != nil:
+			if err := t.telegram.ReplyFile(msg.messageID, msg.chatID, resp.fileBody, resp.fileName); err != nil {
+				t.log.Error("Reply message error:", zap.Error(err))
 			}
-			respBody = t.checkJobsLimit(command, msg.chatID)
-			if respBody != "" {
-				if err = t.telegram.ReplyText(msg.messageID, msg.chatID, respBody); err != nil {
-					t.log.Error("Reply message error:", zap.Error(err))
-				}
-				continue
+			if resp.text == "" {
+				return
 			}
-			if err = t.telegram.ReplyText(msg.messageID, msg.chatID, respBodyRequestAddedToQueue); err != nil {
+			if err := t.telegram.ReplyText(msg.messageID, msg.chatID, resp.text); err != nil {
 				t.log.Error("Reply message error:", zap.Error(err))
 			}
-			t.queueTaskChan <- msg
-			val, ok := t.respBodiesAfterTask.Load(command)
-			if !ok {
-				continue
-			}
-			respBody, ok = val.(string)
-			if !ok {
-				continue
+			return
+		case resp.text != "":
+			if err := t.telegram.ReplyText(msg.messageID, msg.chatID, resp.text); err != nil {
+				t.log.Error("Reply message error:", zap.Error(err))
 			}
-			if err = t.telegram.ReplyText(msg.messageID, msg.chatID, respBody); err != nil {
-				t.log.Error("Reply to client err:", zap.Error(err))
+			return
+		}
+	}
+	if msg.voice != nil {
+		t.processVoiceMessage(msg)
+		return
+	}
+	if msg.document != nil {
+		t.processDocumentMessage(msg)
+		return
+	}
+	if msg.photo != nil {
+		if respBody = t.checkPhotoMessage(msg); respBody != "" {
+			if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBody)); err != nil {
+				t.log.Error("Reply message error:", zap.Error(err))
 			}
+			return
 		}
 	}
-}
-
-func (t *TBotOpenAI) checkJobsLimit(command string, chatID int64) string {
-	switch command {
-	case commandChatGPT:
-		if body := t.checkClientChatGPTJobs(chatID); body != "" {
-			return body
+	if msg.text == "" {
+		return
+	}
+	var (
+		command string
+		err     error
+	)
+	command, err = t.taskCommandOf(msg)
+	if err != nil {
+		t.log.Error("Get client command err:", zap.Error(err))
+		if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodySessionIsNotExist)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	// команда темы форума может быть недоступна клиенту по ролям
+	if command != "" && !t.checkPermissions(command, msg.username) {
+		if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodyAccessDenied)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	// ответ на сгенерированное изображение выполняется командой этого изображения
+	if refinedCommand, prompt, ok := t.refineImageRequest(msg); ok {
+		command, msg.text, msg.taskCommand = refinedCommand, prompt, refinedCommand
+	}
+	text, kb, isReady := "", keyboard(nil), true
+	if msg.taskCommand == "" {
+		text, kb, isReady = t.processPrepareFusionBrainRequest(msg.text, command, msg.session())
+	}
+	if !isReady {
+		if len(kb) > 0 {
+			err = t.telegram.ReplyKeyboard(msg.messageID, msg.chatID, l.text(text), kb)
+		} else {
+			err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(text))
 		}
-	case commandOpenAIText, commandOpenAIImage:
-		if body := t.checkClientOpenAIJobs(chatID); body != "" {
-			return body
+		if err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
 		}
-	case commandDreamBooth:
-		if body := t.checkClientDreamBoothJobs(chatID); body != "" {
-			return body
+		return
+	}
+	if text != "" {
+		msg.text = text
+	}
+	if err = t.clientStates.ResetClientFusionBrainRequestRows(msg.session()); err != nil {
+		if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodySessionIsNotExist)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	respBody = t.checkJobsLimit(command, msg.session())
+	if respBody != "" {
+		if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBody)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
 		}
+		return
+	}
+	// запрос FusionBrain, собранный из нескольких сообщений, нельзя повторить редактированием одного из них
+	if text == "" {
+		t.trackEditableJob(msg, command)
+	}
+	// команда фиксируется при постановке в очередь: в теме форума она может отличаться от команды клиента
+	msg.taskCommand = command
+	t.enqueueProgress(msg, command)
+	t.enqueueTask(msg)
+	val, ok := t.respBodiesAfterTask.Load(command)
+	if !ok {
+		return
+	}
+	respBody, ok = val.(string)
+	if !ok {
+		return
+	}
+	if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBody)); err != nil {
+		t.log.Error("Reply to client err:", zap.Error(err))
+	}
+}
+
+// checkJobsLimit - лимит одновременных запросов клиента к провайдеру команды, max_jobs 0 - без ограничения
+func (t *TBotOpenAI) checkJobsLimit(command string, key sessionKey) string {
+	p, ok := t.providers.get(command)
+	if !ok || p.cfg.MaxJobs <= 0 {
+		return ""
+	}
+	jobs, err := t.clientStates.ClientLenJobs(key, command)
+	if err != nil {
+		t.log.Error("Get client jobs err:", zap.Error(err))
+		return respBodySessionIsNotExist
+	}
+	if jobs >= p.cfg.MaxJobs {
+		return respErrBodyLimitJobs
 	}
 	return ""
 }
@@ -262,11 +473,6 @@ func (t *TBotOpenAI) initQueueTaskWorkers(wg *sync.WaitGroup) {
 	wg.Add(t.cfg.QueueMessageWorkers)
 	for i := 0; i < t.cfg.QueueMessageWorkers; i++ {
 		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					t.log.Error("Recovered panic err:", zap.Any("panic", r))
-				}
-			}()
 			defer wg.Done()
 			for {
 				select {
@@ -274,60 +480,259 @@ func (t *TBotOpenAI) initQueueTaskWorkers(wg *sync.WaitGroup) {
 					if !ok {
 						return
 					}
-					t.processQueueTask(msg.text, msg.messageID, msg.chatID)
+					t.withRecover(func() {
+						switch {
+						case msg.voice != nil:
+							t.processSpeechToText(msg)
+						case msg.document != nil:
+							t.processDocumentUpload(msg)
+						default:
+							t.processQueueTask(msg)
+						}
+					})
+					msg.done()
 				}
 			}
 		}()
 	}
 }
 
-func (t *TBotOpenAI) processQueueTask(text string, messageID int, chatID int64) {
+// enqueueTask - сообщение передается в очередь запросов, после чего им владеет обработчик очереди.
+// Сообщение из обработчика очереди выполняется в нем же: при заполненной очереди отправка в нее
+// из всех обработчиков остановила бы очередь
+func (t *TBotOpenAI) enqueueTask(msg *message) {
+	if msg.isInQueue {
+		t.processQueueTask(msg)
+		return
+	}
+	msg.isQueued = true
+	t.queueTaskChan <- msg
+}
+
+func (t *TBotOpenAI) processQueueTask(msg *message) {
+	// запрос отредактирован, пока ждал в очереди, и уже поставлен в нее заново
+	if msg.job.isCanceled() {
+		return
+	}
 	var err error
-	body, fileName := t.processTask(text, chatID)
-	if fileName != "" {
-		err = t.telegram.ReplyFile(messageID, chatID, body, fileName)
-	} else {
-		err = t.telegram.ReplyText(messageID, chatID, string(body))
+	t.startProgress(msg.progress)
+	defer t.finishProgress(msg.progress)
+	resp := t.processTask(msg)
+	if !msg.job.finish() {
+		if resp.editMessageID != 0 {
+			err = t.telegram.EditText(resp.editMessageID, msg.chatID, t.localizer(msg.userID).text(respBodyJobRestarted))
+		}
+		if err != nil {
+			t.log.Error("Edit message with response err:", zap.Error(err))
+		}
+		return
+	}
+	switch {
+	case len(resp.files) > 0:
+		err = t.replyImages(msg, resp.files, resp.caption)
+	case resp.editMessageID != 0:
+		err = t.editLongText(msg, resp.editMessageID, string(resp.body), resp.isMarkdown)
+	default:
+		err = t.replyLongText(msg, string(resp.body), resp.isMarkdown)
 	}
 	if err != nil {
 		t.log.Error("Reply to client err:", zap.Error(err))
 	}
 }
 
-func (t *TBotOpenAI) checkClientChatGPTJobs(chatID int64) string {
-	jobs, err := t.clientStates.ClientLenChatGPTJobs(chatID)
+// replyImages - отправляет изображения в формате, выбранном клиентом: фото (альбомом, если их несколько),
+// документами или и тем, и другим
+func (t *TBotOpenAI) replyImages(msg *message, files []imageFile, caption string) error {
+	format, err := t.clientStates.ClientImageFormat(msg.session())
 	if err != nil {
-		t.log.Error("Get ChatGPT jobs err:", zap.Error(err))
-		return respBodySessionIsNotExist
+		t.log.Error("Get client image format err:", zap.Error(err))
+		format = imageFormatPhoto
 	}
-	if jobs >= t.cfg.MaxClientOpenAIJobs {
-		return respErrBodyLimitJobs
+	messageID, chatID := msg.messageID, msg.chatID
+	caption = truncateText(caption, maxLenCaption)
+	if format == imageFormatPhoto || format == imageFormatBoth {
+		if err = t.replyPhotos(messageID, chatID, files, caption); err == nil && format == imageFormatPhoto {
+			return nil
+		}
+		if err != nil {
+			t.log.Error("Reply photos err, sending documents:", zap.Error(err))
+		}
 	}
-	return ""
+	for idx := range files {
+		if err = t.telegram.ReplyFile(messageID, chatID, files[idx].body, files[idx].fileName); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (t *TBotOpenAI) checkClientDreamBoothJobs(chatID int64) string {
-	jobs, err := t.clientStates.ClientLenDreamBoothJobs(chatID)
+func (t *TBotOpenAI) replyPhotos(messageID int, chatID int64, files []imageFile, caption string) error {
+	if len(files) == 1 {
+		return t.telegram.ReplyPhoto(messageID, chatID, files[0].body, files[0].fileName, caption)
+	}
+	for len(files) > 0 {
+		n := maxLenMediaGroup
+		if len(files) < n {
+			n = len(files)
+		}
+		if err := t.telegram.ReplyMediaGroup(messageID, chatID, files[:n], caption); err != nil {
+			return err
+		}
+		files = files[n:]
+	}
+	return nil
+}
+
+// replyLongText - отправляет текст несколькими сообщениями, если он не помещается в одно,
+// или файлом, если он длиннее max_len_text_reply
+func (t *TBotOpenAI) replyLongText(msg *message, body string, isMarkdown bool) error {
+	if t.cfg.MaxLenTextReply > 0 && lenUTF16(body) > t.cfg.MaxLenTextReply {
+		fileName := t.localizer(msg.userID).text(respFileNameAnswer)
+		return t.telegram.ReplyFile(msg.messageID, msg.chatID, []byte(body), fileName)
+	}
+	for _, part := range splitReply(body, isMarkdown) {
+		if err := t.replyTextPart(msg.messageID, msg.chatID, part, isMarkdown); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editLongText - заменяет текст сообщения бота ответом; не поместившиеся части отправляются отдельно
+func (t *TBotOpenAI) editLongText(msg *message, editMessageID int, body string, isMarkdown bool) error {
+	if t.cfg.MaxLenTextReply > 0 && lenUTF16(body) > t.cfg.MaxLenTextReply {
+		l := t.localizer(msg.userID)
+		if err := t.telegram.EditText(editMessageID, msg.chatID, l.text(respBodyAnswerSentAsFile)); err != nil {
+			t.log.Error("Edit message with response err:", zap.Error(err))
+		}
+		return t.telegram.ReplyFile(msg.messageID, msg.chatID, []byte(body), l.text(respFileNameAnswer))
+	}
+	parts := splitReply(body, isMarkdown)
+	if err := t.editTextPart(editMessageID, msg.chatID, parts[0], isMarkdown); err != nil {
+		t.log.Error("Edit message with response err:", zap.Error(err))
+		return t.replyLongText(msg, body, isMarkdown)
+	}
+	for _, part := range parts[1:] {
+		if err := t.replyTextPart(msg.messageID, msg.chatID, part, isMarkdown); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitReply - части ответа не длиннее лимита Telegram, для Markdown - после преобразования в HTML
+func splitReply(body string, isMarkdown bool) []string {
+	if isMarkdown {
+		return splitMarkdown(body, maxLenMessage)
+	}
+	return splitText(body, maxLenMessage)
+}
+
+// replyTextPart - отправляет Markdown в разметке Telegram, а если сообщение с разметкой
+// не отправлено по любой причине - обычным текстом
+func (t *TBotOpenAI) replyTextPart(messageID int, chatID int64, part string, isMarkdown bool) error {
+	if !isMarkdown {
+		return t.telegram.ReplyText(messageID, chatID, part)
+	}
+	err := t.telegram.ReplyHTML(messageID, chatID, tgmarkdown.ToHTML(part))
+	if err == nil {
+		return nil
+	}
+	t.log.Warn("Reply formatted message err, sending plain text:", zap.Error(err))
+	return t.telegram.ReplyText(messageID, chatID, part)
+}
+
+func (t *TBotOpenAI) editTextPart(editMessageID int, chatID int64, part string, isMarkdown bool) error {
+	if !isMarkdown {
+		return t.telegram.EditText(editMessageID, chatID, part)
+	}
+	err := t.telegram.EditHTML(editMessageID, chatID, tgmarkdown.ToHTML(part))
+	if err == nil {
+		return nil
+	}
+	t.log.Warn("Edit formatted message err, sending plain text:", zap.Error(err))
+	return t.telegram.EditText(editMessageID, chatID, part)
+}
+
+// processVoiceMessage - голосовое сообщение ставится в очередь на распознавание,
+// распознанный текст затем обрабатывается текущей командой клиента, как обычное сообщение
+func (t *TBotOpenAI) processVoiceMessage(msg *message) {
+	respBody := ""
+	if t.speechToText == nil {
+		respBody = respErrBodyVoiceIsNotSupported
+	} else if _, err := t.clientStates.ClientCommand(msg.session()); err != nil {
+		respBody = respBodySessionIsNotExist
+	}
+	if respBody != "" {
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, t.localizer(msg.userID).text(respBody)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	t.enqueueTask(msg)
+}
+
+// checkPhotoMessage - фото принимают только команды, модели которых работают с изображениями,
+// подпись к фото используется как запрос
+func (t *TBotOpenAI) checkPhotoMessage(msg *message) string {
+	command, err := t.taskCommandOf(msg)
 	if err != nil {
-		t.log.Error("Get DreamBooth jobs err:", zap.Error(err))
 		return respBodySessionIsNotExist
 	}
-	if jobs >= t.cfg.MaxClientDreamBoothJobs {
-		return respErrBodyLimitJobs
+	if p, ok := t.providers.get(command); !ok || !p.supportsPhoto() {
+		return respErrBodyPhotoIsNotSupported
+	}
+	if msg.text == "" {
+		return respErrBodyPhotoCaptionIsEmpty
 	}
 	return ""
 }
 
-func (t *TBotOpenAI) checkClientOpenAIJobs(chatID int64) string {
-	jobs, err := t.clientStates.ClientLenOpenAIJobs(chatID)
+// newAIRequest - запрос к AI из сообщения клиента; приложенное фото скачивается
+func (t *TBotOpenAI) newAIRequest(msg *message) (*aiRequest, error) {
+	req := &aiRequest{prompt: msg.text}
+	if msg.photo == nil {
+		return req, nil
+	}
+	body, err := t.telegram.DownloadFile(msg.photo.fileID)
 	if err != nil {
-		t.log.Error("Get OpenAI jobs err:", zap.Error(err))
-		return respBodySessionIsNotExist
+		return nil, err
 	}
-	if jobs >= t.cfg.MaxClientOpenAIJobs {
-		return respErrBodyLimitJobs
+	req.images = append(req.images, imageFile{body: body, fileName: msg.photo.fileName})
+	return req, nil
+}
+
+func (t *TBotOpenAI) processSpeechToText(msg *message) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.SpeechToText.Timeout)
+	defer cancel()
+	l := t.localizer(msg.userID)
+	text, err := t.transcribe(ctx, msg.voice)
+	if err != nil {
+		t.log.Error("Speech to text err:", zap.Error(err))
+		if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respErrBodySpeechToText)); err != nil {
+			t.log.Error("Reply to client err:", zap.Error(err))
+		}
+		return
 	}
-	return ""
+	if err = t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodyTranscript, "text", text)); err != nil {
+		t.log.Error("Reply to client err:", zap.Error(err))
+	}
+	t.processMessage(msg.followUp(text))
+}
+
+func (t *TBotOpenAI) transcribe(ctx context.Context, voice *attachment) (string, error) {
+	audio, err := t.telegram.DownloadFile(voice.fileID)
+	if err != nil {
+		return "", err
+	}
+	text, err := t.speechToText.Transcribe(ctx, audio, voice.fileName)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", errEmptyTranscript
+	}
+	return text, nil
 }
 
 func (t *TBotOpenAI) checkChanMessagesBuffer() string {
@@ -386,21 +791,24 @@ func (t *TBotOpenAI) writeBlacklistToFile() error {
 	return err
 }
 
-func (t *TBotOpenAI) processPrepareFusionBrainRequest(text, command string, chatID int64) (string, bool) {
-	if command != commandFusionBrain {
-		return "", true
+func (t *TBotOpenAI) processPrepareFusionBrainRequest(text, command string, key sessionKey) (string, keyboard, bool) {
+	if p, ok := t.providers.get(command); !ok || p.cfg.Type != providerTypeFusionBrain {
+		return "", nil, true
 	}
-	if err := t.clientStates.AppendToClientFusionBrainRequestRows(text, chatID); err != nil {
+	if err := t.clientStates.AppendToClientFusionBrainRequestRows(text, key); err != nil {
 		t.log.Error("Append to client's FusionBrain request's rows err:", zap.Error(err))
-		return respBodySessionIsNotExist, false
+		return respBodySessionIsNotExist, nil, false
 	}
-	rows, err := t.clientStates.ClientFusionBrainRequestRows(chatID)
+	rows, err := t.clientStates.ClientFusionBrainRequestRows(key)
 	if err != nil {
 		t.log.Error("Get client's FusionBrain request's rows err:", zap.Error(err))
-		return respBodySessionIsNotExist, false
+		return respBodySessionIsNotExist, nil, false
+	}
+	if len(rows) == fusionBrainStyleField {
+		return respBodyFusionBrainInput[len(rows)], keyboardFusionBrainStyles(), false
 	}
 	if len(rows) < countRequestFields {
-		return respBodyFusionBrainInput[len(rows)], false
+		return respBodyFusionBrainInput[len(rows)], nil, false
 	}
-	return strings.Join(rows, "\n"), true
+	return strings.Join(rows, "\n"), nil, true
 }
@@ -0,0 +1,75 @@
+package tbotopenai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTBotOpenAI_ProcessMessage_CallbackInput(t *testing.T) {
+	const (
+		userID   = 1
+		username = "user"
+	)
+	locales, err := loadLocales(&LocaleSettings{}, zap.NewNop())
+	assert.NoError(t, err)
+	tests := []struct {
+		name           string
+		msg            *message
+		userCommands   []string
+		expTaskCommand string
+	}{
+		{
+			name:           "Cancel button of the job list",
+			msg:            &message{command: commandCancelJob, text: "5"},
+			userCommands:   []string{anyUser},
+			expTaskCommand: commandCancelJob,
+		},
+		{
+			name:           "Image format button",
+			msg:            &message{command: commandImageFormat, text: imageFormatDocument},
+			userCommands:   []string{anyUser},
+			expTaskCommand: commandImageFormat,
+		},
+		{
+			name:         "Button of a command that is not allowed",
+			msg:          &message{command: commandCancelJob, text: "5"},
+			userCommands: []string{commandChatGPT},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &testMessenger{}
+			bot := &TBotOpenAI{
+				cfg:           &Config{LenMessageChan: 1},
+				telegram:      m,
+				locales:       locales,
+				log:           zap.NewNop(),
+				clientStates:  clientStateBySession{value: make(map[sessionKey]*clientState)},
+				providers:     &providerRegistry{byCommand: map[string]*provider{commandChatGPT: {}}},
+				queueTaskChan: make(chan *message, 1),
+			}
+			bot.setUserRoles(&RolesSettings{Users: []string{username}})
+			bot.setPermissions(&PermissionSettings{UserCommands: tt.userCommands})
+			msg := tt.msg
+			msg.chatID, msg.userID, msg.username, msg.callbackID = userID, userID, username, "callback"
+			key := msg.session()
+			bot.menuSessions.Store(key, menuSession{username: username})
+			assert.NoError(t, bot.clientStates.AddClient(key, username))
+			assert.NoError(t, bot.clientStates.UpdateClientCommand(key, commandChatGPT))
+			bot.processMessage(msg)
+			command, err := bot.clientStates.ClientCommand(key)
+			assert.NoError(t, err)
+			assert.Equal(t, commandChatGPT, command)
+			if tt.expTaskCommand == "" {
+				assert.Len(t, bot.queueTaskChan, 0)
+				assert.Equal(t, []string{bot.localizer(userID).text(respBodyUndefinedCommand)}, m.replies)
+				return
+			}
+			if assert.Len(t, bot.queueTaskChan, 1) {
+				assert.Equal(t, tt.expTaskCommand, (<-bot.queueTaskChan).taskCommand)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package tbotopenai
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// groupServiceCommands - команды, которые нельзя выключить в группе
+var groupServiceCommands = map[string]struct{}{
+	commandStart:         {},
+	commandStop:          {},
+	commandHelp:          {},
+	commandGroupCommands: {},
+	commandLanguage:      {},
+	commandTopicCommand:  {},
+	commandReset:         {},
+	commandPersona:       {},
+	commandModel:         {},
+}
+
+// isGroupCommandEnabled - в личном чате доступны все команды, в группе - выбранные ее администраторами
+func (t *TBotOpenAI) isGroupCommandEnabled(key sessionKey, command string) bool {
+	if !key.isGroup() {
+		return true
+	}
+	if _, ok := groupServiceCommands[command]; ok {
+		return true
+	}
+	_, ok := t.groupEnabledCommands(key.chatID)[command]
+	return ok
+}
+
+func (t *TBotOpenAI) groupEnabledCommands(chatID int64) map[string]struct{} {
+	if val, ok := t.groupCommands.Load(chatID); ok {
+		if commands, ok := val.(map[string]struct{}); ok {
+			return commands
+		}
+	}
+	defaultCommands := t.cfg.Groups.DefaultCommands
+	if len(defaultCommands) == 0 {
+		defaultCommands = t.commandNames()
+	}
+	commands := make(map[string]struct{}, len(defaultCommands))
+	for _, command := range defaultCommands {
+		commands[command] = struct{}{}
+	}
+	return commands
+}
+
+// checkGroupCommand - проверяет, что команда сообщения или текущая команда клиента включена в группе
+func (t *TBotOpenAI) checkGroupCommand(msg *message) string {
+	key := msg.session()
+	if !key.isGroup() {
+		return ""
+	}
+	command := msg.command
+	if command == "" {
+		var err error
+		if command, err = t.taskCommandOf(msg); err != nil {
+			return ""
+		}
+	}
+	if !t.isGroupCommandEnabled(key, command) {
+		return respErrBodyCommandDisabledInGroup
+	}
+	return ""
+}
+
+func (t *TBotOpenAI) checkGroupAdmin(key sessionKey) string {
+	if !key.isGroup() {
+		return respErrBodyGroupOnly
+	}
+	isAdmin, err := t.telegram.IsChatAdmin(key.chatID, key.userID)
+	if err != nil {
+		t.log.Error("Get chat member err:", zap.Error(err))
+		return respErrBodyGroupAdminOnly
+	}
+	if !isAdmin {
+		return respErrBodyGroupAdminOnly
+	}
+	return ""
+}
+
+func (t *TBotOpenAI) commandGroupCommands(command, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if respBody := t.checkGroupAdmin(key); respBody != "" {
+		return &commandResponse{
+			text: l.text(respBody),
+		}
+	}
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
+		t.log.Error("Update client command err:", zap.Error(err))
+		return &commandResponse{
+			text: l.text(respBodySessionIsNotExist),
+		}
+	}
+	return &commandResponse{
+		text:     l.text(respBodyCommandGroupCommands),
+		keyboard: keyboardGroupCommands(t.groupEnabledCommands(key.chatID), t.commandNames()),
+	}
+}
+
+func (t *TBotOpenAI) processGroupCommands(msg *message) *taskResponse {
+	key := msg.session()
+	l := t.localizer(msg.userID)
+	if respBody := t.checkGroupAdmin(key); respBody != "" {
+		return &taskResponse{body: l.bytes(respBody)}
+	}
+	command := strings.TrimPrefix(strings.TrimSpace(msg.text), "/")
+	if !t.isGroupSwitchableCommand(command) {
+		return &taskResponse{body: l.bytes(respErrBodyInvalidGroupCommand)}
+	}
+	current := t.groupEnabledCommands(key.chatID)
+	commands := make(map[string]struct{}, len(current)+1)
+	for c := range current {
+		commands[c] = struct{}{}
+	}
+	_, isEnabled := commands[command]
+	if isEnabled {
+		delete(commands, command)
+	} else {
+		commands[command] = struct{}{}
+	}
+	t.groupCommands.Store(key.chatID, commands)
+	if err := t.writeGroupCommandsToFile(); err != nil {
+		return &taskResponse{body: l.bytes(respErrBodyGroupCommands)}
+	}
+	t.refreshChatCommandMenus(key.chatID)
+	return &taskResponse{body: respBodyGroupCommandChanged(l, command, !isEnabled)}
+}
+
+func (t *TBotOpenAI) isGroupSwitchableCommand(command string) bool {
+	return isGroupSwitchable(command, t.commandNames())
+}
+
+func isGroupSwitchable(command string, names []string) bool {
+	if _, ok := groupServiceCommands[command]; ok {
+		return false
+	}
+	for _, c := range names {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// storeGroupCommands - файл хранит строки вида "<chatID>:<command>,<command>"
+func (t *TBotOpenAI) storeGroupCommands() error {
+	if t.cfg.Groups.PathCommands == "" {
+		return nil
+	}
+	body, err := os.ReadFile(t.cfg.Groups.PathCommands)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.log.Error("Read group commands file err", zap.Error(err))
+		return err
+	}
+	rows := strings.Split(strings.ReplaceAll(string(body), "\r", ""), "\n")
+	for _, row := range rows {
+		strChatID, strCommands, found := strings.Cut(row, ":")
+		if !found {
+			continue
+		}
+		chatID, err := strconv.ParseInt(strChatID, 10, 64)
+		if err != nil {
+			t.log.Error("Parse group commands file err", zap.Error(err))
+			continue
+		}
+		commands := make(map[string]struct{})
+		for _, command := range strings.Split(strCommands, ",") {
+			if command != "" {
+				commands[command] = struct{}{}
+			}
+		}
+		t.groupCommands.Store(chatID, commands)
+	}
+	return nil
+}
+
+func (t *TBotOpenAI) writeGroupCommandsToFile() error {
+	if t.cfg.Groups.PathCommands == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	t.groupCommands.Range(func(k, v any) bool {
+		chatID, ok := k.(int64)
+		if !ok {
+			return false
+		}
+		commands, ok := v.(map[string]struct{})
+		if !ok {
+			return false
+		}
+		names := make([]string, 0, len(commands))
+		for command := range commands {
+			names = append(names, command)
+		}
+		b.WriteString(strconv.FormatInt(chatID, 10) + ":" + strings.Join(names, ",") + "\n")
+		return true
+	})
+	err := os.WriteFile(t.cfg.Groups.PathCommands, b.Bytes(), 0644)
+	if err != nil {
+		t.log.Error("Write group commands file err", zap.Error(err))
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package tbotopenai
+
+import (
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// История диалога сессии: запросы и ответы текстовых моделей отправляются с каждым новым запросом,
+// старые вытесняются, когда история не укладывается в бюджет history.max_tokens. Ответ на сообщение
+// бота продолжает свою цепочку, поэтому история сессии к нему не добавляется.
+
+const (
+	defaultHistoryMaxTokens = 2000
+	// charsPerToken - оценка длины токена в символах: токенизатор модели боту неизвестен
+	charsPerToken = 3
+)
+
+const (
+	chatRoleSystem    = "system"
+	chatRoleUser      = "user"
+	chatRoleAssistant = "assistant"
+)
+
+// chatMessage - предыдущее сообщение диалога с моделью
+type chatMessage struct {
+	role    string
+	content string
+}
+
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/charsPerToken + 1
+}
+
+// trimHistory - сообщения вытесняются парами запрос-ответ, начиная с самых старых
+func trimHistory(history []chatMessage, maxTokens int) []chatMessage {
+	tokens := 0
+	for idx := range history {
+		tokens += estimateTokens(history[idx].content)
+	}
+	for len(history) > 0 && tokens > maxTokens {
+		n := 2
+		if len(history) < n {
+			n = len(history)
+		}
+		for idx := range history[:n] {
+			tokens -= estimateTokens(history[idx].content)
+		}
+		history = history[n:]
+	}
+	return history
+}
+
+func (t *TBotOpenAI) historyMaxTokens() int {
+	if t.cfg.History.MaxTokens <= 0 {
+		return defaultHistoryMaxTokens
+	}
+	return t.cfg.History.MaxTokens
+}
+
+// attachHistory - к текстовому запросу добавляется история сессии
+func (t *TBotOpenAI) attachHistory(msg *message, req *aiRequest) {
+	if !t.cfg.History.Enabled || msg.replyTo != nil {
+		return
+	}
+	history, err := t.clientStates.ClientHistory(msg.session())
+	if err != nil {
+		t.log.Error("Get client history err:", zap.Error(err))
+		return
+	}
+	req.history = history
+}
+
+// rememberHistory - запрос клиента без контекста документа и ответ модели сохраняются в истории сессии
+func (t *TBotOpenAI) rememberHistory(msg *message, answer []byte) {
+	if !t.cfg.History.Enabled || msg.replyTo != nil || msg.text == documentSummaryQuery {
+		return
+	}
+	err := t.clientStates.AppendClientHistory(msg.session(), msg.text, string(answer), t.historyMaxTokens())
+	if err != nil {
+		t.log.Error("Append client history err:", zap.Error(err))
+	}
+}
+
+func (t *TBotOpenAI) commandReset(_, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.ResetClientHistory(key); err != nil {
+		t.log.Error("Reset client history err:", zap.Error(err))
+		return &commandResponse{
+			text: l.text(respBodySessionIsNotExist),
+		}
+	}
+	return &commandResponse{
+		text: l.text(respBodyHistoryReset),
+	}
+}
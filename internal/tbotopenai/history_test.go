@@ -0,0 +1,53 @@
+package tbotopenai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrimHistory(t *testing.T) {
+	// сообщение из 3 символов - 2 токена по оценке estimateTokens
+	history := []chatMessage{
+		{role: chatRoleUser, content: "q1a"},
+		{role: chatRoleAssistant, content: "a1a"},
+		{role: chatRoleUser, content: "q2a"},
+		{role: chatRoleAssistant, content: "a2a"},
+	}
+	tests := []struct {
+		name       string
+		history    []chatMessage
+		maxTokens  int
+		expHistory []chatMessage
+	}{
+		{
+			name:       "History fits the budget",
+			history:    history,
+			maxTokens:  8,
+			expHistory: history,
+		},
+		{
+			name:       "Oldest pair is removed",
+			history:    history,
+			maxTokens:  7,
+			expHistory: history[2:],
+		},
+		{
+			name:       "Odd message is removed last",
+			history:    history[:3],
+			maxTokens:  1,
+			expHistory: []chatMessage{},
+		},
+		{
+			name:       "Empty history",
+			history:    nil,
+			maxTokens:  0,
+			expHistory: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expHistory, trimHistory(tt.history, tt.maxTokens))
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package tbotopenai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInlineDebounce = 800 * time.Millisecond
+	// maxInlineTimeout - время от получения inline-запроса до ответа вместе с debounce: Telegram ждет ответ
+	// около 10 секунд, остальное время нужно на загрузку изображения и сам ответ
+	maxInlineTimeout = 8 * time.Second
+	// inlineImagePrefix - запрос "@bot img <описание>" генерирует изображение, остальные - текстовый ответ
+	inlineImagePrefix = "img "
+	// inlineSwitchPMParameter - параметр /start кнопки перехода в личный чат с ботом
+	inlineSwitchPMParameter = "inline"
+)
+
+// inlineJob - последний inline-запрос пользователя; новый запрос отменяет предыдущий
+type inlineJob struct {
+	queryID string
+	cancel  context.CancelFunc
+}
+
+type inlineJobByUserID struct {
+	value map[int64]*inlineJob
+	mutex sync.Mutex
+}
+
+// replace - отменяет предыдущий запрос пользователя и запоминает новый
+func (i *inlineJobByUserID) replace(userID int64, job *inlineJob) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if prev, ok := i.value[userID]; ok {
+		prev.cancel()
+	}
+	i.value[userID] = job
+}
+
+func (i *inlineJobByUserID) done(userID int64, queryID string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if job, ok := i.value[userID]; ok && job.queryID == queryID {
+		job.cancel()
+		delete(i.value, userID)
+	}
+}
+
+// processInlineQuery - запрос выполняется, только если за время debounce пользователь не изменил его текст
+func (t *TBotOpenAI) processInlineQuery(msg *message) {
+	if !t.cfg.Inline.Enabled || msg.text == "" {
+		return
+	}
+	command, prompt := t.cfg.Inline.TextCommand, msg.text
+	if command == "" {
+		command = commandChatGPT
+	}
+	if text, ok := strings.CutPrefix(msg.text, inlineImagePrefix); ok {
+		command, prompt = t.cfg.Inline.ImageCommand, strings.TrimSpace(text)
+		if command == "" {
+			command = commandOpenAIImage
+		}
+	}
+	p, ok := t.providers.get(command)
+	if !ok {
+		return
+	}
+	if t.isBanned(msg.username) || !t.checkPermissions(command, msg.username) {
+		respBody := t.localizer(msg.userID).text(respBodyAccessDenied)
+		t.answerInlineQuery(msg.inlineQueryID, []inlineResult{{title: respBody, text: respBody}}, "")
+		return
+	}
+	if prompt == "" {
+		return
+	}
+	timeout := t.cfg.Inline.Timeout
+	if timeout <= 0 || timeout > maxInlineTimeout {
+		timeout = maxInlineTimeout
+	}
+	debounce := t.cfg.Inline.Debounce
+	if debounce <= 0 {
+		debounce = defaultInlineDebounce
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	t.inlineJobs.replace(msg.userID, &inlineJob{queryID: msg.inlineQueryID, cancel: cancel})
+	go func() {
+		defer t.inlineJobs.done(msg.userID, msg.inlineQueryID)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(debounce):
+		}
+		// медленный провайдер не успеет ответить, клиенту сразу предлагается перейти в чат с ботом
+		if p.isSlow() {
+			t.answerInlineSwitchPM(msg)
+			return
+		}
+		results, err := t.generateInlineResults(ctx, msg, command, prompt)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			t.log.Warn("Inline query timeout", zap.String("api", p.cfg.Label), zap.Duration("timeout", timeout))
+			t.answerInlineSwitchPM(msg)
+			return
+		}
+		if err != nil {
+			t.log.Error("Inline query err:", zap.Error(err))
+			return
+		}
+		t.writeStats(command, msg.username, prompt, inlineResultsText(results))
+		t.answerInlineQuery(msg.inlineQueryID, results, "")
+	}()
+}
+
+// generateInlineResults - inline-запрос выполняется моделью, выбранной пользователем в личном чате с ботом
+func (t *TBotOpenAI) generateInlineResults(ctx context.Context, msg *message, command, prompt string) ([]inlineResult, error) {
+	key := sessionKey{chatID: msg.userID, userID: msg.userID}
+	p, ok := t.providers.get(command)
+	if !ok {
+		return nil, errProviderCommandIsUnknown
+	}
+	req := &aiRequest{prompt: prompt, model: t.clientModel(key, msg.username, command)}
+	if p.isImage() {
+		files, err := p.ai.GenerateImage(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		l := t.localizer(msg.userID)
+		results := make([]inlineResult, 0, len(files))
+		for idx := range files {
+			results = append(results, inlineResult{
+				title: p.cfg.Label,
+				text:  p.caption(l, prompt),
+				image: &files[idx],
+			})
+		}
+		return results, nil
+	}
+	body, err := p.ai.GenerateText(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return []inlineResult{{title: p.cfg.Label, text: truncateText(string(body), maxLenMessage)}}, nil
+}
+
+func (t *TBotOpenAI) answerInlineQuery(queryID string, results []inlineResult, switchPMText string) {
+	if err := t.telegram.AnswerInlineQuery(queryID, results, switchPMText); err != nil {
+		t.log.Error("Answer inline query err:", zap.Error(err))
+	}
+}
+
+// answerInlineSwitchPM - ответ без результатов с кнопкой перехода в личный чат, где запрос
+// выполняется без ограничения времени inline-запроса
+func (t *TBotOpenAI) answerInlineSwitchPM(msg *message) {
+	t.answerInlineQuery(msg.inlineQueryID, nil, t.localizer(msg.userID).text(respBodyInlineSwitchPM))
+}
+
+func inlineResultsText(results []inlineResult) string {
+	if len(results) == 0 || results[0].image != nil {
+		return ""
+	}
+	return results[0].text
+}
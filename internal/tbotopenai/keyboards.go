@@ -0,0 +1,178 @@
+package tbotopenai
+
+import (
+	"strconv"
+)
+
+// callbackDataSeparator - разделитель команды и текста в данных кнопки: "<command>:<text>".
+// Пустая команда означает, что текст обрабатывается текущей командой клиента.
+const callbackDataSeparator = ":"
+
+// maxLenCallbackData - максимальная длина данных кнопки Telegram в байтах
+const maxLenCallbackData = 64
+
+const (
+	lenHelpKeyboardRow = 3
+	lenJobsKeyboardRow = 2
+)
+
+var imageFormats = []string{imageFormatPhoto, imageFormatDocument, imageFormatBoth}
+
+var fusionBrainStyles = []string{"KANDINSKY", "UHD", "ANIME", "DEFAULT"}
+
+func newCallbackData(command, text string) string {
+	return command + callbackDataSeparator + text
+}
+
+func newKeyboard(buttons []keyboardButton, lenRow int) keyboard {
+	kb := make(keyboard, 0, len(buttons)/lenRow+1)
+	for len(buttons) > 0 {
+		n := lenRow
+		if len(buttons) < n {
+			n = len(buttons)
+		}
+		kb = append(kb, buttons[:n])
+		buttons = buttons[n:]
+	}
+	return kb
+}
+
+func keyboardCommands(commands []string) keyboard {
+	buttons := make([]keyboardButton, 0, len(commands))
+	for _, command := range commands {
+		buttons = append(buttons, keyboardButton{
+			text: "/" + command,
+			data: newCallbackData(command, ""),
+		})
+	}
+	return newKeyboard(buttons, lenHelpKeyboardRow)
+}
+
+func keyboardCancelJobs(jobIDs ...[]int) keyboard {
+	buttons := make([]keyboardButton, 0)
+	for _, ids := range jobIDs {
+		for _, id := range ids {
+			strID := strconv.Itoa(id)
+			buttons = append(buttons, keyboardButton{
+				text: "❌ " + strID,
+				data: newCallbackData(commandCancelJob, strID),
+			})
+		}
+	}
+	return newKeyboard(buttons, lenJobsKeyboardRow)
+}
+
+func keyboardFusionBrainStyles() keyboard {
+	buttons := make([]keyboardButton, 0, len(fusionBrainStyles))
+	for _, style := range fusionBrainStyles {
+		buttons = append(buttons, keyboardButton{
+			text: style,
+			data: newCallbackData("", style),
+		})
+	}
+	return newKeyboard(buttons, lenHelpKeyboardRow)
+}
+
+func keyboardImageFormats() keyboard {
+	buttons := make([]keyboardButton, 0, len(imageFormats))
+	for _, format := range imageFormats {
+		buttons = append(buttons, keyboardButton{
+			text: format,
+			data: newCallbackData(commandImageFormat, format),
+		})
+	}
+	return newKeyboard(buttons, lenHelpKeyboardRow)
+}
+
+func keyboardDocument(l localizer) keyboard {
+	return keyboard{{{
+		text: l.text(respBodyButtonDocumentSummary),
+		data: newCallbackData("", documentSummaryQuery),
+	}}}
+}
+
+func keyboardRerun(l localizer, messageID int) keyboard {
+	return keyboard{{{
+		text: l.text(respBodyButtonRerun),
+		data: newCallbackData(callbackRerun, strconv.Itoa(messageID)),
+	}}}
+}
+
+// keyboardTopicCommands - команды для привязки темы форума и кнопка отвязки
+func keyboardTopicCommands(l localizer, commands []string) keyboard {
+	buttons := make([]keyboardButton, 0, len(commands)+1)
+	for _, command := range commands {
+		buttons = append(buttons, keyboardButton{
+			text: "/" + command,
+			data: newCallbackData(commandTopicCommand, command),
+		})
+	}
+	buttons = append(buttons, keyboardButton{
+		text: l.text(respBodyButtonTopicNone),
+		data: newCallbackData(commandTopicCommand, topicCommandNone),
+	})
+	return newKeyboard(buttons, lenJobsKeyboardRow)
+}
+
+// keyboardPersonas - пресеты персон и кнопка отключения персоны
+func keyboardPersonas(l localizer, personas []PersonaSettings) keyboard {
+	buttons := make([]keyboardButton, 0, len(personas)+1)
+	for idx := range personas {
+		buttons = append(buttons, keyboardButton{
+			text: personas[idx].Name,
+			data: newCallbackData(commandPersona, personas[idx].Name),
+		})
+	}
+	buttons = append(buttons, keyboardButton{
+		text: l.text(respBodyButtonPersonaNone),
+		data: newCallbackData(commandPersona, personaNone),
+	})
+	return newKeyboard(buttons, lenJobsKeyboardRow)
+}
+
+// keyboardModels - данные кнопки "<команда> <модель>", выбранные модели отмечены
+func keyboardModels(choices []modelChoice) keyboard {
+	buttons := make([]keyboardButton, 0, len(choices))
+	for _, choice := range choices {
+		mark := "/"
+		if choice.isSelected {
+			mark = "✅ /"
+		}
+		buttons = append(buttons, keyboardButton{
+			text: mark + choice.command + " " + choice.model,
+			data: newCallbackData(commandModel, choice.command+" "+choice.model),
+		})
+	}
+	return newKeyboard(buttons, lenJobsKeyboardRow)
+}
+
+// keyboardLanguages - кнопки с названиями языков из их каталогов
+func keyboardLanguages(l *locales) keyboard {
+	langs := l.languages()
+	buttons := make([]keyboardButton, 0, len(langs))
+	for _, lang := range langs {
+		buttons = append(buttons, keyboardButton{
+			text: l.text(lang, respBodyLanguageName),
+			data: newCallbackData(commandLanguage, lang),
+		})
+	}
+	return newKeyboard(buttons, lenHelpKeyboardRow)
+}
+
+func keyboardGroupCommands(enabled map[string]struct{}, names []string) keyboard {
+	buttons := make([]keyboardButton, 0, len(names))
+	for _, command := range names {
+		if !isGroupSwitchable(command, names) {
+			continue
+		}
+		mark := "❌ /"
+		if _, ok := enabled[command]; ok {
+			mark = "✅ /"
+		}
+		buttons = append(buttons, keyboardButton{
+			text: mark + command,
+			data: newCallbackData(commandGroupCommands, command),
+		})
+	}
+	return newKeyboard(buttons, lenJobsKeyboardRow)
+}
@@ -0,0 +1,262 @@
+package tbotopenai
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Каталоги ответов бота: встроенные locales/<язык>.yaml и файлы из locales.path, которые дополняют
+// или заменяют встроенные. Сообщение - строка или формы множественного числа (one, few, many, other),
+// форма выбирается по аргументу count; аргументы подставляются вместо {имя}.
+
+//go:embed locales/*.yaml
+var embeddedLocales embed.FS
+
+const (
+	defaultLanguage   = "ru"
+	localeFileExt     = ".yaml"
+	embeddedLocaleDir = "locales"
+	pluralArg         = "count"
+)
+
+const (
+	pluralOne   = "one"
+	pluralFew   = "few"
+	pluralMany  = "many"
+	pluralOther = "other"
+)
+
+var errDefaultLocaleIsNotExist = errors.New("default locale is not exist")
+
+// catalogMessage - формы сообщения; у сообщения без множественного числа одна форма other
+type catalogMessage map[string]string
+
+func (m *catalogMessage) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*m = catalogMessage{pluralOther: node.Value}
+		return nil
+	}
+	forms := make(map[string]string)
+	if err := node.Decode(&forms); err != nil {
+		return err
+	}
+	*m = forms
+	return nil
+}
+
+type catalog map[string]catalogMessage
+
+type locales struct {
+	defaultLang string
+	catalogs    map[string]catalog
+}
+
+func loadLocales(cfg *LocaleSettings, log *zap.Logger) (*locales, error) {
+	l := &locales{
+		defaultLang: cfg.Default,
+		catalogs:    make(map[string]catalog),
+	}
+	if l.defaultLang == "" {
+		l.defaultLang = defaultLanguage
+	}
+	entries, err := embeddedLocales.ReadDir(embeddedLocaleDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		body, err := embeddedLocales.ReadFile(embeddedLocaleDir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if err = l.merge(entry.Name(), body); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Path != "" {
+		paths, err := filepath.Glob(filepath.Join(cfg.Path, "*"+localeFileExt))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			body, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if err = l.merge(filepath.Base(path), body); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if _, ok := l.catalogs[l.defaultLang]; !ok {
+		return nil, errDefaultLocaleIsNotExist
+	}
+	for _, lang := range l.languages() {
+		if missing := l.missingMessages(lang); len(missing) > 0 {
+			log.Warn("Locale has no messages, default language is used",
+				zap.String("lang", lang),
+				zap.Strings("ids", missing))
+		}
+	}
+	return l, nil
+}
+
+func (l *locales) merge(fileName string, body []byte) error {
+	lang := strings.TrimSuffix(fileName, localeFileExt)
+	messages := make(catalog)
+	if err := yaml.NewDecoder(bytes.NewReader(body)).Decode(&messages); err != nil {
+		return fmt.Errorf("locale %s: %w", fileName, err)
+	}
+	if l.catalogs[lang] == nil {
+		l.catalogs[lang] = make(catalog, len(messages))
+	}
+	for id, msg := range messages {
+		l.catalogs[lang][id] = msg
+	}
+	return nil
+}
+
+func (l *locales) missingMessages(lang string) []string {
+	missing := make([]string, 0)
+	for id := range l.catalogs[l.defaultLang] {
+		if _, ok := l.catalogs[lang][id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// languages - языки каталогов, язык по умолчанию первый
+func (l *locales) languages() []string {
+	langs := make([]string, 0, len(l.catalogs))
+	for lang := range l.catalogs {
+		if lang != l.defaultLang {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	return append([]string{l.defaultLang}, langs...)
+}
+
+// match - язык каталога по коду языка Telegram (IETF, например "en-US"), "" - каталога нет
+func (l *locales) match(code string) string {
+	code = strings.ToLower(code)
+	if _, ok := l.catalogs[code]; ok {
+		return code
+	}
+	base, _, _ := strings.Cut(code, "-")
+	if _, ok := l.catalogs[base]; ok {
+		return base
+	}
+	return ""
+}
+
+// text - сообщение каталога с подставленными аргументами, args - пары имя, значение
+func (l *locales) text(lang, id string, args ...any) string {
+	msg, ok := l.catalogs[lang][id]
+	if !ok {
+		lang = l.defaultLang
+		if msg, ok = l.catalogs[lang][id]; !ok {
+			return id
+		}
+	}
+	form := pluralOther
+	if len(msg) > 1 {
+		form = pluralForm(lang, pluralCount(args))
+	}
+	text, ok := msg[form]
+	if !ok {
+		text = msg[pluralOther]
+	}
+	// замены выполняются за один проход: плейсхолдеры в подставленных значениях, например в тексте
+	// документа, не заменяются
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		name, ok := args[i].(string)
+		if !ok {
+			continue
+		}
+		pairs = append(pairs, "{"+name+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+func pluralCount(args []any) int {
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] != pluralArg {
+			continue
+		}
+		switch n := args[i+1].(type) {
+		case int:
+			return n
+		case int64:
+			return int(n)
+		case string:
+			count, _ := strconv.Atoi(n)
+			return count
+		}
+	}
+	return 0
+}
+
+// pluralForm - правила множественного числа CLDR для целых чисел
+func pluralForm(lang string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch lang {
+	case "ru", "uk", "be":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return pluralOne
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return pluralFew
+		default:
+			return pluralMany
+		}
+	}
+	if n == 1 {
+		return pluralOne
+	}
+	return pluralOther
+}
+
+// localizer - тексты ответов на языке пользователя
+type localizer struct {
+	locales *locales
+	lang    string
+}
+
+func (l localizer) text(id string, args ...any) string {
+	return l.locales.text(l.lang, id, args...)
+}
+
+func (l localizer) bytes(id string, args ...any) []byte {
+	return []byte(l.text(id, args...))
+}
+
+// commands - команды с описаниями на языке пользователя
+func (l localizer) commands(commands []commandInfo) []commandInfo {
+	localized := make([]commandInfo, 0, len(commands))
+	for _, command := range commands {
+		switch {
+		case command.description != "":
+		case command.descriptionID != "":
+			command.description = l.text(command.descriptionID)
+		default:
+			command.description = l.text(respBodyCommandDescriptionPrefix + command.name)
+		}
+		localized = append(localized, command)
+	}
+	return localized
+}
@@ -0,0 +1,102 @@
+package tbotopenai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPluralForm(t *testing.T) {
+	tests := []struct {
+		name    string
+		lang    string
+		n       int
+		expForm string
+	}{
+		{name: "ru 1", lang: "ru", n: 1, expForm: pluralOne},
+		{name: "ru 21", lang: "ru", n: 21, expForm: pluralOne},
+		{name: "ru 11", lang: "ru", n: 11, expForm: pluralMany},
+		{name: "ru 2", lang: "ru", n: 2, expForm: pluralFew},
+		{name: "ru 34", lang: "ru", n: 34, expForm: pluralFew},
+		{name: "ru 12", lang: "ru", n: 12, expForm: pluralMany},
+		{name: "ru 0", lang: "ru", n: 0, expForm: pluralMany},
+		{name: "ru 111", lang: "ru", n: 111, expForm: pluralMany},
+		{name: "ru negative", lang: "ru", n: -2, expForm: pluralFew},
+		{name: "uk 3", lang: "uk", n: 3, expForm: pluralFew},
+		{name: "en 1", lang: "en", n: 1, expForm: pluralOne},
+		{name: "en 0", lang: "en", n: 0, expForm: pluralOther},
+		{name: "en 21", lang: "en", n: 21, expForm: pluralOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expForm, pluralForm(tt.lang, tt.n))
+		})
+	}
+}
+
+func TestLocales_Text(t *testing.T) {
+	l, err := loadLocales(&LocaleSettings{}, zap.NewNop())
+	assert.NoError(t, err)
+	tests := []struct {
+		name    string
+		lang    string
+		id      string
+		args    []any
+		expText string
+	}{
+		{
+			name:    "Plural form is selected by count",
+			lang:    "ru",
+			id:      respBodyBlacklist,
+			args:    []any{"count", 3},
+			expText: "В черном списке 3 пользователя:",
+		},
+		{
+			name:    "Form other is used by en",
+			lang:    "en",
+			id:      respBodyBlacklist,
+			args:    []any{"count", int64(5)},
+			expText: "5 users are banned:",
+		},
+		{
+			name:    "Plural form of the dropped messages",
+			lang:    "ru",
+			id:      respBodyStatsDropped,
+			args:    []any{"count", int64(3)},
+			expText: "📭 Не удалось доставить 3 сообщения",
+		},
+		{
+			name:    "Placeholders in values are not replaced",
+			lang:    "en",
+			id:      respBodyPersonaChanged,
+			args:    []any{"persona", "{persona}"},
+			expText: "✅ Persona: {persona} ✅",
+		},
+		{
+			name:    "Console message with a number",
+			lang:    "en",
+			id:      respConsoleEdited,
+			args:    []any{"message_id", 7},
+			expText: "[#7 edited]",
+		},
+		{
+			name:    "Unknown language falls back to default",
+			lang:    "de",
+			id:      respBodyLanguageChanged,
+			args:    []any{"language", "Deutsch"},
+			expText: "✅ Язык ответов: Deutsch ✅",
+		},
+		{
+			name:    "Unknown message is its id",
+			lang:    "en",
+			id:      "unknown_message",
+			expText: "unknown_message",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expText, l.text(tt.lang, tt.id, tt.args...))
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package tbotopenai
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Меню команд Telegram строится по тем же правам, что и /help: меню по умолчанию - для любого
+// пользователя на каждом языке каталогов, отдельное меню по роли и языку - только для сеансов,
+// у которых оно отличается от меню по умолчанию. Меню обновляются фоновым обработчиком через очередь
+// отправки, а сеансы с отдельным меню хранятся в файле path_menu_chats строками "<chatID>:<userID>:<username>".
+
+// defaultMenuSession - пустой ключ сессии означает меню по умолчанию
+var defaultMenuSession = sessionKey{}
+
+// menuSession - пользователь сеанса; isCustom - сеансу установлено отдельное меню
+type menuSession struct {
+	username string
+	isCustom bool
+}
+
+// menuUpdates - сеансы, меню которых ждут обновления; повторное обновление сеанса в очереди не добавляется
+type menuUpdates struct {
+	mutex      sync.Mutex
+	pending    map[sessionKey]string
+	signalChan chan struct{}
+	stopChan   chan struct{}
+}
+
+func newMenuUpdates() menuUpdates {
+	return menuUpdates{
+		pending:    make(map[sessionKey]string),
+		signalChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+}
+
+func (u *menuUpdates) push(key sessionKey, username string) {
+	u.mutex.Lock()
+	u.pending[key] = username
+	u.mutex.Unlock()
+	select {
+	case u.signalChan <- struct{}{}:
+	default:
+	}
+}
+
+func (u *menuUpdates) pop() map[sessionKey]string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	pending := u.pending
+	u.pending = make(map[sessionKey]string)
+	return pending
+}
+
+func (t *TBotOpenAI) menuCommands(username string, key sessionKey) []commandInfo {
+	if key != defaultMenuSession && t.isBanned(username) {
+		return nil
+	}
+	return t.allowedCommands(username, key)
+}
+
+// setCommandMenu - ставит обновление меню сеанса в очередь фонового обработчика
+func (t *TBotOpenAI) setCommandMenu(key sessionKey, username string) {
+	t.menuUpdates.push(key, username)
+}
+
+func (t *TBotOpenAI) initCommandMenusWorker() {
+	for {
+		select {
+		case <-t.menuUpdates.stopChan:
+			return
+		case <-t.menuUpdates.signalChan:
+			var isChanged bool
+			for key, username := range t.menuUpdates.pop() {
+				if t.applyCommandMenu(key, username) {
+					isChanged = true
+				}
+			}
+			if !isChanged {
+				continue
+			}
+			if err := t.writeMenuSessionsToFile(); err != nil {
+				t.log.Error("Write menu chats file err", zap.Error(err))
+			}
+		}
+	}
+}
+
+// applyCommandMenu - сеансу с меню по умолчанию отдельное меню не устанавливается, а ранее
+// установленное удаляется; возвращает true, если изменился список сеансов с отдельным меню
+func (t *TBotOpenAI) applyCommandMenu(key sessionKey, username string) bool {
+	val, _ := t.menuSessions.Load(key)
+	prev, _ := val.(menuSession)
+	commands := t.menuCommands(username, key)
+	session := menuSession{
+		username: username,
+		isCustom: !t.isDefaultCommandMenu(key.userID, commands),
+	}
+	t.menuSessions.Store(key, session)
+	if !session.isCustom && !prev.isCustom {
+		return false
+	}
+	if !session.isCustom {
+		commands = nil
+	}
+	if err := t.telegram.SetCommands(key, "", t.localizer(key.userID).commands(commands)); err != nil {
+		t.log.Error("Set commands menu err:", zap.Error(err),
+			zap.Int64("chat_id", key.chatID),
+			zap.String("username", username))
+	}
+	return session != prev
+}
+
+// isDefaultCommandMenu - пользователь видит меню по умолчанию на языке своего клиента Telegram
+func (t *TBotOpenAI) isDefaultCommandMenu(userID int64, commands []commandInfo) bool {
+	_, client := t.languages.load(userID)
+	lang := t.locales.match(client)
+	if lang == "" {
+		lang = t.locales.defaultLang
+	}
+	if t.userLanguage(userID) != lang {
+		return false
+	}
+	defaultCommands := t.menuCommands("", defaultMenuSession)
+	if len(commands) != len(defaultCommands) {
+		return false
+	}
+	for idx := range commands {
+		if commands[idx].name != defaultCommands[idx].name {
+			return false
+		}
+	}
+	return true
+}
+
+// setDefaultCommandMenus - меню без кода языка показывается на языке по умолчанию,
+// остальные языки каталогов задаются меню с кодом языка
+func (t *TBotOpenAI) setDefaultCommandMenus() {
+	commands := t.menuCommands("", defaultMenuSession)
+	for _, lang := range t.locales.languages() {
+		languageCode := lang
+		if lang == t.locales.defaultLang {
+			languageCode = ""
+		}
+		l := localizer{locales: t.locales, lang: lang}
+		if err := t.telegram.SetCommands(defaultMenuSession, languageCode, l.commands(commands)); err != nil {
+			t.log.Error("Set commands menu err:", zap.Error(err), zap.String("lang", lang))
+		}
+	}
+}
+
+// refreshCommandMenus - обновляет меню по умолчанию и меню всех известных чатов
+func (t *TBotOpenAI) refreshCommandMenus() {
+	t.setDefaultCommandMenus()
+	t.menuSessions.Range(func(k, v any) bool {
+		key, ok := k.(sessionKey)
+		if !ok {
+			return true
+		}
+		if session, ok := v.(menuSession); ok {
+			t.setCommandMenu(key, session.username)
+		}
+		return true
+	})
+}
+
+// refreshUserCommandMenus - обновляет меню пользователя после бана или разбана
+func (t *TBotOpenAI) refreshUserCommandMenus(username string) {
+	t.menuSessions.Range(func(k, v any) bool {
+		key, ok := k.(sessionKey)
+		if session, isSession := v.(menuSession); ok && isSession && session.username == username {
+			t.setCommandMenu(key, username)
+		}
+		return true
+	})
+}
+
+// refreshUserIDCommandMenus - обновляет меню пользователя во всех чатах после смены языка
+func (t *TBotOpenAI) refreshUserIDCommandMenus(userID int64) {
+	t.menuSessions.Range(func(k, v any) bool {
+		key, ok := k.(sessionKey)
+		if !ok || key.userID != userID {
+			return true
+		}
+		if session, ok := v.(menuSession); ok {
+			t.setCommandMenu(key, session.username)
+		}
+		return true
+	})
+}
+
+// refreshChatCommandMenus - обновляет меню участников группы после изменения ее команд
+func (t *TBotOpenAI) refreshChatCommandMenus(chatID int64) {
+	t.menuSessions.Range(func(k, v any) bool {
+		key, ok := k.(sessionKey)
+		if !ok || key.chatID != chatID {
+			return true
+		}
+		if session, ok := v.(menuSession); ok {
+			t.setCommandMenu(key, session.username)
+		}
+		return true
+	})
+}
+
+// rememberMenuSession - новому сеансу меню устанавливается, только если оно отличается от меню по умолчанию
+func (t *TBotOpenAI) rememberMenuSession(msg *message) {
+	key := msg.session()
+	val, ok := t.menuSessions.Load(key)
+	prev, _ := val.(menuSession)
+	if ok && prev.username == msg.username {
+		return
+	}
+	t.menuSessions.Store(key, menuSession{username: msg.username, isCustom: prev.isCustom})
+	t.setCommandMenu(key, msg.username)
+}
+
+func (t *TBotOpenAI) storeMenuSessions() error {
+	if t.cfg.PathMenuChats == "" {
+		return nil
+	}
+	body, err := os.ReadFile(t.cfg.PathMenuChats)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.log.Error("Read menu chats file err", zap.Error(err))
+		return err
+	}
+	rows := strings.Split(strings.ReplaceAll(string(body), "\r", ""), "\n")
+	for _, row := range rows {
+		fields := strings.SplitN(row, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		chatID, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			t.log.Error("Parse menu chats file err", zap.Error(err))
+			continue
+		}
+		userID, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			t.log.Error("Parse menu chats file err", zap.Error(err))
+			continue
+		}
+		// меню сеансов из файла было установлено отдельно, при запуске оно проверяется заново
+		t.menuSessions.Store(sessionKey{chatID: chatID, userID: userID}, menuSession{username: fields[2], isCustom: true})
+	}
+	return nil
+}
+
+func (t *TBotOpenAI) writeMenuSessionsToFile() error {
+	if t.cfg.PathMenuChats == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	t.menuSessions.Range(func(k, v any) bool {
+		key, ok := k.(sessionKey)
+		if !ok {
+			return true
+		}
+		session, ok := v.(menuSession)
+		if !ok || !session.isCustom {
+			return true
+		}
+		b.WriteString(strconv.FormatInt(key.chatID, 10) + ":" + strconv.FormatInt(key.userID, 10) + ":" + session.username + "\n")
+		return true
+	})
+	return os.WriteFile(t.cfg.PathMenuChats, b.Bytes(), 0644)
+}
@@ -0,0 +1,124 @@
+package tbotopenai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Модели команд: роли доступны модели из секции models, клиент выбирает модель командой /model,
+// иначе используется первая модель роли, а если у роли нет моделей - модель провайдера по умолчанию.
+
+var errModelIsInvalid = errors.New("model is empty, contains spaces or does not fit in the button data")
+
+// checkModels - команда и модель передаются в данных кнопки "model:<команда> <модель>", поэтому
+// они не длиннее maxLenCallbackData, а модель не содержит пробелов
+func checkModels(cfg *ModelSettings) error {
+	for _, roleModels := range []map[string][]string{cfg.AdminModels, cfg.UserModels} {
+		for command, models := range roleModels {
+			for _, model := range models {
+				if len(strings.Fields(model)) != 1 ||
+					len(newCallbackData(commandModel, command+" "+model)) > maxLenCallbackData {
+					return fmt.Errorf("%w: '%s %s'", errModelIsInvalid, command, model)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// modelChoice - модель команды, которую может выбрать клиент
+type modelChoice struct {
+	command    string
+	model      string
+	isSelected bool
+}
+
+// roleModels - модели команды, доступные роли пользователя
+func (t *TBotOpenAI) roleModels(username, command string) []string {
+	switch t.getRole(username) {
+	case roleAdmin:
+		return t.cfg.Models.AdminModels[command]
+	case roleUser:
+		return t.cfg.Models.UserModels[command]
+	}
+	return nil
+}
+
+func (t *TBotOpenAI) isRoleModel(username, command, model string) bool {
+	for _, m := range t.roleModels(username, command) {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// clientModel - модель запроса: выбранная клиентом, если она еще доступна его роли, иначе первая модель роли;
+// "" - модель провайдера по умолчанию
+func (t *TBotOpenAI) clientModel(key sessionKey, username, command string) string {
+	if model, err := t.clientStates.ClientModel(key, command); err == nil && t.isRoleModel(username, command, model) {
+		return model
+	}
+	if models := t.roleModels(username, command); len(models) > 0 {
+		return models[0]
+	}
+	return ""
+}
+
+func (t *TBotOpenAI) commandModel(command, username string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
+		t.log.Error("Update client command err:", zap.Error(err))
+		return &commandResponse{
+			text: l.text(respBodySessionIsNotExist),
+		}
+	}
+	choices := t.modelChoices(key, username)
+	if len(choices) == 0 {
+		return &commandResponse{
+			text: l.text(respErrBodyModelsIsNotExist),
+		}
+	}
+	return &commandResponse{
+		text:     l.text(respBodyCommandModel),
+		keyboard: keyboardModels(choices),
+	}
+}
+
+// processModel - модель выбирается текстом "<команда> <модель>"
+func (t *TBotOpenAI) processModel(msg *message) *taskResponse {
+	key := msg.session()
+	l := t.localizer(msg.userID)
+	fields := strings.Fields(msg.text)
+	if len(fields) != 2 {
+		return &taskResponse{body: l.bytes(respErrBodyInvalidModel)}
+	}
+	command, model := t.canonicalCommand(strings.TrimPrefix(fields[0], "/")), fields[1]
+	if !t.isRoleModel(msg.username, command, model) {
+		return &taskResponse{body: l.bytes(respErrBodyInvalidModel)}
+	}
+	if err := t.clientStates.UpdateClientModel(key, command, model); err != nil {
+		t.log.Error("Update client model err:", zap.Error(err))
+		return &taskResponse{body: l.bytes(respBodySessionIsNotExist)}
+	}
+	return &taskResponse{body: l.bytes(respBodyModelChanged, "command", command, "model", model)}
+}
+
+// modelChoices - модели команд, доступные роли клиента
+func (t *TBotOpenAI) modelChoices(key sessionKey, username string) []modelChoice {
+	choices := make([]modelChoice, 0)
+	for _, p := range t.providers.list {
+		if !p.supportsModel() {
+			continue
+		}
+		command := p.cfg.Command
+		selected := t.clientModel(key, username, command)
+		for _, model := range t.roleModels(username, command) {
+			choices = append(choices, modelChoice{command: command, model: model, isSelected: model == selected})
+		}
+	}
+	return choices
+}
@@ -0,0 +1,48 @@
+package tbotopenai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckModels(t *testing.T) {
+	// "model:chatGPT " занимает 14 байт данных кнопки
+	lenModel := maxLenCallbackData - len(newCallbackData(commandModel, commandChatGPT+" "))
+	tests := []struct {
+		name     string
+		models   []string
+		expError error
+	}{
+		{
+			name:   "Short models",
+			models: []string{"gpt-4o-mini", "gpt-4o"},
+		},
+		{
+			name:   "Model fills the button data",
+			models: []string{strings.Repeat("m", lenModel)},
+		},
+		{
+			name:     "Model does not fit in the button data",
+			models:   []string{"gpt-4o", strings.Repeat("m", lenModel+1)},
+			expError: errModelIsInvalid,
+		},
+		{
+			name:     "Model contains spaces",
+			models:   []string{"gpt 4o"},
+			expError: errModelIsInvalid,
+		},
+		{
+			name:     "Empty model",
+			models:   []string{""},
+			expError: errModelIsInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, checkModels(&ModelSettings{UserModels: map[string][]string{commandChatGPT: tt.models}}), tt.expError)
+			assert.ErrorIs(t, checkModels(&ModelSettings{AdminModels: map[string][]string{commandChatGPT: tt.models}}), tt.expError)
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"context"
 	"encoding/base64"
 	"errors"
+	"io"
+	"net/http"
 	"strings"
 	"time"
 
@@ -32,23 +34,65 @@ type OpenAI struct {
 	client        *openai.Client
 	retryCount    int
 	retryInterval time.Duration
+	imagesCount   int
+	imageSize     string
+	// model - модель запроса, если клиент не выбрал свою
+	model string
 }
 
+// headerTransport - добавляет заголовки из настроек к каждому запросу к серверу
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (h *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, val := range h.headers {
+		req.Header.Set(name, val)
+	}
+	return h.base.RoundTrip(req)
+}
+
+// NewOpenAI - клиент API OpenAI или совместимого с ним сервера (base_url);
+// пустой token - запросы без заголовка Authorization
 func NewOpenAI(cfg *OpenAISettings) *OpenAI {
+	clientCfg := openai.DefaultConfig(cfg.Token)
+	if cfg.BaseURL != "" {
+		clientCfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	if len(cfg.Headers) > 0 {
+		clientCfg.HTTPClient = &http.Client{
+			Transport: &headerTransport{base: http.DefaultTransport, headers: cfg.Headers},
+		}
+	}
 	chatGPT := &OpenAI{
-		client:        openai.NewClient(cfg.Token),
+		client:        openai.NewClientWithConfig(clientCfg),
 		retryCount:    cfg.RetryCount,
 		retryInterval: cfg.RetryInterval,
+		imagesCount:   cfg.ImagesCount,
+		imageSize:     cfg.ImageSize,
+		model:         cfg.Model,
+	}
+	if chatGPT.retryCount <= 0 {
+		chatGPT.retryCount = 1
+	}
+	if chatGPT.imagesCount <= 0 {
+		chatGPT.imagesCount = 1
+	}
+	if chatGPT.imageSize == "" {
+		chatGPT.imageSize = openai.CreateImageSize1024x1024
 	}
 	return chatGPT
 }
 
-func (o *OpenAI) GenerateImage(ctx context.Context, prompt string) ([]byte, string, error) {
+func (o *OpenAI) GenerateImage(ctx context.Context, req *aiRequest) ([]imageFile, error) {
 	reqBase64 := openai.ImageRequest{
-		Prompt:         prompt,
-		Size:           openai.CreateImageSize1024x1024,
+		Prompt:         req.prompt,
+		Model:          o.requestModel(req),
+		Size:           o.imageSize,
 		ResponseFormat: openai.CreateImageResponseFormatB64JSON,
-		N:              1,
+		N:              o.imagesCount,
 	}
 	var (
 		respBase64 openai.ImageResponse
@@ -61,32 +105,34 @@ func (o *OpenAI) GenerateImage(ctx context.Context, prompt string) ([]byte, stri
 		}
 		time.Sleep(o.retryInterval)
 	}
+	if err != nil {
+		return nil, err
+	}
 	if len(respBase64.Data) == 0 {
-		return nil, "", errChatGPTEmptyRespData
+		return nil, errChatGPTEmptyRespData
 	}
-	body, err := base64.StdEncoding.DecodeString(respBase64.Data[0].B64JSON)
-	if err != nil {
-		return nil, "", err
+	files := make([]imageFile, 0, len(respBase64.Data))
+	for idx := range respBase64.Data {
+		body, err := base64.StdEncoding.DecodeString(respBase64.Data[idx].B64JSON)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, imageFile{
+			body:     body,
+			fileName: strgen.Generate(lenImgFileName) + formatImgFile,
+		})
 	}
-	return body, strgen.Generate(lenImgFileName) + formatImgFile, err
+	return files, nil
 }
 
-func (o *OpenAI) GenerateText(ctx context.Context, prompt string) ([]byte, error) {
+func (o *OpenAI) GenerateText(ctx context.Context, req *aiRequest) ([]byte, error) {
 	var (
 		resp openai.ChatCompletionResponse
 		err  error
 	)
-	req := openai.ChatCompletionRequest{
-		Model: openai.GPT432K0613,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
-	}
+	chatReq := newChatCompletionRequest(req, o.requestModel(req))
 	for i := 0; i < o.retryCount; i++ {
-		resp, err = o.client.CreateChatCompletion(ctx, req)
+		resp, err = o.client.CreateChatCompletion(ctx, chatReq)
 		if isSkipRetry(err) {
 			break
 		}
@@ -101,6 +147,107 @@ func (o *OpenAI) GenerateText(ctx context.Context, prompt string) ([]byte, error
 	return []byte(resp.Choices[0].Message.Content), nil
 }
 
+func (o *OpenAI) GenerateTextStream(ctx context.Context, req *aiRequest, onDelta func(delta string)) ([]byte, error) {
+	var (
+		stream *openai.ChatCompletionStream
+		err    error
+	)
+	chatReq := newChatCompletionRequest(req, o.requestModel(req))
+	for i := 0; i < o.retryCount; i++ {
+		stream, err = o.client.CreateChatCompletionStream(ctx, chatReq)
+		if isSkipRetry(err) {
+			break
+		}
+		time.Sleep(o.retryInterval)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var b strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return []byte(b.String()), err
+		}
+		if len(resp.Choices) == 0 || resp.Choices[0].Delta.Content == "" {
+			continue
+		}
+		b.WriteString(resp.Choices[0].Delta.Content)
+		onDelta(resp.Choices[0].Delta.Content)
+	}
+	if b.Len() == 0 {
+		return nil, errChatGPTEmptyRespChoices
+	}
+	return []byte(b.String()), nil
+}
+
+// requestModel - модель, выбранная клиентом, иначе модель из настроек провайдера
+func (o *OpenAI) requestModel(req *aiRequest) string {
+	if req.model != "" {
+		return req.model
+	}
+	return o.model
+}
+
+// newChatCompletionRequest - запрос отправляется модели model, а если она не задана,
+// запрос с изображениями - модели с поддержкой vision
+func newChatCompletionRequest(req *aiRequest, model string) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.history)+2)
+	if req.system != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.system,
+		})
+	}
+	for idx := range req.history {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    req.history[idx].role,
+			Content: req.history[idx].content,
+		})
+	}
+	if len(req.images) == 0 {
+		if model == "" {
+			model = openai.GPT432K0613
+		}
+		return openai.ChatCompletionRequest{
+			Model: model,
+			Messages: append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: req.prompt,
+			}),
+		}
+	}
+	parts := []openai.ChatMessagePart{
+		{
+			Type: openai.ChatMessagePartTypeText,
+			Text: req.prompt,
+		},
+	}
+	for _, imageURL := range req.imageURLs() {
+		parts = append(parts, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL:    imageURL,
+				Detail: openai.ImageURLDetailAuto,
+			},
+		})
+	}
+	if model == "" {
+		model = openai.GPT4o
+	}
+	return openai.ChatCompletionRequest{
+		Model: model,
+		Messages: append(messages, openai.ChatCompletionMessage{
+			Role:         openai.ChatMessageRoleUser,
+			MultiContent: parts,
+		}),
+	}
+}
+
 func isSkipRetry(err error) bool {
 	return err == nil || (err != nil && (!strings.Contains(err.Error(), errChatGPTStatusCode503Response) && (!strings.Contains(err.Error(), errChatGPTStatusCode429Response))))
 }
@@ -0,0 +1,103 @@
+package tbotopenai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCompatibleServer - OpenAI-совместимый сервер, который запоминает путь, заголовки и модель запроса
+type testCompatibleServer struct {
+	path   string
+	header http.Header
+	model  string
+}
+
+func (s *testCompatibleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.path, s.header = r.URL.Path, r.Header.Clone()
+	var request struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.model = request.Model
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/chat/completions":
+		_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"answer"}}]}`))
+	case "/v1/images/generations":
+		_, _ = w.Write([]byte(`{"data":[{"b64_json":"` + base64.StdEncoding.EncodeToString([]byte("image")) + `"}]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestOpenAI_Compatible(t *testing.T) {
+	tests := []struct {
+		name             string
+		token            string
+		isImage          bool
+		requestModel     string
+		expPath          string
+		expModel         string
+		expAuthorization string
+	}{
+		{
+			name:             "Text with the provider model",
+			token:            "token",
+			expPath:          "/v1/chat/completions",
+			expModel:         "qwen2.5-7b-instruct",
+			expAuthorization: "Bearer token",
+		},
+		{
+			name:         "Text with the client model without token",
+			requestModel: "llama-3.1-8b",
+			expPath:      "/v1/chat/completions",
+			expModel:     "llama-3.1-8b",
+		},
+		{
+			name:             "Image with the provider model",
+			token:            "token",
+			isImage:          true,
+			expPath:          "/v1/images/generations",
+			expModel:         "qwen2.5-7b-instruct",
+			expAuthorization: "Bearer token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &testCompatibleServer{}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			ai := NewOpenAI(&OpenAISettings{
+				Token:   tt.token,
+				BaseURL: server.URL + "/v1/",
+				Model:   "qwen2.5-7b-instruct",
+				Headers: map[string]string{"X-Gateway-Team": "bots"},
+			})
+			req := &aiRequest{prompt: "prompt", model: tt.requestModel}
+			if tt.isImage {
+				files, err := ai.GenerateImage(context.Background(), req)
+				assert.NoError(t, err)
+				if assert.Len(t, files, 1) {
+					assert.Equal(t, []byte("image"), files[0].body)
+				}
+			} else {
+				body, err := ai.GenerateText(context.Background(), req)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("answer"), body)
+			}
+			assert.Equal(t, tt.expPath, handler.path)
+			assert.Equal(t, tt.expModel, handler.model)
+			assert.Equal(t, "bots", handler.header.Get("X-Gateway-Team"))
+			assert.Equal(t, tt.expAuthorization, handler.header.Get("Authorization"))
+		})
+	}
+}
@@ -33,6 +33,10 @@ func (t *TBotOpenAI) checkPermissions(command, username string) bool {
 	if curRole == "" {
 		return false
 	}
+	// роли провайдера заменяют списки permissions для его команды
+	if p, ok := t.providers.get(command); ok && len(p.cfg.Roles) > 0 {
+		return containsString(p.cfg.Roles, curRole)
+	}
 	val, ok := t.permissions.Load(curRole)
 	if !ok {
 		return false
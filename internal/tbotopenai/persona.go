@@ -0,0 +1,95 @@
+package tbotopenai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Персона - системный промпт сессии для текстовых моделей: пресет из конфигурации (переводчик,
+// ревьюер кода, агент поддержки) или промпт, отправленный пользователем. Сбрасывается на /stop.
+
+// personaNone - данные кнопки, отключающей персону
+const personaNone = "-"
+
+// maxLenSystemPrompt - системный промпт отправляется с каждым запросом, поэтому его длина ограничена
+const maxLenSystemPrompt = 4000
+
+var errPersonaNameIsInvalid = errors.New("persona name is empty or does not fit in the button data")
+
+// checkPersonas - имя пресета передается в данных кнопки, поэтому "persona:<имя>" не длиннее maxLenCallbackData
+func checkPersonas(personas []PersonaSettings) error {
+	for idx := range personas {
+		name := personas[idx].Name
+		if strings.TrimSpace(name) == "" || name == personaNone ||
+			len(newCallbackData(commandPersona, name)) > maxLenCallbackData {
+			return fmt.Errorf("%w: '%s'", errPersonaNameIsInvalid, name)
+		}
+	}
+	return nil
+}
+
+// personaPreset - пресет по имени, nil - пресета с таким именем нет
+func (t *TBotOpenAI) personaPreset(name string) *PersonaSettings {
+	for idx := range t.cfg.Personas {
+		if strings.EqualFold(t.cfg.Personas[idx].Name, name) {
+			return &t.cfg.Personas[idx]
+		}
+	}
+	return nil
+}
+
+func (t *TBotOpenAI) commandPersona(command, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
+		t.log.Error("Update client command err:", zap.Error(err))
+		return &commandResponse{
+			text: l.text(respBodySessionIsNotExist),
+		}
+	}
+	return &commandResponse{
+		text:     l.text(respBodyCommandPersona),
+		keyboard: keyboardPersonas(l, t.cfg.Personas),
+	}
+}
+
+// processPersona - имя пресета выбирает его промпт, любой другой текст становится системным промптом
+func (t *TBotOpenAI) processPersona(msg *message) *taskResponse {
+	key := msg.session()
+	l := t.localizer(msg.userID)
+	text := strings.TrimSpace(msg.text)
+	var (
+		systemPrompt string
+		respBody     []byte
+	)
+	switch preset := t.personaPreset(text); {
+	case text == personaNone:
+		respBody = l.bytes(respBodyPersonaReset)
+	case preset != nil:
+		systemPrompt = preset.Prompt
+		respBody = l.bytes(respBodyPersonaChanged, "persona", preset.Name)
+	case utf8.RuneCountInString(text) > maxLenSystemPrompt:
+		return &taskResponse{body: l.bytes(respErrBodyPersonaIsTooLong, "limit", maxLenSystemPrompt)}
+	default:
+		systemPrompt = text
+		respBody = l.bytes(respBodyPersonaCustom)
+	}
+	if err := t.clientStates.UpdateClientSystemPrompt(key, systemPrompt); err != nil {
+		t.log.Error("Update client system prompt err:", zap.Error(err))
+		return &taskResponse{body: l.bytes(respBodySessionIsNotExist)}
+	}
+	return &taskResponse{body: respBody}
+}
+
+// attachPersona - к текстовому запросу добавляется системный промпт сессии
+func (t *TBotOpenAI) attachPersona(msg *message, req *aiRequest) {
+	systemPrompt, err := t.clientStates.ClientSystemPrompt(msg.session())
+	if err != nil {
+		t.log.Error("Get client system prompt err:", zap.Error(err))
+		return
+	}
+	req.system = systemPrompt
+}
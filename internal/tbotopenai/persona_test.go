@@ -0,0 +1,46 @@
+package tbotopenai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPersonas(t *testing.T) {
+	tests := []struct {
+		name     string
+		persona  string
+		expError error
+	}{
+		{
+			name:    "Short name",
+			persona: "translator",
+		},
+		{
+			name:    "Name fills the button data",
+			persona: strings.Repeat("я", (maxLenCallbackData-len(commandPersona+callbackDataSeparator))/2),
+		},
+		{
+			name:     "Cyrillic name does not fit in the button data",
+			persona:  strings.Repeat("я", (maxLenCallbackData-len(commandPersona+callbackDataSeparator))/2+1),
+			expError: errPersonaNameIsInvalid,
+		},
+		{
+			name:     "Empty name",
+			persona:  " ",
+			expError: errPersonaNameIsInvalid,
+		},
+		{
+			name:     "Name of the button that disables the persona",
+			persona:  personaNone,
+			expError: errPersonaNameIsInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPersonas([]PersonaSettings{{Name: "reviewer"}, {Name: tt.persona}})
+			assert.ErrorIs(t, err, tt.expError)
+		})
+	}
+}
@@ -18,217 +18,197 @@ type commandResponse struct {
 	text     string
 	fileName string
 	fileBody []byte
+	keyboard keyboard
 }
 
-func (t *TBotOpenAI) processCommand(command, username string, chatID int64) *commandResponse {
+func (t *TBotOpenAI) processCommand(command, username string, key sessionKey) *commandResponse {
 	if command == "" {
 		return nil
 	}
+	l := t.localizer(key.userID)
 	if !t.checkPermissions(command, username) {
 		return &commandResponse{
-			text: respBodyUndefinedCommand,
+			text: l.text(respBodyUndefinedCommand),
 		}
 	}
 	val, ok := t.clientStateByCmd.Load(command)
 	if !ok {
 		return &commandResponse{
-			text: respBodyUndefinedCommand,
+			text: l.text(respBodyUndefinedCommand),
 		}
 	}
-	f, ok := val.(func(command, username string, chatID int64) *commandResponse)
+	f, ok := val.(func(command, username string, key sessionKey) *commandResponse)
 	if !ok {
 		return &commandResponse{
-			text: respBodyUndefinedCommand,
+			text: l.text(respBodyUndefinedCommand),
 		}
 	}
-	return f(command, username, chatID)
+	return f(command, username, key)
 }
 
-func (t *TBotOpenAI) commandHelp(_, username string, _ int64) *commandResponse {
+func (t *TBotOpenAI) commandHelp(_, username string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
 	curRole := t.getRole(username)
 	if curRole == "" {
 		return &commandResponse{
-			text: respBodyUndefinedCommand,
+			text: l.text(respBodyUndefinedCommand),
+		}
+	}
+	commands := t.allowedCommands(username, key)
+	names := make([]string, 0, len(commands))
+	for idx := range commands {
+		if commands[idx].name != commandHelp {
+			names = append(names, commands[idx].name)
 		}
 	}
 	return &commandResponse{
-		text: respBodyCommandHelp(curRole),
+		text:     respBodyCommandList(l, l.commands(commands)),
+		keyboard: keyboardCommands(names),
 	}
 }
 
-func (t *TBotOpenAI) commandDreamBoothExample(_, _ string, _ int64) *commandResponse {
+func (t *TBotOpenAI) commandDreamBoothExample(_, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
 	return &commandResponse{
-		text: respBodyCommandDreamBoothExample,
+		text: l.text(respBodyCommandDreamBoothExample),
 	}
 }
 
-func (t *TBotOpenAI) commandStart(_, username string, chatID int64) *commandResponse {
-	if err := t.clientStates.AddClient(chatID, username); err != nil {
+func (t *TBotOpenAI) commandStart(_, username string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.AddClient(key, username); err != nil {
 		t.log.Error("Add client err:", zap.Error(err))
 		return &commandResponse{
-			text: respBodySessionIsAlreadyExist,
+			text: l.text(respBodySessionIsAlreadyExist),
 		}
 	}
 	return &commandResponse{
-		text: respBodySessionCreated,
+		text: l.text(respBodySessionCreated),
 	}
 }
 
-func (t *TBotOpenAI) commandStop(_, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.ClientCancelJobs(chatID); err != nil {
+func (t *TBotOpenAI) commandStop(_, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.ClientCancelJobs(key); err != nil {
 		t.log.Error("Cancel client jobs err:", zap.Error(err))
 		return &commandResponse{
-			text: respBodySessionIsNotExist,
+			text: l.text(respBodySessionIsNotExist),
 		}
 	}
-	if err := t.clientStates.DeleteClient(chatID); err != nil {
+	if err := t.clientStates.DeleteClient(key); err != nil {
 		t.log.Error("Delete clientState err:", zap.Error(err))
 		return &commandResponse{
-			text: respBodySessionIsNotExist,
+			text: l.text(respBodySessionIsNotExist),
 		}
 	}
 	return &commandResponse{
-		text: respBodySessionRemoved,
+		text: l.text(respBodySessionRemoved),
 	}
 }
 
-func (t *TBotOpenAI) commandDreamBooth(command, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.UpdateClientCommand(chatID, command); err != nil {
-		t.log.Error("Update client command err:", zap.Error(err))
-		return &commandResponse{
-			text: respBodySessionIsNotExist,
+// commandProvider - выбор команды провайдера, ответ зависит от его типа и режима
+func (t *TBotOpenAI) commandProvider(p *provider) func(command, username string, key sessionKey) *commandResponse {
+	return func(command, _ string, key sessionKey) *commandResponse {
+		l := t.localizer(key.userID)
+		if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
+			t.log.Error("Update client command err:", zap.Error(err))
+			return &commandResponse{
+				text: l.text(respBodySessionIsNotExist),
+			}
 		}
-	}
-	return &commandResponse{
-		text: respBodyCommandDreamBooth,
-	}
-}
-
-func (t *TBotOpenAI) commandChatGPT(command, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.UpdateClientCommand(chatID, command); err != nil {
-		t.log.Error("Update client command err:", zap.Error(err))
-		return &commandResponse{
-			text: respBodySessionIsNotExist,
+		text := l.text(p.commandBody(), "api", p.cfg.Label)
+		if p.cfg.Type == providerTypeFusionBrain {
+			text += "\n" + l.text(respBodyFusionBrainInput[0])
 		}
-	}
-	return &commandResponse{
-		text: respBodyCommandChatGPT,
-	}
-}
-
-func (t *TBotOpenAI) commandOpenAIText(command, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.UpdateClientCommand(chatID, command); err != nil {
-		t.log.Error("Update client command err:", zap.Error(err))
-		return &commandResponse{
-			text: respBodySessionIsNotExist,
-		}
-	}
-	return &commandResponse{
-		text: respBodyCommandOpenAIText,
-	}
-}
-
-func (t *TBotOpenAI) commandOpenAIImage(command, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.UpdateClientCommand(chatID, command); err != nil {
-		t.log.Error("Update client command err:", zap.Error(err))
-		return &commandResponse{
-			text: respBodySessionIsNotExist,
-		}
-	}
-	return &commandResponse{
-		text: respBodyCommandOpenAIImage,
-	}
-}
-
-func (t *TBotOpenAI) commandFusionBrain(command, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.UpdateClientCommand(chatID, command); err != nil {
-		t.log.Error("Update client command err:", zap.Error(err))
 		return &commandResponse{
-			text: respBodySessionIsNotExist,
+			text: text,
 		}
 	}
-	return &commandResponse{
-		text: respBodyCommandFusionBrain + "\n" + respBodyFusionBrainInput[0],
-	}
 }
 
-func (t *TBotOpenAI) commandCancelJob(command, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.UpdateClientCommand(chatID, command); err != nil {
+func (t *TBotOpenAI) commandCancelJob(command, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
 		t.log.Error("Update client command err:", zap.Error(err))
 		return &commandResponse{
-			text: respBodySessionIsNotExist,
+			text: l.text(respBodySessionIsNotExist),
 		}
 	}
 	return &commandResponse{
-		text: respBodyInputJobID,
+		text: l.text(respBodyInputJobID),
 	}
 }
 
-func (t *TBotOpenAI) commandListJobs(_, username string, chatID int64) *commandResponse {
+func (t *TBotOpenAI) commandListJobs(_, username string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
 	curRole := t.getRole(username)
 	if curRole == "" {
 		return &commandResponse{
-			text: respBodyUndefinedCommand,
+			text: l.text(respBodyUndefinedCommand),
 		}
 	}
-	textJobIDs, err := t.clientStates.ClientChatGPTJobs(chatID)
-	if err != nil {
-		t.log.Error("Get ChatGPT jobs err:", zap.Error(err))
-		return &commandResponse{
-			text: respBodySessionIsNotExist,
+	jobs := make([]apiJobIDs, 0, len(t.providers.list))
+	allJobIDs := make([][]int, 0, len(t.providers.list))
+	for _, p := range t.providers.list {
+		if !t.checkPermissions(p.cfg.Command, username) {
+			continue
 		}
-	}
-	imgJobIDs, err := t.clientStates.ClientDreamBoothJobs(chatID)
-	if err != nil {
-		t.log.Error("Get DreamBooth jobs err:", zap.Error(err))
-		return &commandResponse{
-			text: respBodySessionIsNotExist,
+		jobIDs, err := t.clientStates.ClientJobs(key, p.cfg.Command)
+		if err != nil {
+			t.log.Error("Get client jobs err:", zap.Error(err))
+			return &commandResponse{
+				text: l.text(respBodySessionIsNotExist),
+			}
 		}
+		allJobIDs = append(allJobIDs, jobIDs)
+		jobs = appendAPIJobIDs(jobs, p.cfg.Label, jobIDs)
 	}
-	openAIIDs, err := t.clientStates.ClientOpenAIJobs(chatID)
-	if err != nil {
-		t.log.Error("Get OpenAI jobs err:", zap.Error(err))
-		return &commandResponse{
-			text: respBodySessionIsNotExist,
-		}
+	return &commandResponse{
+		text:     respBodyListJobIDs(l, jobs),
+		keyboard: keyboardCancelJobs(allJobIDs...),
 	}
-	fbIDs, err := t.clientStates.ClientFusionBrainJobs(chatID)
-	if err != nil {
-		t.log.Error("Get FusionBrain jobs err:", zap.Error(err))
-		return &commandResponse{
-			text: respBodySessionIsNotExist,
+}
+
+// appendAPIJobIDs - запросы провайдеров с одной подписью выводятся одним списком
+func appendAPIJobIDs(jobs []apiJobIDs, api string, jobIDs []int) []apiJobIDs {
+	for idx := range jobs {
+		if jobs[idx].api == api {
+			jobs[idx].jobIDs = append(jobs[idx].jobIDs, jobIDs...)
+			return jobs
 		}
 	}
-	return &commandResponse{
-		text: respBodyListJobs(textJobIDs, imgJobIDs, openAIIDs, fbIDs, curRole),
-	}
+	return append(jobs, apiJobIDs{api: api, jobIDs: jobIDs})
 }
 
-func (t *TBotOpenAI) commandStats(_, _ string, _ int64) *commandResponse {
+func (t *TBotOpenAI) commandStats(_, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	dropped := l.text(respBodyStatsDropped, "count", t.telegram.DroppedMessages())
 	statsBody := t.stats.Bytes()
 	if len(statsBody) == 0 {
 		return &commandResponse{
-			text: respBodyStatsCommand,
+			text: l.text(respBodyStatsCommand) + "\n\n" + dropped,
 		}
 	}
 	return &commandResponse{
-		fileName: fileNameStats,
-		fileBody: t.stats.Bytes(),
+		text:     dropped,
+		fileName: t.defaultLocalizer().text(respFileNameStats),
+		fileBody: statsBody,
 	}
 }
 
-func (t *TBotOpenAI) commandLogs(_, _ string, _ int64) *commandResponse {
+func (t *TBotOpenAI) commandLogs(_, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
 	if len(t.cfg.Logger.OutputPaths) == 0 {
 		t.log.Error("Empty output paths for logs")
 		return &commandResponse{
-			text: respErrBodyGetLogs,
+			text: l.text(respErrBodyGetLogs),
 		}
 	}
 	file, err := os.Open(t.cfg.Logger.OutputPaths[0])
 	if err != nil {
 		t.log.Error("Reading log's file err:", zap.Error(err))
 		return &commandResponse{
-			text: respErrBodyGetLogs,
+			text: l.text(respErrBodyGetLogs),
 		}
 	}
 	defer func() {
@@ -251,7 +231,7 @@ func (t *TBotOpenAI) commandLogs(_, _ string, _ int64) *commandResponse {
 	if err = scanner.Err(); err != nil {
 		t.log.Error("Scanner log's file err:", zap.Error(err))
 		return &commandResponse{
-			text: respErrBodyGetLogs,
+			text: l.text(respErrBodyGetLogs),
 		}
 	}
 	return &commandResponse{
@@ -260,43 +240,61 @@ func (t *TBotOpenAI) commandLogs(_, _ string, _ int64) *commandResponse {
 	}
 }
 
-func (t *TBotOpenAI) commandBan(command, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.UpdateClientCommand(chatID, command); err != nil {
+func (t *TBotOpenAI) commandBan(command, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
 		t.log.Error("Update client command err:", zap.Error(err))
 		return &commandResponse{
-			text: respBodySessionIsNotExist,
+			text: l.text(respBodySessionIsNotExist),
 		}
 	}
 	return &commandResponse{
-		text: respBodyCommandBan,
+		text: l.text(respBodyCommandBan),
 	}
 }
 
-func (t *TBotOpenAI) commandUnban(command, _ string, chatID int64) *commandResponse {
-	if err := t.clientStates.UpdateClientCommand(chatID, command); err != nil {
+func (t *TBotOpenAI) commandUnban(command, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
 		t.log.Error("Update client command err:", zap.Error(err))
 		return &commandResponse{
-			text: respBodySessionIsNotExist,
+			text: l.text(respBodySessionIsNotExist),
 		}
 	}
 	return &commandResponse{
-		text: respBodyCommandUnban,
+		text: l.text(respBodyCommandUnban),
 	}
 }
 
-func (t *TBotOpenAI) commandBlacklist(_, _ string, _ int64) *commandResponse {
+func (t *TBotOpenAI) commandBlacklist(_, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
 	body, err := os.ReadFile(t.cfg.PathBlackList)
 	if err != nil {
 		t.log.Error("Reading blacklist's file err:", zap.Error(err))
 		return &commandResponse{
-			text: respErrBodyGetLogs,
+			text: l.text(respErrBodyGetLogs),
 		}
 	}
+	usernames := strings.Fields(string(body))
 	var b bytes.Buffer
-	b.WriteString("Список заблокированных пользователей:\n")
+	b.WriteString(l.text(respBodyBlacklist, "count", len(usernames)) + "\n")
 	b.Write(body)
 	return &commandResponse{
 		fileName: fileNameBlacklist,
 		fileBody: b.Bytes(),
 	}
 }
+
+func (t *TBotOpenAI) commandImageFormat(command, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
+		t.log.Error("Update client command err:", zap.Error(err))
+		return &commandResponse{
+			text: l.text(respBodySessionIsNotExist),
+		}
+	}
+	return &commandResponse{
+		text:     l.text(respBodyCommandImageFormat),
+		keyboard: keyboardImageFormats(),
+	}
+}
@@ -17,210 +17,219 @@ const (
 )
 
 const (
-	labelChatGPT    = "ChatGPT"
-	labelOpenAI     = "OpenAI"
-	labelDreamBooth = "DreamBooth"
+	labelChatGPT     = "ChatGPT"
+	labelOpenAI      = "OpenAI"
+	labelDreamBooth  = "DreamBooth"
+	labelFusionBrain = "FusionBrain"
 )
 
-func (t *TBotOpenAI) processTask(text string, chatID int64) ([]byte, string) {
-	command, err := t.clientStates.ClientCommand(chatID)
+type taskResponse struct {
+	body    []byte
+	files   []imageFile
+	caption string
+	// editMessageID - сообщение бота, которое нужно отредактировать ответом вместо отправки нового
+	editMessageID int
+	// isMarkdown - ответ текстовой модели в Markdown, отправляется с разметкой Telegram
+	isMarkdown bool
+	// isAnswer - успешный ответ модели, только он сохраняется для продолжения диалога
+	isAnswer bool
+}
+
+func (t *TBotOpenAI) processTask(msg *message) *taskResponse {
+	key := msg.session()
+	l := t.localizer(msg.userID)
+	command, err := t.taskCommandOf(msg)
 	if err != nil {
 		t.log.Error("Get client command err:", zap.Error(err))
-		return nil, ""
+		return &taskResponse{}
 	}
-	username, err := t.clientStates.ClientUsername(chatID)
+	username, err := t.clientStates.ClientUsername(key)
 	if err != nil {
 		t.log.Error("Get client username err:", zap.Error(err))
-		return nil, ""
+		return &taskResponse{}
 	}
 	val, ok := t.taskByCmd.Load(command)
 	if !ok {
-		return []byte(respBodyUndefinedJob), ""
+		return &taskResponse{body: l.bytes(respBodyUndefinedJob)}
 	}
-	f, ok := val.(func(text string, chatID int64) (body []byte, fileName string))
+	f, ok := val.(func(msg *message) *taskResponse)
 	if !ok {
-		return []byte(respBodyUndefinedJob), ""
+		return &taskResponse{body: l.bytes(respBodyUndefinedJob)}
 	}
-	body, filename := f(text, chatID)
+	resp := f(msg)
+	t.rememberThread(msg, command, resp)
 	var response string
-	if filename == "" {
-		response = string(body)
+	if len(resp.files) == 0 {
+		response = string(resp.body)
 	}
-	t.writeStats(command, username, text, response)
-	return body, filename
+	t.writeStats(command, username, msg.text, response)
+	return resp
 }
 
-func (t *TBotOpenAI) processCancelJob(text string, chatID int64) ([]byte, string) {
-	jobID, err := strconv.Atoi(text)
+func (t *TBotOpenAI) processCancelJob(msg *message) *taskResponse {
+	key := msg.session()
+	l := t.localizer(msg.userID)
+	jobID, err := strconv.Atoi(msg.text)
 	if err != nil {
 		t.log.Error("Get jobID err:", zap.Error(err))
-		return []byte(respErrBodyInvalidFormatJobID), ""
-	}
-	if err = t.clientStates.ClientCancelChatGPTJob(jobID, chatID); err == nil {
-		return respBodySuccessCancelJob(labelChatGPT, jobID), ""
+		return &taskResponse{body: l.bytes(respErrBodyInvalidFormatJobID)}
 	}
-	if err = t.clientStates.ClientCancelOpenAIJob(jobID, chatID); err == nil {
-		return respBodySuccessCancelJob(labelOpenAI, jobID), ""
+	if command, err := t.clientStates.ClientCancelJob(jobID, key); err == nil {
+		return &taskResponse{body: l.bytes(respBodyJobCancelSuccess, "api", t.providerLabel(command), "job_id", jobID)}
 	}
-	if err = t.clientStates.ClientCancelDreamBoothJob(jobID, chatID); err == nil {
-		return respBodySuccessCancelJob(labelDreamBooth, jobID), ""
-	}
-	return respErrBodyJobIsNotExist(jobID), ""
+	return &taskResponse{body: l.bytes(respBodyJobIsNotExist, "job_id", jobID)}
 }
 
-func (t *TBotOpenAI) processChatGPT(text string, chatID int64) ([]byte, string) {
-	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.ChatGPT.Timeout)
-	jobID := randIntByRange(minJobID, maxJobID)
-	if err := t.clientStates.ClientAddChatGPTJob(cancel, jobID, chatID); err != nil {
-		t.log.Error("Add ChatGPT job err:", zap.Error(err))
-		return []byte(respBodySessionIsNotExist), ""
-	}
-	body, err := t.chatGPTBot.GenerateText(ctx, text)
-	if errors.Is(err, context.Canceled) {
-		return []byte(respErrBodyJobCanceled), ""
-	}
-	defer func() {
-		if err = t.clientStates.ClientCancelChatGPTJob(jobID, chatID); err != nil {
-			t.log.Error("Cancel ChatGPT job err:", zap.Error(err))
+// processProvider - задача команды провайдера: генерация текста или изображений
+func (t *TBotOpenAI) processProvider(p *provider) func(msg *message) *taskResponse {
+	if p.isImage() {
+		return func(msg *message) *taskResponse {
+			return t.processImage(p, msg)
 		}
-	}()
-	if err != nil {
-		t.log.Error("ChatGPT response err:", zap.Error(err))
-		body = []byte(respErrBodyChatGPT)
 	}
-	return body, ""
+	return func(msg *message) *taskResponse {
+		return t.processText(p, msg)
+	}
 }
 
-func (t *TBotOpenAI) processOpenAIText(text string, chatID int64) ([]byte, string) {
-	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.OpenAI.Timeout)
-	jobID := randIntByRange(minJobID, maxJobID)
-	if err := t.clientStates.ClientAddOpenAIJob(cancel, jobID, chatID); err != nil {
-		t.log.Error("Add OpenAI job err:", zap.Error(err))
-		return []byte(respBodySessionIsNotExist), ""
-	}
-	body, err := t.openAI.GenerateText(ctx, text)
-	if errors.Is(err, context.Canceled) {
-		return []byte(respErrBodyJobCanceled), ""
-	}
-	defer func() {
-		if err = t.clientStates.ClientCancelOpenAIJob(jobID, chatID); err != nil {
-			t.log.Error("Cancel OpenAI job err:", zap.Error(err))
-		}
-	}()
+func (t *TBotOpenAI) processText(p *provider, msg *message) *taskResponse {
+	key := msg.session()
+	l := t.localizer(msg.userID)
+	req, err := t.newAIRequest(msg)
 	if err != nil {
-		t.log.Error("OpenAI response err:", zap.Error(err))
-		body = []byte(respErrBodyOpenAI)
+		t.log.Error("Download photo err:", zap.Error(err))
+		return &taskResponse{body: l.bytes(respErrBodyDownloadPhoto)}
 	}
-	return body, ""
-}
-
-func (t *TBotOpenAI) processOpenAIImage(text string, chatID int64) ([]byte, string) {
-	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.OpenAI.Timeout)
+	ctx, cancel := context.WithTimeout(msg.jobContext(), p.cfg.Timeout)
 	jobID := randIntByRange(minJobID, maxJobID)
-	if err := t.clientStates.ClientAddOpenAIJob(cancel, jobID, chatID); err != nil {
-		t.log.Error("Add OpenAI job err:", zap.Error(err))
-		return []byte(respBodySessionIsNotExist), ""
+	if err = t.clientStates.ClientAddJob(p.cfg.Command, cancel, jobID, key); err != nil {
+		cancel()
+		t.log.Error("Add job err:", zap.String("api", p.cfg.Label), zap.Error(err))
+		return &taskResponse{body: l.bytes(respBodySessionIsNotExist)}
+	}
+	defer t.removeJob(jobID, key)
+	var (
+		body          []byte
+		placeholderID int
+	)
+	if err = t.attachDocument(ctx, p.ai, key, req); err == nil {
+		t.attachThread(msg, req)
+		t.attachHistory(msg, req)
+		t.attachPersona(msg, req)
+		req.model = t.clientModel(key, msg.username, p.cfg.Command)
+		body, placeholderID, err = t.generateText(ctx, p.ai, req, msg)
 	}
-	body, fileName, err := t.openAI.GenerateImage(ctx, text)
 	if errors.Is(err, context.Canceled) {
-		return []byte(respErrBodyJobCanceled), ""
+		return &taskResponse{body: respBodyPartialJobCanceled(l, body), editMessageID: placeholderID, isMarkdown: true}
 	}
-	defer func() {
-		if err = t.clientStates.ClientCancelOpenAIJob(jobID, chatID); err != nil {
-			t.log.Error("Cancel OpenAI job err:", zap.Error(err))
-		}
-	}()
 	if err != nil {
-		t.log.Error("OpenAI response err:", zap.Error(err))
-		body = []byte(respErrBodyOpenAI)
+		t.log.Error("AI response err:", zap.String("api", p.cfg.Label), zap.Error(err))
+		body = l.bytes(p.errBody(err), "api", p.cfg.Label)
+		return &taskResponse{body: body, editMessageID: placeholderID, isMarkdown: true}
 	}
-	return body, fileName
+	t.rememberHistory(msg, body)
+	return &taskResponse{body: body, editMessageID: placeholderID, isMarkdown: true, isAnswer: true}
 }
 
-func (t *TBotOpenAI) processDreamBooth(text string, chatID int64) ([]byte, string) {
-	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.DreamBooth.Timeout)
-	jobID := randIntByRange(minJobID, maxJobID)
-	if err := t.clientStates.ClientAddDreamBoothJob(cancel, jobID, chatID); err != nil {
-		t.log.Error("Add DreamBooth job err:", zap.Error(err))
-		return []byte(respBodySessionIsNotExist), ""
-	}
-	body, fileName, err := t.dreamBooth.GenerateImage(ctx, text)
-	if errors.Is(err, context.Canceled) {
-		return []byte(respErrBodyJobCanceled), ""
-	}
-	defer func() {
-		if err = t.clientStates.ClientCancelDreamBoothJob(jobID, chatID); err != nil {
-			t.log.Error("Cancel DreamBooth job err:", zap.Error(err))
+func (t *TBotOpenAI) processImage(p *provider, msg *message) *taskResponse {
+	key, text := msg.session(), msg.text
+	l := t.localizer(msg.userID)
+	req := &aiRequest{prompt: text}
+	if p.supportsPhoto() {
+		var err error
+		if req, err = t.newAIRequest(msg); err != nil {
+			t.log.Error("Download photo err:", zap.Error(err))
+			return &taskResponse{body: l.bytes(respErrBodyDownloadPhoto)}
 		}
-	}()
-	if err != nil {
-		t.log.Error("DreamBooth response err:", zap.Error(err))
-		body = []byte(respErrBodyCommandDreamBooth(err))
 	}
-	return body, fileName
-}
-
-func (t *TBotOpenAI) processFusionBrain(text string, chatID int64) ([]byte, string) {
-	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.FusionBrain.Timeout)
+	if p.supportsModel() {
+		req.model = t.clientModel(key, msg.username, p.cfg.Command)
+	}
+	ctx, cancel := context.WithTimeout(msg.jobContext(), p.cfg.Timeout)
+	ctx = withProgress(ctx, msg.progress)
 	jobID := randIntByRange(minJobID, maxJobID)
-	if err := t.clientStates.ClientAddFusionBrainJob(cancel, jobID, chatID); err != nil {
-		t.log.Error("Add FusionBrain job err:", zap.Error(err))
-		return []byte(respBodySessionIsNotExist), ""
+	if err := t.clientStates.ClientAddJob(p.cfg.Command, cancel, jobID, key); err != nil {
+		cancel()
+		t.log.Error("Add job err:", zap.String("api", p.cfg.Label), zap.Error(err))
+		return &taskResponse{body: l.bytes(respBodySessionIsNotExist)}
 	}
-	body, fileName, err := t.fusionBrain.GenerateImage(ctx, text)
+	defer t.removeJob(jobID, key)
+	files, err := p.ai.GenerateImage(ctx, req)
 	if errors.Is(err, context.Canceled) {
-		return []byte(respErrBodyJobCanceled), ""
+		return &taskResponse{body: l.bytes(respBodyJobCanceled)}
 	}
-	defer func() {
-		if err = t.clientStates.ClientCancelFusionBrainJob(jobID, chatID); err != nil {
-			t.log.Error("Cancel FusionBrain job err:", zap.Error(err))
-		}
-	}()
 	if err != nil {
-		t.log.Error("FusionBrain response err:", zap.Error(err))
-		body = []byte(respErrBodyFusionBrain)
+		t.log.Error("AI response err:", zap.String("api", p.cfg.Label), zap.Error(err))
+		return &taskResponse{body: l.bytes(p.errBody(err), "api", p.cfg.Label)}
 	}
-	return body, fileName
+	return &taskResponse{files: files, caption: p.caption(l, text), isAnswer: true}
+}
+
+// removeJob - запрос удаляется из запросов клиента при любом завершении, в том числе при отмене
+// редактированием сообщения; ошибка не логируется: запрос, отмененный через /cancelJob или /stop,
+// удален раньше вместе с сессией или без нее
+func (t *TBotOpenAI) removeJob(jobID int, key sessionKey) {
+	_, _ = t.clientStates.ClientCancelJob(jobID, key)
 }
 
 func (t *TBotOpenAI) writeStats(command, username, request, response string) {
-	switch command {
-	case commandChatGPT, commandOpenAIImage, commandOpenAIText, commandDreamBooth, commandFusionBrain:
-		loc, err := time.LoadLocation("Europe/Moscow")
-		if err != nil {
-			t.log.Error("Load location err:", zap.Error(err))
-			return
-		}
-		t.stats.Write(statRow{
-			ts:       time.Now().In(loc).Format(time.RFC3339),
-			username: username,
-			ai:       command,
-			request:  request,
-			response: prepareResponse(response),
-		})
+	if !t.isProviderCommand(command) {
+		return
 	}
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.log.Error("Load location err:", zap.Error(err))
+		return
+	}
+	t.stats.Write(statRow{
+		ts:       time.Now().In(loc).Format(time.RFC3339),
+		username: username,
+		ai:       command,
+		request:  request,
+		response: prepareResponse(response),
+	})
 }
 
-func (t *TBotOpenAI) processBan(text string, _ int64) ([]byte, string) {
-	_, ok := t.blacklist.LoadOrStore(text, struct{}{})
+func (t *TBotOpenAI) processBan(msg *message) *taskResponse {
+	l := t.localizer(msg.userID)
+	_, ok := t.blacklist.LoadOrStore(msg.text, struct{}{})
 	if ok {
-		return []byte(respErrBodyRequestBanUsernameAlreadyExist), ""
+		return &taskResponse{body: l.bytes(respErrBodyRequestBanUsernameAlreadyExist)}
 	}
 	if err := t.writeBlacklistToFile(); err != nil {
-		return []byte(respErrBodyRequestBan), ""
+		return &taskResponse{body: l.bytes(respErrBodyRequestBan)}
 	}
-	return []byte(respBodyRequestBan), ""
+	t.refreshUserCommandMenus(msg.text)
+	return &taskResponse{body: l.bytes(respBodyRequestBan)}
 }
 
-func (t *TBotOpenAI) processUnban(text string, _ int64) ([]byte, string) {
-	_, ok := t.blacklist.LoadAndDelete(text)
+func (t *TBotOpenAI) processUnban(msg *message) *taskResponse {
+	l := t.localizer(msg.userID)
+	_, ok := t.blacklist.LoadAndDelete(msg.text)
 	if !ok {
-		return []byte(respErrBodyRequestUnbanUsernameIsNotExist), ""
+		return &taskResponse{body: l.bytes(respErrBodyRequestUnbanUsernameIsNotExist)}
 	}
 	if err := t.writeBlacklistToFile(); err != nil {
-		return []byte(respErrBodyRequestUnban), ""
+		return &taskResponse{body: l.bytes(respErrBodyRequestUnban)}
+	}
+	t.refreshUserCommandMenus(msg.text)
+	return &taskResponse{body: l.bytes(respBodyRequestUnban)}
+}
+
+func (t *TBotOpenAI) processImageFormat(msg *message) *taskResponse {
+	key := msg.session()
+	l := t.localizer(msg.userID)
+	format := strings.ToLower(strings.TrimSpace(msg.text))
+	switch format {
+	case imageFormatPhoto, imageFormatDocument, imageFormatBoth:
+	default:
+		return &taskResponse{body: l.bytes(respErrBodyInvalidImageFormat)}
+	}
+	if err := t.clientStates.UpdateClientImageFormat(key, format); err != nil {
+		t.log.Error("Update client image format err:", zap.Error(err))
+		return &taskResponse{body: l.bytes(respBodySessionIsNotExist)}
 	}
-	return []byte(respBodyRequestUnban), ""
+	return &taskResponse{body: l.bytes(respBodyImageFormatChanged, "format", format)}
 }
 
 func prepareResponse(response string) string {
@@ -0,0 +1,294 @@
+package tbotopenai
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultProgressInterval - Telegram показывает действие чата около 5 секунд
+	defaultProgressInterval = 5 * time.Second
+	// progressGroupInterval - в группе статус обновляется не чаще одного запроса в 15 секунд на все
+	// запросы чата, чтобы не занимать лимит 20 сообщений в минуту, нужный для ответов
+	progressGroupInterval = 15 * time.Second
+	// progressElapsedInterval - если изменилось только время выполнения, статус обновляется раз в минуту
+	progressElapsedInterval = time.Minute
+)
+
+const (
+	chatActionTyping      = "typing"
+	chatActionUploadPhoto = "upload_photo"
+)
+
+// jobProgress - состояние запроса в очереди, отображаемое в сообщении о статусе
+type jobProgress struct {
+	mutex     sync.Mutex
+	chatID    int64
+	requestID int
+	messageID int
+	action    string
+	l         localizer
+	startedAt time.Time
+	upstream  upstreamStatus
+	lastText  string
+	// lastState - статус без времени выполнения на момент последнего редактирования
+	lastState  string
+	lastEditAt time.Time
+}
+
+// jobProgressList - запросы в порядке добавления в очередь, по нему считается позиция в очереди
+type jobProgressList struct {
+	mutex    sync.Mutex
+	jobs     []*jobProgress
+	stopChan chan struct{}
+	// chatUpdatedAt - время последнего запроса к Telegram для статусов чата
+	chatUpdatedAt map[int64]time.Time
+}
+
+type progressCtxKey struct{}
+
+// withProgress - AI сообщает статус генерации на своей стороне через контекст запроса
+func withProgress(ctx context.Context, p *jobProgress) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressCtxKey{}, p)
+}
+
+func reportProgress(ctx context.Context, status upstreamStatus) {
+	if p, ok := ctx.Value(progressCtxKey{}).(*jobProgress); ok {
+		p.mutex.Lock()
+		p.upstream = status
+		p.mutex.Unlock()
+	}
+}
+
+func (t *TBotOpenAI) chatActionByCommand(command string) string {
+	if t.isImageCommand(command) {
+		return chatActionUploadPhoto
+	}
+	return chatActionTyping
+}
+
+func (l *jobProgressList) add(p *jobProgress) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.jobs = append(l.jobs, p)
+}
+
+func (l *jobProgressList) remove(p *jobProgress) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for idx := range l.jobs {
+		if l.jobs[idx] == p {
+			l.jobs = append(l.jobs[:idx], l.jobs[idx+1:]...)
+			return
+		}
+	}
+}
+
+// position - номер запроса среди еще не начатых, 0 - запрос выполняется
+func (l *jobProgressList) position(p *jobProgress) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	position := 0
+	for _, job := range l.jobs {
+		job.mutex.Lock()
+		isStarted := !job.startedAt.IsZero()
+		job.mutex.Unlock()
+		if !isStarted {
+			position++
+		}
+		if job == p {
+			if isStarted {
+				return 0
+			}
+			return position
+		}
+	}
+	return 0
+}
+
+// allowChat - резервирует обновление статуса в чате: в личном чате - одно за интервал прогресса,
+// в группе - одно за progressGroupInterval
+func (l *jobProgressList) allowChat(chatID int64, interval time.Duration) bool {
+	if chatID < 0 && interval < progressGroupInterval {
+		interval = progressGroupInterval
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	// допуск в 10% интервала, чтобы тикер с тем же интервалом не пропускал обновления
+	if updatedAt, ok := l.chatUpdatedAt[chatID]; ok && now.Sub(updatedAt) < interval-interval/10 {
+		return false
+	}
+	if l.chatUpdatedAt == nil {
+		l.chatUpdatedAt = make(map[int64]time.Time)
+	}
+	l.chatUpdatedAt[chatID] = now
+	return true
+}
+
+// forgetChat - удаляет время обновления чата, в котором не осталось запросов
+func (l *jobProgressList) forgetChat(chatID int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, job := range l.jobs {
+		if job.chatID == chatID {
+			return
+		}
+	}
+	delete(l.chatUpdatedAt, chatID)
+}
+
+func (l *jobProgressList) snapshot() []*jobProgress {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]*jobProgress(nil), l.jobs...)
+}
+
+// enqueueProgress - сообщение о статусе отправляется при добавлении запроса в очередь
+// и затем редактируется, пока запрос не выполнится
+func (t *TBotOpenAI) enqueueProgress(msg *message, command string) {
+	l := t.localizer(msg.userID)
+	if !t.cfg.Progress.Enabled {
+		if err := t.telegram.ReplyText(msg.messageID, msg.chatID, l.text(respBodyRequestAddedToQueue)); err != nil {
+			t.log.Error("Reply message error:", zap.Error(err))
+		}
+		return
+	}
+	p := &jobProgress{
+		chatID:    msg.chatID,
+		requestID: msg.messageID,
+		action:    t.chatActionByCommand(command),
+		l:         l,
+	}
+	t.jobsProgress.add(p)
+	text := l.text(respBodyJobQueued, "position", t.jobsProgress.position(p))
+	messageID, err := t.telegram.ReplyEditableText(msg.messageID, msg.chatID, text)
+	if err != nil {
+		t.log.Error("Reply message error:", zap.Error(err))
+	}
+	p.mutex.Lock()
+	p.messageID, p.lastText, p.lastState, p.lastEditAt = messageID, text, text, time.Now()
+	p.mutex.Unlock()
+	msg.progress = p
+}
+
+func (t *TBotOpenAI) startProgress(p *jobProgress) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	p.startedAt = time.Now()
+	p.mutex.Unlock()
+	t.updateProgress(p)
+}
+
+func (t *TBotOpenAI) finishProgress(p *jobProgress) {
+	if p == nil {
+		return
+	}
+	t.jobsProgress.remove(p)
+	t.jobsProgress.forgetChat(p.chatID)
+	p.mutex.Lock()
+	elapsed := time.Since(p.startedAt)
+	p.mutex.Unlock()
+	text := p.l.text(respBodyJobFinished, "elapsed", elapsed.Round(time.Second).String())
+	t.editProgress(p, text, text)
+}
+
+// cancelProgress - статус отмененного запроса заменяется текстом и больше не обновляется
+func (t *TBotOpenAI) cancelProgress(p *jobProgress, text string) {
+	if p == nil {
+		return
+	}
+	t.jobsProgress.remove(p)
+	t.jobsProgress.forgetChat(p.chatID)
+	t.editProgress(p, text, text)
+	p.mutex.Lock()
+	p.messageID = 0
+	p.mutex.Unlock()
+}
+
+func (t *TBotOpenAI) progressInterval() time.Duration {
+	if t.cfg.Progress.Interval <= 0 {
+		return defaultProgressInterval
+	}
+	return t.cfg.Progress.Interval
+}
+
+func (t *TBotOpenAI) initProgressWorker() {
+	ticker := time.NewTicker(t.progressInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.jobsProgress.stopChan:
+			return
+		case <-ticker.C:
+			t.updateProgressList()
+		}
+	}
+}
+
+// updateProgressList - сначала редактируются изменившиеся статусы, затем в чаты с выполняющимися
+// запросами, где статус не редактировался, отправляется действие "печатает" или "отправляет фото".
+// За интервал в чат уходит не больше одного запроса на все его запросы
+func (t *TBotOpenAI) updateProgressList() {
+	actions := make(map[int64]*jobProgress)
+	var chatIDs []int64
+	for _, p := range t.jobsProgress.snapshot() {
+		if isRunning := t.updateProgress(p); isRunning && actions[p.chatID] == nil {
+			actions[p.chatID] = p
+			chatIDs = append(chatIDs, p.chatID)
+		}
+	}
+	for _, chatID := range chatIDs {
+		if !t.jobsProgress.allowChat(chatID, t.progressInterval()) {
+			continue
+		}
+		p := actions[chatID]
+		if err := t.telegram.SendChatAction(p.requestID, chatID, p.action); err != nil {
+			t.log.Error("Send chat action err:", zap.Error(err))
+		}
+	}
+}
+
+// updateProgress - ожидающему запросу обновляется позиция в очереди, выполняющемуся - статус
+// на стороне AI; если изменилось только время выполнения, статус обновляется раз в progressElapsedInterval
+func (t *TBotOpenAI) updateProgress(p *jobProgress) (isRunning bool) {
+	position := t.jobsProgress.position(p)
+	p.mutex.Lock()
+	startedAt, upstream := p.startedAt, p.upstream
+	text := p.l.text(respBodyJobQueued, "position", position)
+	state := text
+	if isRunning = !startedAt.IsZero(); isRunning {
+		text = respBodyJobStatus(p.l, startedAt, upstream, time.Since(startedAt))
+		state = respBodyJobStatus(p.l, startedAt, upstream, 0)
+	}
+	isEdit := p.messageID != 0 && text != p.lastText &&
+		(state != p.lastState || time.Since(p.lastEditAt) >= progressElapsedInterval)
+	p.mutex.Unlock()
+	if isEdit && t.jobsProgress.allowChat(p.chatID, t.progressInterval()) {
+		t.editProgress(p, text, state)
+	}
+	return isRunning
+}
+
+// editProgress - Telegram отклоняет редактирование без изменения текста
+func (t *TBotOpenAI) editProgress(p *jobProgress, text, state string) {
+	p.mutex.Lock()
+	if p.messageID == 0 || p.lastText == text {
+		p.mutex.Unlock()
+		return
+	}
+	p.lastText, p.lastState, p.lastEditAt = text, state, time.Now()
+	messageID := p.messageID
+	p.mutex.Unlock()
+	if err := t.telegram.EditText(messageID, p.chatID, text); err != nil {
+		t.log.Error("Edit job status err:", zap.Error(err))
+	}
+}
@@ -0,0 +1,308 @@
+package tbotopenai
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Провайдеры AI объявляются в секции providers: тип, команда бота, роли, таймаут, лимит запросов клиента
+// и настройки доступа к API. Если секция не задана, провайдеры строятся из секций chatgpt, openai,
+// dreambooth и fusionbrain с прежними командами.
+
+const (
+	providerTypeChatGPTFree = "chatgptfree"
+	providerTypeOpenAI      = "openai"
+	// providerTypeOpenAICompatible - сервер с API OpenAI: vLLM, llama.cpp server, LocalAI, корпоративный шлюз
+	providerTypeOpenAICompatible = "openai_compatible"
+	providerTypeDreamBooth       = "dreambooth"
+	providerTypeFusionBrain      = "fusionbrain"
+)
+
+const (
+	providerModeText  = "text"
+	providerModeImage = "image"
+)
+
+const defaultProviderTimeout = 10 * time.Minute
+
+var (
+	errProviderTypeIsUnknown    = errors.New("provider type is unknown")
+	errProviderModeIsInvalid    = errors.New("provider mode is not supported by its type")
+	errProviderCommandIsEmpty   = errors.New("provider command is empty")
+	errProviderCommandIsAlready = errors.New("provider command is already used")
+	errProviderCommandIsUnknown = errors.New("provider command is unknown")
+	errProviderBaseURLIsEmpty   = errors.New("provider base_url is empty")
+	errProviderModelIsEmpty     = errors.New("provider model is empty")
+)
+
+// provider - AI, к которому обращается команда бота
+type provider struct {
+	cfg ProviderSettings
+	ai  AI
+}
+
+func newProvider(log *zap.Logger, cfg ProviderSettings) (*provider, error) {
+	if cfg.Command == "" {
+		return nil, errProviderCommandIsEmpty
+	}
+	var (
+		ai    AI
+		modes []string
+		label string
+	)
+	switch cfg.Type {
+	case providerTypeChatGPTFree:
+		ai, modes, label = NewChatGPTBot(), []string{providerModeText}, labelChatGPT
+	case providerTypeOpenAI:
+		ai, modes, label = NewOpenAI(&cfg.OpenAI), []string{providerModeText, providerModeImage}, labelOpenAI
+	case providerTypeOpenAICompatible:
+		if cfg.OpenAI.BaseURL == "" {
+			return nil, fmt.Errorf("%w: %s", errProviderBaseURLIsEmpty, cfg.Command)
+		}
+		// модели OpenAI по умолчанию на совместимом сервере обычно нет
+		if cfg.OpenAI.Model == "" {
+			return nil, fmt.Errorf("%w: %s", errProviderModelIsEmpty, cfg.Command)
+		}
+		ai, modes, label = NewOpenAI(&cfg.OpenAI), []string{providerModeText, providerModeImage}, cfg.OpenAI.Model
+	case providerTypeDreamBooth:
+		ai, modes, label = NewDreamBoothAPI(log, &cfg.DreamBooth), []string{providerModeImage}, labelDreamBooth
+	case providerTypeFusionBrain:
+		ai, modes, label = NewFusionBrainAPI(log, &cfg.FusionBrain), []string{providerModeImage}, labelFusionBrain
+	default:
+		return nil, fmt.Errorf("%w: %q", errProviderTypeIsUnknown, cfg.Type)
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = modes[0]
+	}
+	if !containsString(modes, cfg.Mode) {
+		return nil, fmt.Errorf("%w: %s %q", errProviderModeIsInvalid, cfg.Type, cfg.Mode)
+	}
+	if cfg.Label == "" {
+		cfg.Label = label
+	}
+	if cfg.Label == "" {
+		cfg.Label = cfg.Command
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultProviderTimeout
+	}
+	return &provider{cfg: cfg, ai: ai}, nil
+}
+
+func (p *provider) isImage() bool {
+	return p.cfg.Mode == providerModeImage
+}
+
+// supportsPhoto - модель принимает фото с запросом в подписи: vision или img2img
+func (p *provider) supportsPhoto() bool {
+	return !p.isImage() || p.cfg.Type == providerTypeDreamBooth
+}
+
+// supportsModel - провайдер принимает модель запроса, выбранную командой /model
+func (p *provider) supportsModel() bool {
+	switch p.cfg.Type {
+	case providerTypeChatGPTFree, providerTypeOpenAI, providerTypeOpenAICompatible:
+		return true
+	}
+	return false
+}
+
+// isSlow - DreamBooth и FusionBrain ставят запрос в свою очередь и генерируют изображение минутами
+func (p *provider) isSlow() bool {
+	return p.cfg.Type == providerTypeDreamBooth || p.cfg.Type == providerTypeFusionBrain
+}
+
+func (p *provider) icon() string {
+	switch {
+	case p.cfg.Type == providerTypeDreamBooth, p.cfg.Type == providerTypeFusionBrain:
+		return "🌅"
+	case p.isImage():
+		return "🌄"
+	}
+	return "📖"
+}
+
+// commandBody - ответ на выбор команды провайдера
+func (p *provider) commandBody() string {
+	switch p.cfg.Type {
+	case providerTypeChatGPTFree:
+		return respBodyCommandChatGPT
+	case providerTypeDreamBooth:
+		return respBodyCommandDreamBooth
+	case providerTypeFusionBrain:
+		return respBodyCommandFusionBrain
+	case providerTypeOpenAICompatible:
+		if p.isImage() {
+			return respBodyCommandCompatibleImage
+		}
+		return respBodyCommandCompatibleText
+	}
+	if p.isImage() {
+		return respBodyCommandOpenAIImage
+	}
+	return respBodyCommandOpenAIText
+}
+
+// descriptionID - описание команды провайдера по умолчанию по его типу и режиму
+func (p *provider) descriptionID() string {
+	if p.cfg.Type == providerTypeOpenAICompatible {
+		if p.isImage() {
+			return respBodyDescriptionCompatibleImage
+		}
+		return respBodyDescriptionCompatibleText
+	}
+	command := commandOpenAIText
+	switch {
+	case p.cfg.Type == providerTypeChatGPTFree:
+		command = commandChatGPT
+	case p.cfg.Type == providerTypeDreamBooth:
+		command = commandDreamBooth
+	case p.cfg.Type == providerTypeFusionBrain:
+		command = commandFusionBrain
+	case p.isImage():
+		command = commandOpenAIImage
+	}
+	return respBodyCommandDescriptionPrefix + command
+}
+
+func (p *provider) errBody(err error) string {
+	switch p.cfg.Type {
+	case providerTypeChatGPTFree:
+		return respErrBodyChatGPT
+	case providerTypeDreamBooth:
+		return respErrBodyCommandDreamBooth(err)
+	case providerTypeFusionBrain:
+		return respErrBodyFusionBrain
+	case providerTypeOpenAICompatible:
+		return respErrBodyCompatible
+	}
+	return respErrBodyOpenAI
+}
+
+func (p *provider) caption(l localizer, prompt string) string {
+	if p.cfg.Type == providerTypeFusionBrain {
+		return respBodyCaptionFusionBrain(l, p.cfg.Label, prompt)
+	}
+	return respBodyCaptionImage(p.cfg.Label, prompt)
+}
+
+// providerRegistry - провайдеры в порядке объявления и по командам
+type providerRegistry struct {
+	list      []*provider
+	byCommand map[string]*provider
+}
+
+func newProviderRegistry(log *zap.Logger, cfg *Config) (*providerRegistry, error) {
+	settings := cfg.Providers
+	if len(settings) == 0 {
+		settings = legacyProviders(cfg)
+	}
+	r := &providerRegistry{
+		list:      make([]*provider, 0, len(settings)),
+		byCommand: make(map[string]*provider, len(settings)),
+	}
+	for idx := range settings {
+		p, err := newProvider(log, settings[idx])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.byCommand[p.cfg.Command]; ok || isServiceCommand(p.cfg.Command) {
+			return nil, fmt.Errorf("%w: %s", errProviderCommandIsAlready, p.cfg.Command)
+		}
+		r.list = append(r.list, p)
+		r.byCommand[p.cfg.Command] = p
+	}
+	return r, nil
+}
+
+// legacyProviders - провайдеры из секций chatgpt, openai, dreambooth и fusionbrain
+func legacyProviders(cfg *Config) []ProviderSettings {
+	return []ProviderSettings{
+		{
+			Type:    providerTypeChatGPTFree,
+			Command: commandChatGPT,
+			Timeout: cfg.ChatGPT.Timeout,
+			MaxJobs: cfg.MaxClientChatGPTJobs,
+		},
+		{
+			Type:        providerTypeFusionBrain,
+			Command:     commandFusionBrain,
+			Timeout:     cfg.FusionBrain.Timeout,
+			FusionBrain: cfg.FusionBrain,
+		},
+		{
+			Type:    providerTypeOpenAI,
+			Command: commandOpenAIText,
+			Mode:    providerModeText,
+			Timeout: cfg.OpenAI.Timeout,
+			MaxJobs: cfg.MaxClientOpenAIJobs,
+			OpenAI:  cfg.OpenAI,
+		},
+		{
+			Type:    providerTypeOpenAI,
+			Command: commandOpenAIImage,
+			Mode:    providerModeImage,
+			Timeout: cfg.OpenAI.Timeout,
+			MaxJobs: cfg.MaxClientOpenAIJobs,
+			OpenAI:  cfg.OpenAI,
+		},
+		{
+			Type:       providerTypeDreamBooth,
+			Command:    commandDreamBooth,
+			Timeout:    cfg.DreamBooth.Timeout,
+			MaxJobs:    cfg.MaxClientDreamBoothJobs,
+			DreamBooth: cfg.DreamBooth,
+		},
+	}
+}
+
+func (r *providerRegistry) get(command string) (*provider, bool) {
+	p, ok := r.byCommand[command]
+	return p, ok
+}
+
+func (r *providerRegistry) commands() []string {
+	commands := make([]string, 0, len(r.list))
+	for _, p := range r.list {
+		commands = append(commands, p.cfg.Command)
+	}
+	return commands
+}
+
+func (r *providerRegistry) hasType(providerType string) bool {
+	for _, p := range r.list {
+		if p.cfg.Type == providerType {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TBotOpenAI) isProviderCommand(command string) bool {
+	_, ok := t.providers.get(command)
+	return ok
+}
+
+func (t *TBotOpenAI) isImageCommand(command string) bool {
+	p, ok := t.providers.get(command)
+	return ok && p.isImage()
+}
+
+func (t *TBotOpenAI) providerLabel(command string) string {
+	if p, ok := t.providers.get(command); ok {
+		return p.cfg.Label
+	}
+	return command
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
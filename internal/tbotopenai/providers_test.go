@@ -0,0 +1,46 @@
+package tbotopenai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNewProvider_OpenAICompatible(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      OpenAISettings
+		expError error
+	}{
+		{
+			name: "Base URL and model are set",
+			cfg:  OpenAISettings{BaseURL: "http://127.0.0.1:8000/v1", Model: "qwen2.5-7b-instruct"},
+		},
+		{
+			name:     "Base URL is empty",
+			cfg:      OpenAISettings{Model: "qwen2.5-7b-instruct"},
+			expError: errProviderBaseURLIsEmpty,
+		},
+		{
+			name:     "Model is empty",
+			cfg:      OpenAISettings{BaseURL: "http://127.0.0.1:8000/v1"},
+			expError: errProviderModelIsEmpty,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newProvider(zap.NewNop(), ProviderSettings{
+				Type:    providerTypeOpenAICompatible,
+				Command: "local",
+				OpenAI:  tt.cfg,
+			})
+			assert.ErrorIs(t, err, tt.expError)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, providerModeText, p.cfg.Mode)
+			assert.Equal(t, tt.cfg.Model, p.cfg.Label)
+		})
+	}
+}
@@ -1,89 +1,219 @@
 package tbotopenai
 
 import (
-	"bytes"
 	"errors"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// Идентификаторы сообщений каталогов locales/<язык>.yaml
 const (
-	respBodySessionIsAlreadyExist = `⚠ Сессия с ботом уже активна ⚠ 
-🔧 /help - описание команд`
-	respBodySessionCreated = `🎉 Сессия активна, добро пожаловать! 🎉
-🔧 /help - описание команд`
-	respBodySessionRemoved    = `😥 Сессия с ботом завершена. Возвращайтесь! 😥`
-	respBodySessionIsNotExist = `❌ Сессия с ботом не активна ❌
-✅ /start - начало сессии с ботом
-🔧 /help - описание команд`
-	respBodyCommandChatGPT = `📖 Генерация текста с помощью ChatGPT, модель gpt-4.0 📖
-Введите запрос как можно подробнее, чтобы получить наиболее удовлетворительный сгенерированный текстовый ответ`
-	respBodyCommandOpenAIText = `📖 Генерация текста с помощью OpenAI, модель gpt-4-32k-0613 📖
-Введите запрос как можно подробнее, чтобы получить наиболее удовлетворительный сгенерированный текстовый ответ`
-	respBodyCommandOpenAIImage = `🌄 Генерация изображений с помощью OpenAI 🌄
-Введите запрос как можно подробнее, чтобы получить наиболее удовлетворительное сгенерированное изображение`
-	respBodyCommandDreamBooth = `🌅 Выбрана генерация изображений с помощью DreamBooth 🌅
-⚠ Для лучшего результата ознакомьтесь с документацией https://stablediffusionapi.com/docs/community-models-api-v4/dreamboothtext2img#body-attributes ⚠
-📄 /dreamBoothExample - пример промпта для генерации изображения через API DreamBooth`
-	respBodyUndefinedJob = `❌ Не выбрана команда для выполнения задачи ❌
-🔧 /help - описание команд`
-	respBodyUndefinedCommand = `❌ Комманда не поддерживается ❌
-Чтобы посмотреть описание команд, введите команду /help`
-	respBodyAccessDenied             = `❌ Доступ запрещен ❌`
-	respBodyCommandDreamBoothExample = `prompt: Iron Man, (Arnold Tsang, Toru Nakayama), Masterpiece, Studio Quality, 6k , toa, toaair, 1boy, glowing, axe, mecha, science_fiction, solo, weapon, jungle , green_background, nature, outdoors, solo, tree, weapon, mask, dynamic lighting, detailed shading, digital texture painting
-negative_prompt: un-detailed skin, semi-realistic, cgi, 3d, render, sketch, cartoon, drawing, ugly eyes, (out of frame:1.3), worst quality, low quality, jpeg artifacts, cgi, sketch, cartoon, drawing, (out of frame:1.1)
-width: 512
-height: 512
-model_id: midjourney`
-	respBodyInputJobID = `📛 Введите номер запроса 📛
-📋 /listJobs - список выполняющихся запросов в очереди`
-	respBodyRequestAddedToQueue               = `✅ Запрос добавлен в очередь ✅`
-	respBodyStatsCommand                      = `☣ Здесь должен быть файл со статистикой запросов и ответов ☣`
-	respBodyCommandBan                        = `🌄 Введите имя пользователя для бана 🌄`
-	respBodyCommandUnban                      = `🌄 Введите имя пользователя для разбана 🌄`
-	respBodyRequestBan                        = `✅ Пользователь забанен ✅`
-	respBodyRequestUnban                      = `✅ Пользователь разбанен ✅`
-	respBodyCommandFusionBrain                = `🌅 Выбрана генерация изображений с помощью FusionBrain 🌅`
-	respErrBodyRequestBan                     = `❌ Произошла ошибка при бане пользователя ❌`
-	respErrBodyRequestUnban                   = `❌ Произошла ошибка при разбане пользователя ❌`
-	respErrBodyRequestUnbanUsernameIsNotExist = `❌ Пользователя нет в черном списке ❌`
-	respErrBodyRequestBanUsernameAlreadyExist = `❌ Пользователь уже есть в черном списке ❌`
-	respErrBodyLimitMessages                  = `❌ Сервис перегружен запросами ❌
-Пожалуйста, выполните запрос позже`
-	respErrBodyLimitJobs = `❌ Превышен лимит запросов ❌
-Пожалуйста, дождитесь выполнения прошлых и повторите`
-	respErrBodyInvalidFormatJobID = `❌ Номер задачи должен быть числом ❌`
-	respErrBodyChatGPT            = `❌ Произошла ошибка при генерации ответа ChatGPT ❌
-Попробуйте еще раз`
-	respErrBodyOpenAI = `❌ Произошла ошибка при генерации ответа OpenAI ❌
-Попробуйте еще раз`
-	respErrBodyDreamBoothByStatusCode = `❌ Произошла ошибка при генерации ответа DreamBooth ❌
-К сожалению, в данный момент сервис DreamBooth не работает, попробуйте выполнить запрос позже`
-	respErrBodyDreamBooth = `❌ Произошла ошибка при генерации изображения DreamBooth ❌
-Попробуйте еще раз`
-	respErrBodyFusionBrain = `❌ Произошла ошибка при генерации изображения FusionBrain ❌
-Попробуйте еще раз`
-	respErrBodyJobCanceled = `✅ Запрос был отменен ✅`
-	respErrBodyGetLogs     = `❌ Произошла ошибка при получении логов ❌`
+	respBodySessionIsAlreadyExist             = "session_is_already_exist"
+	respBodySessionCreated                    = "session_created"
+	respBodySessionRemoved                    = "session_removed"
+	respBodySessionIsNotExist                 = "session_is_not_exist"
+	respBodyCommandHelp                       = "command_help"
+	respBodyCommandChatGPT                    = "command_chatgpt"
+	respBodyCommandOpenAIText                 = "command_openai_text"
+	respBodyCommandOpenAIImage                = "command_openai_image"
+	respBodyCommandCompatibleText             = "command_compatible_text"
+	respBodyCommandCompatibleImage            = "command_compatible_image"
+	respBodyDescriptionCompatibleText         = "description_compatible_text"
+	respBodyDescriptionCompatibleImage        = "description_compatible_image"
+	respBodyCommandDreamBooth                 = "command_dreambooth"
+	respBodyCommandDreamBoothExample          = "command_dreambooth_example"
+	respBodyCommandFusionBrain                = "command_fusionbrain"
+	respBodyCommandBan                        = "command_ban"
+	respBodyCommandUnban                      = "command_unban"
+	respBodyCommandImageFormat                = "command_image_format"
+	respBodyCommandGroupCommands              = "command_group_commands"
+	respBodyCommandLanguage                   = "command_language"
+	respBodyCommandTopicCommand               = "command_topic_command"
+	respBodyHistoryReset                      = "history_reset"
+	respBodyCommandPersona                    = "command_persona"
+	respBodyCommandModel                      = "command_model"
+	respBodyStatsCommand                      = "stats_command"
+	respBodyStatsDropped                      = "stats_dropped"
+	respBodyInlineSwitchPM                    = "inline_switch_pm"
+	respBodyInputJobID                        = "input_job_id"
+	respBodyUndefinedJob                      = "undefined_job"
+	respBodyUndefinedCommand                  = "undefined_command"
+	respBodyAccessDenied                      = "access_denied"
+	respBodyRequestAddedToQueue               = "request_added_to_queue"
+	respBodyRequestBan                        = "request_ban"
+	respBodyRequestUnban                      = "request_unban"
+	respBodyStreamPlaceholder                 = "stream_placeholder"
+	respBodyAnswerSentAsFile                  = "answer_sent_as_file"
+	respBodyStaleMessage                      = "stale_message"
+	respBodyButtonDocumentSummary             = "button_document_summary"
+	respBodyButtonRerun                       = "button_rerun"
+	respBodyButtonTopicNone                   = "button_topic_none"
+	respBodyButtonPersonaNone                 = "button_persona_none"
+	respBodyGroupCommandEnabled               = "group_command_enabled"
+	respBodyGroupCommandDisabled              = "group_command_disabled"
+	respBodyImageFormatChanged                = "image_format_changed"
+	respBodyLanguageChanged                   = "language_changed"
+	respBodyPersonaChanged                    = "persona_changed"
+	respBodyPersonaCustom                     = "persona_custom"
+	respBodyPersonaReset                      = "persona_reset"
+	respBodyModelChanged                      = "model_changed"
+	respBodyTopicCommandBound                 = "topic_command_bound"
+	respBodyTopicCommandUnbound               = "topic_command_unbound"
+	respBodyLanguageName                      = "language_name"
+	respBodyJobQueued                         = "job_queued"
+	respBodyJobRunning                        = "job_running"
+	respBodyJobStartedAt                      = "job_started_at"
+	respBodyJobUpstreamStatus                 = "job_upstream_status"
+	respBodyJobElapsed                        = "job_elapsed"
+	respBodyJobFinished                       = "job_finished"
+	respBodyUpstreamETA                       = "upstream_eta"
+	respBodyJobCanceled                       = "job_canceled"
+	respBodyJobIsNotExist                     = "job_is_not_exist"
+	respBodyJobCancelSuccess                  = "job_cancel_success"
+	respBodyJobRestarted                      = "job_restarted"
+	respBodyJobEdited                         = "job_edited"
+	respBodyListJobs                          = "list_jobs"
+	respBodyBlacklist                         = "blacklist"
+	respBodyDocumentAttached                  = "document_attached"
+	respBodyTranscript                        = "transcript"
+	respErrBodyRequestBan                     = "err_request_ban"
+	respErrBodyRequestUnban                   = "err_request_unban"
+	respErrBodyRequestUnbanUsernameIsNotExist = "err_request_unban_username_is_not_exist"
+	respErrBodyRequestBanUsernameAlreadyExist = "err_request_ban_username_already_exist"
+	respErrBodyLimitMessages                  = "err_limit_messages"
+	respErrBodyLimitJobs                      = "err_limit_jobs"
+	respErrBodyInvalidFormatJobID             = "err_invalid_format_job_id"
+	respErrBodyChatGPT                        = "err_chatgpt"
+	respErrBodyOpenAI                         = "err_openai"
+	respErrBodyCompatible                     = "err_compatible"
+	respErrBodyDreamBoothByStatusCode         = "err_dreambooth_by_status_code"
+	respErrBodyDreamBooth                     = "err_dreambooth"
+	respErrBodyFusionBrain                    = "err_fusionbrain"
+	respErrBodyVoiceIsNotSupported            = "err_voice_is_not_supported"
+	respErrBodySpeechToText                   = "err_speech_to_text"
+	respErrBodyPhotoIsNotSupported            = "err_photo_is_not_supported"
+	respErrBodyPhotoCaptionIsEmpty            = "err_photo_caption_is_empty"
+	respErrBodyDownloadPhoto                  = "err_download_photo"
+	respErrBodyDocumentIsNotSupported         = "err_document_is_not_supported"
+	respErrBodyDocumentFormat                 = "err_document_format"
+	respErrBodyDocumentIsTooLarge             = "err_document_is_too_large"
+	respErrBodyDocument                       = "err_document"
+	respErrBodyCommandDisabledInGroup         = "err_command_disabled_in_group"
+	respErrBodyGroupOnly                      = "err_group_only"
+	respErrBodyGroupAdminOnly                 = "err_group_admin_only"
+	respErrBodyInvalidGroupCommand            = "err_invalid_group_command"
+	respErrBodyGroupCommands                  = "err_group_commands"
+	respErrBodyInvalidImageFormat             = "err_invalid_image_format"
+	respErrBodyInvalidLanguage                = "err_invalid_language"
+	respErrBodyPersonaIsTooLong               = "err_persona_is_too_long"
+	respErrBodyInvalidModel                   = "err_invalid_model"
+	respErrBodyModelsIsNotExist               = "err_models_is_not_exist"
+	respErrBodyLanguage                       = "err_language"
+	respErrBodyGetLogs                        = "err_get_logs"
+	respErrBodyRerunIsNotExist                = "err_rerun_is_not_exist"
+	respErrBodyTopicOnly                      = "err_topic_only"
+	respErrBodyInvalidTopicCommand            = "err_invalid_topic_command"
+	respErrBodyTopicCommands                  = "err_topic_commands"
+	respFileNameAnswer                        = "file_name_answer"
+	respFileNameStats                         = "file_name_stats"
+	respPromptDocumentQuestion                = "prompt_document_question"
+	respPromptDocumentSummary                 = "prompt_document_summary"
+	respPromptDocumentPartSummary             = "prompt_document_part_summary"
+	respConsoleStarted                        = "console_started"
+	respConsoleEdited                         = "console_edited"
 )
 
+// respBodyCommandDescriptionPrefix - описание команды в каталоге: description_<команда>
+const respBodyCommandDescriptionPrefix = "description_"
+
 var (
 	respBodyFusionBrainInput = []string{
-		`Напишите, какие цвета и приёмы модель должна использовать при генерации изображения.
-Например: Пушистый кот в очках`,
-		`Какие цвета и приёмы модель не должна использовать при генерации изображения? Введите -, чтобы не задавать
-Например: яркие цвета, кислотность, высокая контрастность`,
-		`Длина изображения (максимальная 1024), по-умолчанию 512. Введите 0, чтобы не задавать`,
-		`Ширина изображения (максимальная 1024), по-умолчанию 512. Введите 0, чтобы не задавать`,
-		`Стиль изображения (по-умолчанию будет DEFAULT). Введите *, чтобы не задавать
-Примеры:
-- KANDINSKY https://cdn.fusionbrain.ai/static/download/img-style-kandinsky.png
-- UHD https://cdn.fusionbrain.ai/static/download/img-style-detail-photo.png
-- ANIME https://cdn.fusionbrain.ai/static/download/img-style-anime.png
-- DEFAULT https://cdn.fusionbrain.ai/static/download/img-style-personal.png`,
+		"fusionbrain_input_prompt",
+		"fusionbrain_input_negative_prompt",
+		"fusionbrain_input_width",
+		"fusionbrain_input_height",
+		"fusionbrain_input_style",
 	}
 )
 
+// fusionBrainCaptionLabels - подписи полей запроса FusionBrain в порядке их ввода
+var fusionBrainCaptionLabels = []string{
+	"fusionbrain_caption_prompt",
+	"fusionbrain_caption_negative_prompt",
+	"fusionbrain_caption_width",
+	"fusionbrain_caption_height",
+	"fusionbrain_caption_style",
+}
+
+// statsHeaders - заголовки столбцов файла статистики
+var statsHeaders = []string{
+	"stats_header_time",
+	"stats_header_username",
+	"stats_header_ai",
+	"stats_header_request",
+	"stats_header_response",
+}
+
+// upstreamStatus - статус генерации на стороне AI, eta - ожидаемое время, если AI его сообщает
+type upstreamStatus struct {
+	api    string
+	status string
+	eta    time.Duration
+}
+
+func respBodyGroupCommandChanged(l localizer, command string, isEnabled bool) []byte {
+	if isEnabled {
+		return l.bytes(respBodyGroupCommandEnabled, "command", command)
+	}
+	return l.bytes(respBodyGroupCommandDisabled, "command", command)
+}
+
+func respBodyJobStatus(l localizer, startedAt time.Time, upstream upstreamStatus, elapsed time.Duration) string {
+	var b strings.Builder
+	b.WriteString(l.text(respBodyJobRunning) + "\n")
+	b.WriteString(l.text(respBodyJobStartedAt, "time", startedAt.Format(time.TimeOnly)) + "\n")
+	if upstream.status != "" {
+		b.WriteString(l.text(respBodyJobUpstreamStatus, "status", respBodyUpstreamStatus(l, upstream)) + "\n")
+	}
+	b.WriteString(l.text(respBodyJobElapsed, "elapsed", elapsed.Round(time.Second).String()))
+	return b.String()
+}
+
+func respBodyUpstreamStatus(l localizer, upstream upstreamStatus) string {
+	status := upstream.api + ": " + upstream.status
+	if upstream.eta <= 0 {
+		return status
+	}
+	return l.text(respBodyUpstreamETA, "status", status, "eta", upstream.eta.String())
+}
+
+func respBodyCaptionImage(api, prompt string) string {
+	var b strings.Builder
+	b.WriteString("🌅 ")
+	b.WriteString(api)
+	b.WriteString("\n")
+	b.WriteString(prompt)
+	return b.String()
+}
+
+func respBodyCaptionFusionBrain(l localizer, api, request string) string {
+	var b strings.Builder
+	b.WriteString("🌅 ")
+	b.WriteString(api)
+	for idx, row := range strings.Split(request, "\n") {
+		// незаданные поля: "-", "0", "*"
+		if idx >= len(fusionBrainCaptionLabels) || row == "" || row == "-" || row == "0" || row == "*" {
+			continue
+		}
+		b.WriteString("\n")
+		b.WriteString(l.text(fusionBrainCaptionLabels[idx]))
+		b.WriteString(": ")
+		b.WriteString(row)
+	}
+	return b.String()
+}
+
 func respErrBodyCommandDreamBooth(err error) string {
 	if errors.Is(err, errDBInvalidRespCode) {
 		return respErrBodyDreamBoothByStatusCode
@@ -91,77 +221,42 @@ func respErrBodyCommandDreamBooth(err error) string {
 	return respErrBodyDreamBooth
 }
 
-func respErrBodyJobIsNotExist(jobID int) []byte {
-	var b bytes.Buffer
-	b.WriteString("Задача №")
-	b.WriteString(strconv.Itoa(jobID))
-	b.WriteString(" не найдена")
-	return b.Bytes()
+func respBodyPartialJobCanceled(l localizer, partial []byte) []byte {
+	if len(partial) == 0 {
+		return l.bytes(respBodyJobCanceled)
+	}
+	return []byte(string(partial) + "\n\n" + l.text(respBodyJobCanceled))
 }
 
-func respBodySuccessCancelJob(api string, jobID int) []byte {
-	var b bytes.Buffer
-	b.WriteString("Задача ")
-	b.WriteString(api)
-	b.WriteString(" №")
-	b.WriteString(strconv.Itoa(jobID))
-	b.WriteString(" завершена.\n")
-	b.WriteString(respBodyInputJobID)
-	return b.Bytes()
+// apiJobIDs - запросы клиента к провайдерам с одной подписью
+type apiJobIDs struct {
+	api    string
+	jobIDs []int
 }
 
-func respBodyListJobs(textJobIDs, imgJobIDs, openAIIDs, fusionBrainIDs []int, role string) string {
+func respBodyListJobIDs(l localizer, jobs []apiJobIDs) string {
 	var b strings.Builder
-	b.WriteString("Список задач ChatGPT:\r\n")
-	for i := range textJobIDs {
-		b.WriteString(strconv.Itoa(textJobIDs[i]))
+	for _, job := range jobs {
+		b.WriteString(l.text(respBodyListJobs, "api", job.api, "count", len(job.jobIDs)))
 		b.WriteString("\r\n")
-	}
-	if role == roleAdmin {
-		b.WriteString("Список задач DreamBooth:\r\n")
-		for i := range imgJobIDs {
-			b.WriteString(strconv.Itoa(imgJobIDs[i]))
+		for i := range job.jobIDs {
+			b.WriteString(strconv.Itoa(job.jobIDs[i]))
 			b.WriteString("\r\n")
 		}
-		b.WriteString("Список задач OpenAI:\r\n")
-		for i := range openAIIDs {
-			b.WriteString(strconv.Itoa(openAIIDs[i]))
-			b.WriteString("\r\n")
-		}
-	}
-	b.WriteString("Список задач FusionBrain:\r\n")
-	for i := range fusionBrainIDs {
-		b.WriteString(strconv.Itoa(fusionBrainIDs[i]))
-		b.WriteString("\r\n")
 	}
 	return b.String()
 }
 
-func respBodyCommandHelp(role string) string {
+func respBodyCommandList(l localizer, commands []commandInfo) string {
 	var b strings.Builder
-	b.WriteString(`🔧 Доступные команды бота 🔧
-✅ /start - начало сессии с ботом
-⛔ /stop - завершение сессии с ботом
-📖 /chatGPT - генерация текста, используя API ресурса gpt-chatbot.ru (Модель gpt-4.0)
-🌅 /fusionBrain - продвинутая генерация изображений, используя API FusionBrain
-`)
-	if role == roleAdmin {
-		b.WriteString(`📖 /openAIText - генерация текста, используя API OpenAI (Модель gpt-4-32k-0613)
-🌄 /openAIImage - генерация изображения размером 1024x1024, используя API OpenAI
-🌅 /dreamBooth - продвинутая генерация изображений, используя API DreamBooth
-📄 /dreamBoothExample - пример промпта для генерации изображения через API DreamBooth
-`)
-	}
-	b.WriteString(`📛 /cancelJob - отмена текущего запроса по ее номеру
-📋 /listJobs - список выполняющихся запросов в очереди
-`)
-	if role == roleAdmin {
-		b.WriteString(`📈 /stats - статистика запросов и ответов всех пользователей в формате csv
-💻 /logs - логи сервиса
-👎 /ban - бан пользователя
-👍 /unban - разбан пользователя
-💩 /blacklist - список заблокированных пользователей
-`)
+	b.WriteString(l.text(respBodyCommandHelp) + "\n")
+	for idx := range commands {
+		b.WriteString(commands[idx].icon)
+		b.WriteString(" /")
+		b.WriteString(commands[idx].name)
+		b.WriteString(" - ")
+		b.WriteString(commands[idx].description)
+		b.WriteString("\n")
 	}
 	return b.String()
 }
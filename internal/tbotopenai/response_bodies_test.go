@@ -0,0 +1,45 @@
+package tbotopenai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRespBodyCaptionFusionBrain(t *testing.T) {
+	locales, err := loadLocales(&LocaleSettings{}, zap.NewNop())
+	assert.NoError(t, err)
+	l := localizer{locales: locales, lang: "en"}
+	tests := []struct {
+		name       string
+		request    string
+		expCaption string
+	}{
+		{
+			name:       "All fields are set",
+			request:    "cat\ndog\n1024\n768\nANIME",
+			expCaption: "🌅 Kandinsky\nPrompt: cat\nExclude: dog\nWidth: 1024\nHeight: 768\nStyle: ANIME",
+		},
+		{
+			name:       "Fields that are not set are skipped",
+			request:    "cat\n-\n0\n0\n*",
+			expCaption: "🌅 Kandinsky\nPrompt: cat",
+		},
+		{
+			name:       "Empty rows are skipped",
+			request:    "cat\n\n512",
+			expCaption: "🌅 Kandinsky\nPrompt: cat\nWidth: 512",
+		},
+		{
+			name:       "Rows without a label are skipped",
+			request:    "cat\n-\n0\n0\n*\nextra",
+			expCaption: "🌅 Kandinsky\nPrompt: cat",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expCaption, respBodyCaptionFusionBrain(l, "Kandinsky", tt.request))
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package tbotopenai
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Ограничения Telegram: около 30 сообщений в секунду для бота, 1 сообщение в секунду
+// в личный чат и 20 сообщений в минуту в группу
+const (
+	defaultSendWorkers       = 4
+	defaultSendQueueLen      = 1000
+	defaultSendGlobalRate    = 30
+	defaultSendGlobalBurst   = 30
+	defaultSendChatRate      = 1
+	defaultSendChatBurst     = 3
+	defaultSendGroupRate     = 20.0 / 60
+	defaultSendGroupBurst    = 3
+	defaultSendMaxRetries    = 5
+	defaultSendRetryInterval = time.Second
+	maxSendRetryInterval     = 30 * time.Second
+)
+
+var (
+	errSendQueueIsStopped = errors.New("Telegram send queue is stopped")
+	errSendQueueIsFull    = errors.New("Telegram send queue is full")
+)
+
+// sendJob - запрос к Telegram API; вызывающий ждет результат в errChan
+type sendJob struct {
+	chatID  int64
+	request func() error
+	errChan chan error
+}
+
+// tokenBucket - токен резервируется сразу, а ожидание до его появления возвращается вызывающему,
+// поэтому запросы получают токены в порядке обращения
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) reserve() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// chatQueue - запросы одного чата выполняются по очереди своей горутиной, поэтому ожидание лимита
+// чата и повтора после 429 задерживает только этот чат
+type chatQueue struct {
+	jobs      []*sendJob
+	isRunning bool
+}
+
+// sender - очередь исходящих запросов к Telegram с общим лимитом бота и лимитами чатов,
+// повтором после 429 (retry_after) и временных сетевых ошибок.
+// workers ограничивает число одновременных запросов к Bot API
+type sender struct {
+	log       *zap.Logger
+	cfg       SendQueueSettings
+	mutex     sync.Mutex
+	queues    map[int64]*chatQueue
+	queued    int
+	isStopped bool
+	workers   chan struct{}
+	stopChan  chan struct{}
+	global    *tokenBucket
+	chats     sync.Map
+	dropped   atomic.Int64
+	wg        sync.WaitGroup
+}
+
+func newSender(cfg SendQueueSettings, log *zap.Logger) *sender {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultSendWorkers
+	}
+	if cfg.QueueLen <= 0 {
+		cfg.QueueLen = defaultSendQueueLen
+	}
+	if cfg.GlobalRate <= 0 {
+		cfg.GlobalRate = defaultSendGlobalRate
+	}
+	if cfg.GlobalBurst <= 0 {
+		cfg.GlobalBurst = defaultSendGlobalBurst
+	}
+	if cfg.ChatRate <= 0 {
+		cfg.ChatRate = defaultSendChatRate
+	}
+	if cfg.ChatBurst <= 0 {
+		cfg.ChatBurst = defaultSendChatBurst
+	}
+	if cfg.GroupRate <= 0 {
+		cfg.GroupRate = defaultSendGroupRate
+	}
+	if cfg.GroupBurst <= 0 {
+		cfg.GroupBurst = defaultSendGroupBurst
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultSendMaxRetries
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultSendRetryInterval
+	}
+	return &sender{
+		log:      log,
+		cfg:      cfg,
+		queues:   make(map[int64]*chatQueue),
+		workers:  make(chan struct{}, cfg.Workers),
+		stopChan: make(chan struct{}),
+		global:   newTokenBucket(cfg.GlobalRate, cfg.GlobalBurst),
+	}
+}
+
+func (s *sender) Stop() {
+	s.mutex.Lock()
+	s.isStopped = true
+	s.mutex.Unlock()
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// do - ставит запрос в очередь чата и ждет его выполнения; chatID 0 - запрос без лимита чата
+func (s *sender) do(chatID int64, request func() error) error {
+	job := &sendJob{
+		chatID:  chatID,
+		request: request,
+		errChan: make(chan error, 1),
+	}
+	if err := s.push(job); err != nil {
+		s.drop(chatID, err)
+		return err
+	}
+	select {
+	case err := <-job.errChan:
+		return err
+	case <-s.stopChan:
+		return errSendQueueIsStopped
+	}
+}
+
+// send - отправка сообщения через очередь
+func (s *sender) send(bot *tgbotapi.BotAPI, chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var sent tgbotapi.Message
+	err := s.do(chatID, func() (err error) {
+		sent, err = bot.Send(c)
+		return
+	})
+	return sent, err
+}
+
+// push - добавляет запрос в очередь чата и запускает ее горутину, если очередь была пуста
+func (s *sender) push(job *sendJob) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.isStopped {
+		return errSendQueueIsStopped
+	}
+	if s.queued >= s.cfg.QueueLen {
+		return errSendQueueIsFull
+	}
+	queue, ok := s.queues[job.chatID]
+	if !ok {
+		queue = &chatQueue{}
+		s.queues[job.chatID] = queue
+	}
+	queue.jobs = append(queue.jobs, job)
+	s.queued++
+	if !queue.isRunning {
+		queue.isRunning = true
+		s.wg.Add(1)
+		go s.initChatQueueWorker(job.chatID, queue)
+	}
+	return nil
+}
+
+// pop - следующий запрос чата; пустая очередь удаляется, лимит чата остается в chats
+func (s *sender) pop(chatID int64, queue *chatQueue) (*sendJob, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(queue.jobs) == 0 {
+		queue.isRunning = false
+		delete(s.queues, chatID)
+		return nil, false
+	}
+	job := queue.jobs[0]
+	queue.jobs[0] = nil
+	queue.jobs = queue.jobs[1:]
+	s.queued--
+	return job, true
+}
+
+func (s *sender) initChatQueueWorker(chatID int64, queue *chatQueue) {
+	defer s.wg.Done()
+	for {
+		job, ok := s.pop(chatID, queue)
+		if !ok {
+			return
+		}
+		select {
+		case <-s.stopChan:
+			job.errChan <- errSendQueueIsStopped
+		default:
+			job.errChan <- s.process(job)
+		}
+	}
+}
+
+func (s *sender) process(job *sendJob) error {
+	var err error
+	for attempt := 0; attempt <= s.cfg.MaxRetries; attempt++ {
+		if !s.wait(s.reserveChat(job.chatID)) {
+			return errSendQueueIsStopped
+		}
+		if err = s.request(job); err == nil {
+			return nil
+		}
+		if errors.Is(err, errSendQueueIsStopped) {
+			return err
+		}
+		delay, retry := s.retryDelay(err, attempt)
+		if !retry {
+			break
+		}
+		s.log.Warn("Telegram send retry err:", zap.Error(err),
+			zap.Int64("chat_id", job.chatID),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay))
+		if !s.wait(delay) {
+			return errSendQueueIsStopped
+		}
+	}
+	s.drop(job.chatID, err)
+	return err
+}
+
+// request - выполняет запрос, заняв одно из workers мест и токен общего лимита
+func (s *sender) request(job *sendJob) error {
+	select {
+	case s.workers <- struct{}{}:
+	case <-s.stopChan:
+		return errSendQueueIsStopped
+	}
+	defer func() { <-s.workers }()
+	if !s.wait(s.global.reserve()) {
+		return errSendQueueIsStopped
+	}
+	return job.request()
+}
+
+// reserveChat - ожидание до токена лимита чата
+func (s *sender) reserveChat(chatID int64) time.Duration {
+	if chatID == 0 {
+		return 0
+	}
+	return s.chatBucket(chatID).reserve()
+}
+
+// chatBucket - у групп и каналов отрицательный chatID и более строгий лимит
+func (s *sender) chatBucket(chatID int64) *tokenBucket {
+	if val, ok := s.chats.Load(chatID); ok {
+		return val.(*tokenBucket)
+	}
+	bucket := newTokenBucket(s.cfg.ChatRate, s.cfg.ChatBurst)
+	if chatID < 0 {
+		bucket = newTokenBucket(s.cfg.GroupRate, s.cfg.GroupBurst)
+	}
+	val, _ := s.chats.LoadOrStore(chatID, bucket)
+	return val.(*tokenBucket)
+}
+
+// retryDelay - 429 повторяется через retry_after, ошибки сети и 5xx - с экспоненциальной задержкой,
+// остальные ошибки Telegram (разметка, права, удаленное сообщение) не повторяются
+func (s *sender) retryDelay(err error, attempt int) (time.Duration, bool) {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		switch {
+		case tgErr.Code == 429 && tgErr.RetryAfter > 0:
+			return time.Duration(tgErr.RetryAfter) * time.Second, true
+		case tgErr.Code == 429, tgErr.Code >= 500:
+			return s.backoff(attempt), true
+		}
+		return 0, false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return s.backoff(attempt), true
+	}
+	return 0, false
+}
+
+func (s *sender) backoff(attempt int) time.Duration {
+	delay := s.cfg.RetryInterval << attempt
+	if delay <= 0 || delay > maxSendRetryInterval {
+		delay = maxSendRetryInterval
+	}
+	return delay
+}
+
+func (s *sender) wait(delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stopChan:
+		return false
+	}
+}
+
+func (s *sender) drop(chatID int64, err error) {
+	s.log.Error("Telegram message dropped err:", zap.Error(err),
+		zap.Int64("chat_id", chatID),
+		zap.Int64("dropped_total", s.dropped.Add(1)))
+}
+
+// Dropped - количество сообщений, которые не удалось отправить
+func (s *sender) Dropped() int64 {
+	return s.dropped.Load()
+}
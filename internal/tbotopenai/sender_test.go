@@ -0,0 +1,96 @@
+package tbotopenai
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      float64
+		burst     float64
+		reserved  int
+		elapsed   time.Duration
+		expDelay  time.Duration
+		tolerance time.Duration
+	}{
+		{
+			name:     "Token from burst",
+			rate:     1,
+			burst:    3,
+			reserved: 2,
+			expDelay: 0,
+		},
+		{
+			name:      "Burst is exhausted",
+			rate:      1,
+			burst:     3,
+			reserved:  3,
+			expDelay:  time.Second,
+			tolerance: 10 * time.Millisecond,
+		},
+		{
+			name:      "Waiting requests are queued",
+			rate:      2,
+			burst:     1,
+			reserved:  3,
+			expDelay:  1500 * time.Millisecond,
+			tolerance: 10 * time.Millisecond,
+		},
+		{
+			name:     "Tokens are refilled",
+			rate:     1,
+			burst:    3,
+			reserved: 3,
+			elapsed:  2 * time.Second,
+			expDelay: 0,
+		},
+		{
+			name:     "Refill is limited by burst",
+			rate:     1,
+			burst:    2,
+			reserved: 2,
+			elapsed:  time.Hour,
+			expDelay: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.rate, tt.burst)
+			for i := 0; i < tt.reserved; i++ {
+				b.reserve()
+			}
+			b.last = b.last.Add(-tt.elapsed)
+			assert.InDelta(t, tt.expDelay, b.reserve(), float64(tt.tolerance))
+		})
+	}
+}
+
+func TestSender_ThrottledChatDoesNotBlockOthers(t *testing.T) {
+	s := newSender(SendQueueSettings{
+		Workers:    1,
+		GroupRate:  0.01,
+		GroupBurst: 1,
+	}, zap.NewNop())
+	defer s.Stop()
+	const groupChatID, privateChatID = -100, 100
+	request := func() error { return nil }
+	assert.NoError(t, s.do(groupChatID, request))
+	go func() {
+		_ = s.do(groupChatID, request)
+	}()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.do(privateChatID, request)
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "private chat waits for throttled group chat")
+	}
+}
@@ -0,0 +1,53 @@
+package tbotopenai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var errEmptyTranscript = errors.New("speech to text: empty transcript")
+
+// SpeechToText - провайдер распознавания речи
+type SpeechToText interface {
+	Transcribe(ctx context.Context, audio []byte, fileName string) (string, error)
+}
+
+// Whisper - распознавание речи через OpenAI Whisper или совместимый с ним сервер (base_url)
+type Whisper struct {
+	client   *openai.Client
+	model    string
+	language string
+}
+
+func NewWhisper(cfg *SpeechToTextSettings) *Whisper {
+	clientCfg := openai.DefaultConfig(cfg.Token)
+	if cfg.BaseURL != "" {
+		clientCfg.BaseURL = cfg.BaseURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = openai.Whisper1
+	}
+	return &Whisper{
+		client:   openai.NewClientWithConfig(clientCfg),
+		model:    model,
+		language: cfg.Language,
+	}
+}
+
+func (w *Whisper) Transcribe(ctx context.Context, audio []byte, fileName string) (string, error) {
+	resp, err := w.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    w.model,
+		FilePath: fileName,
+		Reader:   bytes.NewReader(audio),
+		Language: w.language,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Text), nil
+}
@@ -0,0 +1,246 @@
+package tbotopenai
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dm1trypon/go-telebot-open-ai/pkg/tgmarkdown"
+)
+
+const (
+	codeFence = "```"
+	// maxSplitMarkdownAttempts - сколько раз уменьшается длина частей Markdown, чтобы их HTML поместился в лимит
+	maxSplitMarkdownAttempts = 5
+)
+
+// textBlock - абзац или блок кода Markdown, который по возможности не разрывается между сообщениями
+type textBlock struct {
+	lines    []string
+	fence    string
+	isClosed bool
+}
+
+func (b *textBlock) String() string {
+	if b.fence == "" {
+		return strings.Join(b.lines, "\n")
+	}
+	var sb strings.Builder
+	sb.WriteString(b.fence)
+	for _, line := range b.lines {
+		sb.WriteString("\n")
+		sb.WriteString(line)
+	}
+	if b.isClosed {
+		sb.WriteString("\n" + codeFence)
+	}
+	return sb.String()
+}
+
+func (b *textBlock) split(limit int) []string {
+	body := b.String()
+	if lenUTF16(body) <= limit {
+		return []string{body}
+	}
+	if b.fence == "" {
+		return splitLines(b.lines, "", "", limit)
+	}
+	// каждая часть блока кода открывается и закрывается заново, чтобы не ломать разметку
+	return splitLines(b.lines, b.fence+"\n", "\n"+codeFence, limit)
+}
+
+// splitText - разбивает текст на пронумерованные части не длиннее maxLen.
+// Разбиение идет по границам абзацев и блоков кода, затем по строкам и символам.
+func splitText(text string, maxLen int) []string {
+	if lenUTF16(text) <= maxLen {
+		return []string{text}
+	}
+	// длина номера зависит от числа частей, а число частей - от места, оставшегося после номера
+	count := 2
+	for {
+		limit := maxLen - lenPartNumber(count)
+		if limit <= 0 {
+			// номер части не помещается в сообщение, части не нумеруются
+			return splitBlocks(text, maxLen)
+		}
+		parts := splitBlocks(text, limit)
+		if lenPartNumber(len(parts)) > lenPartNumber(count) {
+			count = len(parts)
+			continue
+		}
+		for i := range parts {
+			parts[i] = "[" + strconv.Itoa(i+1) + "/" + strconv.Itoa(len(parts)) + "]\n" + parts[i]
+		}
+		return parts
+	}
+}
+
+// lenPartNumber - длина номера части вида "[12/34]\n" при count частях
+func lenPartNumber(count int) int {
+	return 2*len(strconv.Itoa(count)) + len("[/]\n")
+}
+
+func splitBlocks(text string, limit int) []string {
+	pieces := make([]string, 0)
+	for _, block := range parseTextBlocks(text) {
+		pieces = append(pieces, block.split(limit)...)
+	}
+	return joinPieces(pieces, limit)
+}
+
+// splitMarkdown - разбивает Markdown на части, HTML которых с тегами и экранированием не длиннее maxLen;
+// если HTML части не помещается, текст разбивается заново на части меньшей длины
+func splitMarkdown(text string, maxLen int) []string {
+	limit := maxLen
+	parts := splitText(text, limit)
+	for i := 0; i < maxSplitMarkdownAttempts; i++ {
+		var maxLenHTML int
+		for _, part := range parts {
+			if n := lenUTF16(tgmarkdown.ToHTML(part)); n > maxLenHTML {
+				maxLenHTML = n
+			}
+		}
+		if maxLenHTML <= maxLen {
+			break
+		}
+		limit = limit * maxLen / maxLenHTML
+		if limit <= lenPartNumber(len(parts)) {
+			break
+		}
+		parts = splitText(text, limit)
+	}
+	return parts
+}
+
+func parseTextBlocks(text string) []*textBlock {
+	text = strings.ReplaceAll(text, "\r", "")
+	blocks := make([]*textBlock, 0)
+	cur := &textBlock{}
+	flush := func() {
+		if len(cur.lines) > 0 || cur.fence != "" {
+			blocks = append(blocks, cur)
+		}
+		cur = &textBlock{}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case cur.fence != "":
+			if trimmed == codeFence {
+				cur.isClosed = true
+				flush()
+				continue
+			}
+			cur.lines = append(cur.lines, line)
+		case strings.HasPrefix(trimmed, codeFence):
+			flush()
+			cur.fence = line
+		case trimmed == "":
+			flush()
+		default:
+			cur.lines = append(cur.lines, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func splitLines(lines []string, prefix, suffix string, limit int) []string {
+	available := limit - lenUTF16(prefix) - lenUTF16(suffix)
+	if available <= 0 {
+		// ограждение блока кода не помещается в часть
+		prefix, suffix, available = "", "", limit
+	}
+	parts := make([]string, 0)
+	cur := make([]string, 0)
+	var curLen int
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		parts = append(parts, prefix+strings.Join(cur, "\n")+suffix)
+		cur = make([]string, 0)
+		curLen = 0
+	}
+	for _, line := range lines {
+		for _, piece := range splitRunes(line, available) {
+			pieceLen := lenUTF16(piece)
+			if len(cur) > 0 && curLen+1+pieceLen > available {
+				flush()
+			}
+			if len(cur) > 0 {
+				curLen++
+			}
+			cur = append(cur, piece)
+			curLen += pieceLen
+		}
+	}
+	flush()
+	return parts
+}
+
+// splitRunes - разбивает строку на части не длиннее limit, не разрывая символы UTF-8
+func splitRunes(s string, limit int) []string {
+	if lenUTF16(s) <= limit {
+		return []string{s}
+	}
+	parts := make([]string, 0)
+	var (
+		start  int
+		curLen int
+	)
+	for idx, r := range s {
+		runeLen := lenUTF16(string(r))
+		if curLen+runeLen > limit {
+			parts = append(parts, s[start:idx])
+			start = idx
+			curLen = 0
+		}
+		curLen += runeLen
+	}
+	return append(parts, s[start:])
+}
+
+func joinPieces(pieces []string, limit int) []string {
+	parts := make([]string, 0)
+	var b strings.Builder
+	var curLen int
+	for _, piece := range pieces {
+		pieceLen := lenUTF16(piece)
+		if b.Len() > 0 && curLen+2+pieceLen > limit {
+			parts = append(parts, b.String())
+			b.Reset()
+			curLen = 0
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+			curLen += 2
+		}
+		b.WriteString(piece)
+		curLen += pieceLen
+	}
+	if b.Len() > 0 {
+		parts = append(parts, b.String())
+	}
+	return parts
+}
+
+// lenUTF16 - длина текста так, как ее считает Telegram (в кодовых единицах UTF-16)
+func lenUTF16(s string) int {
+	var n int
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// truncateText - обрезает текст до maxLen, не разрывая символы UTF-8
+func truncateText(text string, maxLen int) string {
+	if lenUTF16(text) <= maxLen {
+		return text
+	}
+	return splitRunes(text, maxLen-1)[0] + "…"
+}
@@ -0,0 +1,134 @@
+package tbotopenai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dm1trypon/go-telebot-open-ai/pkg/tgmarkdown"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxLen   int
+		expParts []string
+	}{
+		{
+			name:     "Short text is not split",
+			text:     "first paragraph\n\nsecond paragraph",
+			maxLen:   100,
+			expParts: []string{"first paragraph\n\nsecond paragraph"},
+		},
+		{
+			name:   "Text is split by paragraphs",
+			text:   "first paragraph\n\nsecond paragraph",
+			maxLen: 30,
+			expParts: []string{
+				"[1/2]\nfirst paragraph",
+				"[2/2]\nsecond paragraph",
+			},
+		},
+		{
+			name:   "Each part of a code block is closed",
+			text:   "```go\n" + strings.Repeat("line\n", 8) + "```",
+			maxLen: 40,
+			expParts: []string{
+				"[1/2]\n```go\nline\nline\nline\nline\nline\n```",
+				"[2/2]\n```go\nline\nline\nline\n```",
+			},
+		},
+		{
+			name:   "Cyrillic is split by characters",
+			text:   strings.Repeat("я", 30),
+			maxLen: 24,
+			expParts: []string{
+				"[1/2]\n" + strings.Repeat("я", 18),
+				"[2/2]\n" + strings.Repeat("я", 12),
+			},
+		},
+		{
+			name:   "Number of parts takes two digits",
+			text:   strings.Repeat("a", 73),
+			maxLen: 14,
+			expParts: []string{
+				"[1/13]\naaaaaa", "[2/13]\naaaaaa", "[3/13]\naaaaaa", "[4/13]\naaaaaa",
+				"[5/13]\naaaaaa", "[6/13]\naaaaaa", "[7/13]\naaaaaa", "[8/13]\naaaaaa",
+				"[9/13]\naaaaaa", "[10/13]\naaaaaa", "[11/13]\naaaaaa", "[12/13]\naaaaaa",
+				"[13/13]\na",
+			},
+		},
+		{
+			name:     "Number of a part does not fit",
+			text:     "abcdefgh",
+			maxLen:   5,
+			expParts: []string{"abcde", "fgh"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := splitText(tt.text, tt.maxLen)
+			assert.Equal(t, tt.expParts, parts)
+			for _, part := range parts {
+				assert.LessOrEqual(t, lenUTF16(part), tt.maxLen)
+			}
+		})
+	}
+}
+
+func TestLenUTF16(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		expLen int
+	}{
+		{name: "Empty", text: "", expLen: 0},
+		{name: "ASCII", text: "hello", expLen: 5},
+		{name: "Cyrillic is one unit per character", text: "привет", expLen: 6},
+		{name: "Emoji outside BMP is two units", text: "😀", expLen: 2},
+		{name: "Mixed", text: "ok 👍🏻", expLen: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expLen, lenUTF16(tt.text))
+		})
+	}
+}
+
+func TestSplitMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxLen   int
+		expParts int
+	}{
+		{
+			name:     "Short text is not split",
+			text:     "**bold** & <tag>",
+			maxLen:   100,
+			expParts: 1,
+		},
+		{
+			name:     "Escaped characters do not fit in one part",
+			text:     strings.Repeat("a < b & c\n", 30),
+			maxLen:   200,
+			expParts: 3,
+		},
+		{
+			name:     "Tags of a code block do not fit in one part",
+			text:     "```go\n" + strings.Repeat("x := a && b\n", 40) + "```",
+			maxLen:   300,
+			expParts: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := splitMarkdown(tt.text, tt.maxLen)
+			assert.GreaterOrEqual(t, len(parts), tt.expParts)
+			for _, part := range parts {
+				assert.LessOrEqual(t, lenUTF16(tgmarkdown.ToHTML(part)), tt.maxLen)
+			}
+		})
+	}
+}
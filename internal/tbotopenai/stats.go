@@ -10,10 +10,6 @@ import (
 	"go.uber.org/zap"
 )
 
-const fileNameStats = "Статистика_запросов.csv"
-
-var csvHeader = []string{"Время", "Имя пользователя", "AI", "Запрос", "Ответ"}
-
 type statRow struct {
 	ts       string
 	username string
@@ -45,16 +41,18 @@ func (s *statRows) Flush() {
 type Stats struct {
 	ticker   *time.Ticker
 	filepath string
+	header   []string
 	rows     statRows
 	buf      []byte
 	quitChan chan struct{}
 	log      *zap.Logger
 }
 
-func NewStats(log *zap.Logger, interval time.Duration, filepath string) *Stats {
+func NewStats(log *zap.Logger, interval time.Duration, filepath string, header []string) *Stats {
 	return &Stats{
 		ticker:   time.NewTicker(interval),
 		filepath: filepath,
+		header:   header,
 		quitChan: make(chan struct{}, 1),
 		log:      log,
 	}
@@ -71,7 +69,7 @@ func (s *Stats) Run(wg *sync.WaitGroup) error {
 			return err
 		}
 		w := csv.NewWriter(file)
-		if err = w.Write(csvHeader); err != nil {
+		if err = w.Write(s.header); err != nil {
 			return err
 		}
 		w.Flush()
@@ -140,3 +138,12 @@ func (s *Stats) Write(row statRow) {
 func (s *Stats) Bytes() []byte {
 	return s.buf
 }
+
+// statsHeader - заголовки столбцов на языке по умолчанию; файл общий для всех пользователей
+func statsHeader(l *locales) []string {
+	header := make([]string, 0, len(statsHeaders))
+	for _, id := range statsHeaders {
+		header = append(header, l.text(l.defaultLang, id))
+	}
+	return header
+}
@@ -0,0 +1,53 @@
+package tbotopenai
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStreamEditInterval = 1500 * time.Millisecond
+	streamCursor              = " ▌"
+)
+
+// generateText - генерация текста. Если потоковая передача включена и AI ее поддерживает,
+// клиенту отправляется сообщение-заглушка, которое редактируется по мере генерации ответа.
+// Возвращает ответ и номер сообщения-заглушки (0, если заглушка не отправлялась).
+func (t *TBotOpenAI) generateText(ctx context.Context, ai AI, req *aiRequest, msg *message) ([]byte, int, error) {
+	streamer, ok := ai.(TextStreamer)
+	if !ok || !t.cfg.Stream.Enabled {
+		body, err := ai.GenerateText(ctx, req)
+		return body, 0, err
+	}
+	placeholderID, err := t.telegram.ReplyEditableText(msg.messageID, msg.chatID,
+		t.localizer(msg.userID).text(respBodyStreamPlaceholder))
+	if err != nil {
+		t.log.Error("Reply stream placeholder err:", zap.Error(err))
+		body, err := ai.GenerateText(ctx, req)
+		return body, 0, err
+	}
+	interval := t.cfg.Stream.EditInterval
+	if interval <= 0 {
+		interval = defaultStreamEditInterval
+	}
+	var b strings.Builder
+	lastEdit := time.Now()
+	body, err := streamer.GenerateTextStream(ctx, req, func(delta string) {
+		b.WriteString(delta)
+		if time.Since(lastEdit) < interval {
+			return
+		}
+		preview := b.String() + streamCursor
+		if lenUTF16(preview) > maxLenMessage {
+			return
+		}
+		lastEdit = time.Now()
+		if err := t.telegram.EditText(placeholderID, msg.chatID, preview); err != nil {
+			t.log.Error("Edit stream message err:", zap.Error(err))
+		}
+	})
+	return body, placeholderID, err
+}
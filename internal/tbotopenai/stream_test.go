@@ -0,0 +1,137 @@
+package tbotopenai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const testPlaceholderID = 100
+
+var errTestReply = errors.New("reply error")
+
+// testMessenger - Messenger, запоминающий отправленные и отредактированные сообщения
+type testMessenger struct {
+	Messenger
+	replyErr error
+	replies  []string
+	edits    []string
+}
+
+func (m *testMessenger) ReplyText(_ int, _ int64, text string) error {
+	m.replies = append(m.replies, text)
+	return nil
+}
+
+func (m *testMessenger) ReplyEditableText(_ int, _ int64, text string) (int, error) {
+	if m.replyErr != nil {
+		return 0, m.replyErr
+	}
+	m.replies = append(m.replies, text)
+	return testPlaceholderID, nil
+}
+
+func (m *testMessenger) EditText(messageID int, _ int64, text string) error {
+	if messageID != testPlaceholderID {
+		return errors.New("unknown message")
+	}
+	m.edits = append(m.edits, text)
+	return nil
+}
+
+// testAI - AI без потоковой передачи
+type testAI struct {
+	deltas []string
+}
+
+func (a *testAI) GenerateText(_ context.Context, _ *aiRequest) ([]byte, error) {
+	return []byte(strings.Join(a.deltas, "")), nil
+}
+
+func (a *testAI) GenerateImage(_ context.Context, _ *aiRequest) ([]imageFile, error) {
+	return nil, nil
+}
+
+// testStreamAI - AI с потоковой передачей ответа частями deltas
+type testStreamAI struct {
+	testAI
+}
+
+func (a *testStreamAI) GenerateTextStream(_ context.Context, _ *aiRequest, onDelta func(delta string)) ([]byte, error) {
+	for _, delta := range a.deltas {
+		time.Sleep(time.Millisecond)
+		onDelta(delta)
+	}
+	return []byte(strings.Join(a.deltas, "")), nil
+}
+
+func TestTBotOpenAI_GenerateText(t *testing.T) {
+	deltas := []string{"Hello", ", ", "world"}
+	tests := []struct {
+		name             string
+		ai               AI
+		stream           StreamSettings
+		replyErr         error
+		expPlaceholderID int
+		expEdits         []string
+	}{
+		{
+			name:   "Streaming is disabled",
+			ai:     &testStreamAI{testAI{deltas: deltas}},
+			stream: StreamSettings{Enabled: false},
+		},
+		{
+			name:   "AI does not support streaming",
+			ai:     &testAI{deltas: deltas},
+			stream: StreamSettings{Enabled: true},
+		},
+		{
+			name:             "Placeholder is edited on every part",
+			ai:               &testStreamAI{testAI{deltas: deltas}},
+			stream:           StreamSettings{Enabled: true, EditInterval: time.Nanosecond},
+			expPlaceholderID: testPlaceholderID,
+			expEdits:         []string{"Hello" + streamCursor, "Hello, " + streamCursor, "Hello, world" + streamCursor},
+		},
+		{
+			name:             "Edits are throttled by the interval",
+			ai:               &testStreamAI{testAI{deltas: deltas}},
+			stream:           StreamSettings{Enabled: true, EditInterval: time.Hour},
+			expPlaceholderID: testPlaceholderID,
+		},
+		{
+			name:     "Answer is generated without streaming when the placeholder is not sent",
+			ai:       &testStreamAI{testAI{deltas: deltas}},
+			stream:   StreamSettings{Enabled: true, EditInterval: time.Nanosecond},
+			replyErr: errTestReply,
+		},
+	}
+	locales, err := loadLocales(&LocaleSettings{}, zap.NewNop())
+	assert.NoError(t, err)
+	msg := &message{chatID: 1, userID: 1, messageID: 1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &testMessenger{replyErr: tt.replyErr}
+			bot := &TBotOpenAI{
+				cfg:      &Config{Stream: tt.stream},
+				telegram: m,
+				locales:  locales,
+				log:      zap.NewNop(),
+			}
+			body, placeholderID, err := bot.generateText(context.Background(), tt.ai, &aiRequest{prompt: "prompt"}, msg)
+			assert.NoError(t, err)
+			assert.Equal(t, "Hello, world", string(body))
+			assert.Equal(t, tt.expPlaceholderID, placeholderID)
+			if tt.expPlaceholderID != 0 {
+				assert.Equal(t, []string{bot.localizer(msg.userID).text(respBodyStreamPlaceholder)}, m.replies)
+			} else {
+				assert.Empty(t, m.replies)
+			}
+			assert.Equal(t, tt.expEdits, m.edits)
+		})
+	}
+}
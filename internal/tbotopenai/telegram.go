@@ -1,37 +1,168 @@
 package tbotopenai
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/valyala/fasthttp"
 )
 
-// NewUpdate gets updates since the last Offset
+// updaterOffset - номер обработанного обновления не сохранен: getUpdates без offset возвращает
+// все неподтвержденные обновления
 const updaterOffset = 0
 
+// maxLenMessage - максимальная длина текста сообщения Telegram в символах
+const maxLenMessage = 4096
+
+const (
+	// maxLenCaption - максимальная длина подписи к фото
+	maxLenCaption = 1024
+	// maxLenMediaGroup - максимальное количество фото в альбоме
+	maxLenMediaGroup = 10
+	// maxLenInlineDescription - длина описания варианта ответа на inline-запрос
+	maxLenInlineDescription = 100
+)
+
+const (
+	fileNameVoice = "voice.oga"
+	fileNameAudio = "audio.mp3"
+	fileNamePhoto = "photo.jpg"
+)
+
+var (
+	errInlineCacheChatIDIsEmpty    = errors.New("Telegram inline_cache_chat_id is empty")
+	errInlinePhotoIsNotUploaded    = errors.New("Telegram inline photo is not uploaded")
+	errDownloadFileInvalidRespCode = errors.New("Telegram download file response status code is not 200")
+	errDownloadFileRespBodyIsEmpty = errors.New("Telegram download file empty response body")
+)
+
+const errTelegramParseEntities = "can't parse entities"
+
+// errInvalidFormatting - Telegram не принял разметку сообщения
+var errInvalidFormatting = errors.New("Telegram rejected message formatting")
+
 type message struct {
-	chatID    int64
-	messageID int
-	text      string
-	command   string
-	username  string
+	chatID     int64
+	userID     int64
+	messageID  int
+	text       string
+	command    string
+	username   string
+	callbackID string
+	voice      *attachment
+	photo      *attachment
+	document   *attachment
+	// inlineQueryID - запрос из inline-режима (@bot <запрос>), ответ на него отправляется через AnswerInlineQuery
+	inlineQueryID string
+	// progress - сообщение о статусе запроса в очереди
+	progress *jobProgress
+	// replyTo - сообщение бота, на которое ответил клиент
+	replyTo *replyRef
+	// taskCommand - команда задачи, фиксируется при постановке запроса в очередь
+	taskCommand string
+	// languageCode - язык клиента Telegram пользователя (IETF)
+	languageCode string
+	// isStale - сообщение отправлено, пока бот был недоступен: клиенту отправляется просьба повторить запрос
+	isStale bool
+	// isEdited - клиент отредактировал отправленное ранее сообщение messageID
+	isEdited bool
+	// threadID - тема форума супергруппы (message_thread_id), 0 - сообщение не в теме
+	threadID int
+	// job - запрос, который отменяется и выполняется заново при редактировании сообщения
+	job *editableJob
+	// ack - вызывается, когда сообщение обработано, в том числе выполнен его запрос из очереди
+	ack func()
+	// isQueued - сообщение передано в очередь запросов и подтверждается после их выполнения
+	isQueued bool
+	// isInQueue - сообщение создано обработчиком очереди, его запрос выполняется в этом же обработчике
+	isInQueue bool
+}
+
+func (m *message) session() sessionKey {
+	return sessionKey{chatID: m.chatID, userID: m.userID}
 }
 
+// followUp - копия сообщения с текстом вместо вложения: расшифровка голосового сообщения или подпись к документу;
+// подтверждается исходное сообщение, а запрос копии выполняется в том же обработчике очереди
+func (m *message) followUp(text string) *message {
+	f := *m
+	f.text, f.voice, f.photo, f.document = text, nil, nil, nil
+	f.ack, f.isQueued, f.isInQueue = nil, false, true
+	f.progress, f.job = nil, nil
+	return &f
+}
+
+// done - сообщение обработано, подтверждение вызывается один раз
+func (m *message) done() {
+	if m.ack != nil {
+		m.ack()
+		m.ack = nil
+	}
+}
+
+// attachment - файл из сообщения клиента, скачивается через Messenger.DownloadFile
+type attachment struct {
+	fileID   string
+	fileName string
+	fileSize int
+}
+
+// inlineResult - вариант ответа на inline-запрос: текст или изображение
+type inlineResult struct {
+	title string
+	text  string
+	image *imageFile
+}
+
+type keyboardButton struct {
+	text string
+	data string
+}
+
+type keyboard [][]keyboardButton
+
 type Messenger interface {
 	Run()
 	Stop()
 	ReplyText(int, int64, string) error
 	ReplyFile(int, int64, []byte, string) error
+	ReplyKeyboard(int, int64, string, keyboard) error
+	ReplyEditableText(int, int64, string) (int, error)
+	EditText(int, int64, string) error
+	ReplyHTML(int, int64, string) error
+	EditHTML(int, int64, string) error
+	ReplyPhoto(int, int64, []byte, string, string) error
+	ReplyMediaGroup(int, int64, []imageFile, string) error
+	DownloadFile(string) ([]byte, error)
+	IsChatAdmin(int64, int64) (bool, error)
+	AnswerInlineQuery(string, []inlineResult, string) error
+	SetCommands(sessionKey, string, []commandInfo) error
+	SendChatAction(int, int64, string) error
+	DroppedMessages() int64
 }
 
 type Telegram struct {
-	bot          *tgbotapi.BotAPI
-	updateConfig tgbotapi.UpdateConfig
-	updateChan   tgbotapi.UpdatesChannel
-	log          *zap.Logger
-	msgChan      chan<- *message
+	bot           *tgbotapi.BotAPI
+	sender        *sender
+	cacheChatID   int64
+	updateConfig  tgbotapi.UpdateConfig
+	updateChan    <-chan telegramUpdate
+	stopChan      chan struct{}
+	flushStopChan chan struct{}
+	topics        messageTopics
+	webhook       *Webhook
+	replies       sentReplies
+	offset        *updateOffset
+	stale         StaleUpdatesSettings
+	startedAt     time.Time
+	log           *zap.Logger
+	msgChan       chan<- *message
 }
 
 func NewTelegram(cfg *TelegramSettings, log *zap.Logger, msgChan chan<- *message) (*Telegram, error) {
@@ -40,21 +171,84 @@ func NewTelegram(cfg *TelegramSettings, log *zap.Logger, msgChan chan<- *message
 		return nil, err
 	}
 	bot.Debug = cfg.Debug
-	updateConfig := tgbotapi.NewUpdate(updaterOffset)
-	updateConfig.Timeout = cfg.Timeout
-	updateChan := bot.GetUpdatesChan(updateConfig)
-	return &Telegram{bot, updateConfig, updateChan, log, msgChan}, nil
+	offset, err := loadUpdateOffset(cfg.PathUpdateOffset)
+	if err != nil {
+		return nil, err
+	}
+	t := &Telegram{
+		bot:         bot,
+		offset:      offset,
+		stale:       cfg.StaleUpdates,
+		startedAt:   time.Now(),
+		sender:      newSender(cfg.SendQueue, log),
+		cacheChatID: cfg.InlineCacheChatID,
+		log:         log,
+		msgChan:     msgChan,
+		stopChan:    make(chan struct{}),
+		// flushStopChan - stopChan закрывается только в режиме polling
+		flushStopChan: make(chan struct{}),
+	}
+	switch cfg.Mode {
+	case "", telegramModePolling:
+		if err = deleteWebhook(bot); err != nil {
+			return nil, err
+		}
+		t.updateConfig = tgbotapi.NewUpdate(offset.next())
+		t.updateConfig.Timeout = cfg.Timeout
+		updateChan := make(chan telegramUpdate, bot.Buffer)
+		go t.pollUpdates(t.updateConfig, updateChan)
+		t.updateChan = updateChan
+	case telegramModeWebhook:
+		if t.webhook, err = NewWebhook(&cfg.Webhook, log, bot.Buffer); err != nil {
+			return nil, err
+		}
+		if err = setWebhook(bot, &cfg.Webhook); err != nil {
+			return nil, err
+		}
+		t.updateChan = t.webhook.Updates()
+	default:
+		return nil, errUnsupportedTelegramMode
+	}
+	return t, nil
 }
 
 func (t *Telegram) Run() {
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go t.initReadingMessagesWorker(&wg)
+	go t.initFlushOffsetWorker()
+	if t.webhook != nil {
+		t.webhook.Run()
+	}
 	wg.Wait()
 }
 
 func (t *Telegram) Stop() {
-	t.bot.StopReceivingUpdates()
+	if t.webhook != nil {
+		t.webhook.Stop()
+	} else {
+		close(t.stopChan)
+	}
+	close(t.flushStopChan)
+	if err := t.offset.flush(); err != nil {
+		t.log.Error("Write update offset err:", zap.Error(err))
+	}
+	t.sender.Stop()
+}
+
+func (t *Telegram) initFlushOffsetWorker() {
+	ticker := time.NewTicker(offsetFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.flushStopChan:
+			return
+		case <-ticker.C:
+			if err := t.offset.flush(); err != nil {
+				t.log.Error("Write update offset err:", zap.Error(err))
+			}
+		}
+	}
 }
 
 func (t *Telegram) initReadingMessagesWorker(wg *sync.WaitGroup) {
@@ -70,24 +264,224 @@ func (t *Telegram) initReadingMessagesWorker(wg *sync.WaitGroup) {
 			if !ok {
 				return
 			}
-			if update.Message == nil || update.Message.Chat == nil {
+			if !t.offset.begin(update.UpdateID) {
+				t.log.Warn("Skip duplicate update", zap.Int("update_id", update.UpdateID))
 				continue
 			}
-			t.msgChan <- &message{
-				chatID:    update.Message.Chat.ID,
-				messageID: update.Message.MessageID,
-				text:      update.Message.Text,
-				command:   update.Message.Command(),
-				username:  update.Message.From.UserName,
+			msg := t.processUpdate(&update)
+			if msg == nil {
+				t.offset.done(update.UpdateID)
+				continue
+			}
+			updateID := update.UpdateID
+			// номер обновления сохраняется после того, как бот обработает сообщение
+			msg.ack = func() {
+				t.offset.done(updateID)
 			}
+			t.msgChan <- msg
+		}
+	}
+}
+
+// processUpdate - сообщение для бота из обновления, nil - обновление не требует обработки
+func (t *Telegram) processUpdate(update *telegramUpdate) *message {
+	switch {
+	case update.Message != nil && update.Message.Chat != nil && update.Message.From != nil:
+		isGroup := update.Message.Chat.IsGroup() || update.Message.Chat.IsSuperGroup()
+		if isGroup && !t.isAddressedToBot(update.Message) {
+			return nil
 		}
+		t.topics.store(update.Message.Chat.ID, update.Message.MessageID, update.threadID)
+		if isStale, notify := t.checkStaleMessage(update.Message); isStale {
+			return notify
+		}
+		return t.newMessage(update.Message, update.threadID)
+	case update.EditedMessage != nil && update.EditedMessage.Chat != nil && update.EditedMessage.From != nil:
+		isGroup := update.EditedMessage.Chat.IsGroup() || update.EditedMessage.Chat.IsSuperGroup()
+		if isGroup && !t.isAddressedToBot(update.EditedMessage) {
+			return nil
+		}
+		msg := t.newMessage(update.EditedMessage, update.threadID)
+		msg.isEdited = true
+		return msg
+	case update.InlineQuery != nil && update.InlineQuery.From != nil:
+		return &message{
+			chatID:        update.InlineQuery.From.ID,
+			userID:        update.InlineQuery.From.ID,
+			text:          strings.TrimSpace(update.InlineQuery.Query),
+			username:      update.InlineQuery.From.UserName,
+			inlineQueryID: update.InlineQuery.ID,
+			languageCode:  update.InlineQuery.From.LanguageCode,
+		}
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat != nil:
+		return t.processCallbackQuery(update.CallbackQuery, update.threadID)
+	}
+	return nil
+}
+
+func (t *Telegram) newMessage(msg *tgbotapi.Message, threadID int) *message {
+	return &message{
+		chatID:       msg.Chat.ID,
+		userID:       msg.From.ID,
+		messageID:    msg.MessageID,
+		text:         t.messageText(msg),
+		command:      msg.Command(),
+		username:     msg.From.UserName,
+		voice:        voiceAttachment(msg),
+		photo:        photoAttachment(msg),
+		document:     documentAttachment(msg),
+		replyTo:      t.replyTo(msg),
+		languageCode: msg.From.LanguageCode,
+		threadID:     threadID,
+	}
+}
+
+// checkStaleMessage - сообщения, отправленные пока бот был недоступен, по политике stale_updates
+// обрабатываются, пропускаются или получают ответ с просьбой повторить запрос (сообщение notify)
+func (t *Telegram) checkStaleMessage(msg *tgbotapi.Message) (bool, *message) {
+	if t.stale.Policy == "" || t.stale.Policy == staleUpdatesProcess {
+		return false, nil
+	}
+	if !isStaleMessage(msg.Time(), t.startedAt, t.stale.MaxAge) {
+		return false, nil
+	}
+	t.log.Info("Skip stale message",
+		zap.Int64("chat_id", msg.Chat.ID),
+		zap.Time("date", msg.Time()))
+	if t.stale.Policy == staleUpdatesNotify && msg.From != nil {
+		return true, &message{
+			chatID:       msg.Chat.ID,
+			userID:       msg.From.ID,
+			messageID:    msg.MessageID,
+			username:     msg.From.UserName,
+			languageCode: msg.From.LanguageCode,
+			isStale:      true,
+		}
+	}
+	return true, nil
+}
+
+func voiceAttachment(msg *tgbotapi.Message) *attachment {
+	switch {
+	case msg.Voice != nil:
+		return &attachment{
+			fileID:   msg.Voice.FileID,
+			fileName: fileNameVoice,
+		}
+	case msg.Audio != nil:
+		fileName := msg.Audio.FileName
+		if fileName == "" {
+			fileName = fileNameAudio
+		}
+		return &attachment{
+			fileID:   msg.Audio.FileID,
+			fileName: fileName,
+		}
+	}
+	return nil
+}
+
+// isAddressedToBot - в группе бот отвечает только на свои команды, упоминания и ответы на его сообщения
+func (t *Telegram) isAddressedToBot(msg *tgbotapi.Message) bool {
+	if msg.IsCommand() {
+		_, botName, found := strings.Cut(msg.CommandWithAt(), "@")
+		return !found || strings.EqualFold(botName, t.bot.Self.UserName)
+	}
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == t.bot.Self.ID {
+		return true
+	}
+	return strings.Contains(msg.Text, t.mention()) || strings.Contains(msg.Caption, t.mention())
+}
+
+func (t *Telegram) mention() string {
+	return "@" + t.bot.Self.UserName
+}
+
+// messageText - текст сообщения, а для фото и файлов - подпись к ним; упоминание бота удаляется
+func (t *Telegram) messageText(msg *tgbotapi.Message) string {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	return strings.TrimSpace(strings.ReplaceAll(text, t.mention(), ""))
+}
+
+// photoAttachment - Telegram присылает фото в нескольких размерах, выбирается наибольший
+func photoAttachment(msg *tgbotapi.Message) *attachment {
+	if len(msg.Photo) == 0 {
+		return nil
+	}
+	largest := msg.Photo[0]
+	for _, size := range msg.Photo[1:] {
+		if size.Width*size.Height > largest.Width*largest.Height {
+			largest = size
+		}
+	}
+	return &attachment{
+		fileID:   largest.FileID,
+		fileName: fileNamePhoto,
+	}
+}
+
+// replyTo - ответ на сообщение бота; запрос, на который отвечало сообщение бота, берется из отправленных
+func (t *Telegram) replyTo(msg *tgbotapi.Message) *replyRef {
+	reply := msg.ReplyToMessage
+	if reply == nil || reply.From == nil || reply.From.ID != t.bot.Self.ID {
+		return nil
+	}
+	ref := &replyRef{messageID: reply.MessageID, text: reply.Text}
+	if ref.text == "" {
+		ref.text = reply.Caption
+	}
+	if sent, ok := t.replies.load(msg.Chat.ID, reply.MessageID); ok {
+		ref.requestID = sent.requestID
+	}
+	return ref
+}
+
+// send - отправка ответа на сообщение клиента через очередь с сохранением связи ответа и запроса
+func (t *Telegram) send(messageID int, chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	sent, err := t.sender.send(t.threadBot(chatID, messageID), chatID, c)
+	if err == nil {
+		t.replies.store(chatID, sent.MessageID, messageID, "")
+	}
+	return sent, err
+}
+
+func documentAttachment(msg *tgbotapi.Message) *attachment {
+	if msg.Document == nil {
+		return nil
+	}
+	return &attachment{
+		fileID:   msg.Document.FileID,
+		fileName: msg.Document.FileName,
+		fileSize: msg.Document.FileSize,
+	}
+}
+
+func (t *Telegram) processCallbackQuery(query *tgbotapi.CallbackQuery, threadID int) *message {
+	t.topics.store(query.Message.Chat.ID, query.Message.MessageID, threadID)
+	if _, err := t.bot.Request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+		t.log.Error("Answer callback query err:", zap.Error(err))
+	}
+	command, text, _ := strings.Cut(query.Data, callbackDataSeparator)
+	return &message{
+		chatID:       query.Message.Chat.ID,
+		userID:       query.From.ID,
+		messageID:    query.Message.MessageID,
+		text:         text,
+		command:      command,
+		username:     query.From.UserName,
+		callbackID:   query.ID,
+		languageCode: query.From.LanguageCode,
+		threadID:     threadID,
 	}
 }
 
 func (t *Telegram) ReplyText(messageID int, chatID int64, body string) (err error) {
 	msg := tgbotapi.NewMessage(chatID, body)
 	msg.ReplyToMessageID = messageID
-	_, err = t.bot.Send(msg)
+	_, err = t.send(messageID, chatID, msg)
 	return
 }
 
@@ -98,6 +492,218 @@ func (t *Telegram) ReplyFile(messageID int, chatID int64, body []byte, fileName
 	}
 	docCfg := tgbotapi.NewDocument(chatID, fb)
 	docCfg.ReplyToMessageID = messageID
-	_, err = t.bot.Send(docCfg)
+	_, err = t.send(messageID, chatID, docCfg)
+	return
+}
+
+func (t *Telegram) ReplyKeyboard(messageID int, chatID int64, body string, kb keyboard) (err error) {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(kb))
+	for _, kbRow := range kb {
+		row := make([]tgbotapi.InlineKeyboardButton, 0, len(kbRow))
+		for _, button := range kbRow {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(button.text, button.data))
+		}
+		rows = append(rows, row)
+	}
+	msg := tgbotapi.NewMessage(chatID, body)
+	msg.ReplyToMessageID = messageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, err = t.send(messageID, chatID, msg)
+	return
+}
+
+func (t *Telegram) ReplyEditableText(messageID int, chatID int64, body string) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, body)
+	msg.ReplyToMessageID = messageID
+	sent, err := t.send(messageID, chatID, msg)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+func (t *Telegram) EditText(messageID int, chatID int64, body string) (err error) {
+	_, err = t.sender.send(t.bot, chatID, tgbotapi.NewEditMessageText(chatID, messageID, body))
+	return
+}
+
+func (t *Telegram) ReplyHTML(messageID int, chatID int64, body string) error {
+	msg := tgbotapi.NewMessage(chatID, body)
+	msg.ReplyToMessageID = messageID
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err := t.send(messageID, chatID, msg)
+	return wrapFormattingError(err)
+}
+
+func (t *Telegram) EditHTML(messageID int, chatID int64, body string) error {
+	msg := tgbotapi.NewEditMessageText(chatID, messageID, body)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err := t.sender.send(t.bot, chatID, msg)
+	return wrapFormattingError(err)
+}
+
+func (t *Telegram) ReplyPhoto(messageID int, chatID int64, body []byte, fileName, caption string) (err error) {
+	fb := tgbotapi.FileBytes{
+		Name:  fileName,
+		Bytes: body,
+	}
+	photoCfg := tgbotapi.NewPhoto(chatID, fb)
+	photoCfg.ReplyToMessageID = messageID
+	photoCfg.Caption = caption
+	_, err = t.send(messageID, chatID, photoCfg)
 	return
 }
+
+func (t *Telegram) ReplyMediaGroup(messageID int, chatID int64, files []imageFile, caption string) (err error) {
+	media := make([]interface{}, 0, len(files))
+	for idx := range files {
+		photo := tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{
+			Name:  files[idx].fileName,
+			Bytes: files[idx].body,
+		})
+		if idx == 0 {
+			photo.Caption = caption
+		}
+		media = append(media, photo)
+	}
+	groupCfg := tgbotapi.NewMediaGroup(chatID, media)
+	groupCfg.ReplyToMessageID = messageID
+	return t.sender.do(chatID, func() error {
+		sent, err := t.threadBot(chatID, messageID).SendMediaGroup(groupCfg)
+		for idx := range sent {
+			t.replies.store(chatID, sent[idx].MessageID, messageID, "")
+		}
+		return err
+	})
+}
+
+// SendChatAction - действие показывается в теме форума сообщения messageID
+func (t *Telegram) SendChatAction(messageID int, chatID int64, action string) error {
+	return t.sender.do(chatID, func() (err error) {
+		_, err = t.threadBot(chatID, messageID).Request(tgbotapi.NewChatAction(chatID, action))
+		return
+	})
+}
+
+// DroppedMessages - количество сообщений, которые очередь отправки не смогла доставить
+func (t *Telegram) DroppedMessages() int64 {
+	return t.sender.Dropped()
+}
+
+func wrapFormattingError(err error) error {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) && strings.Contains(tgErr.Message, errTelegramParseEntities) {
+		return errors.Join(errInvalidFormatting, err)
+	}
+	return err
+}
+
+func (t *Telegram) DownloadFile(fileID string) ([]byte, error) {
+	fileURL, err := t.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(fileURL)
+	if err = fasthttp.Do(req, resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, errDownloadFileInvalidRespCode
+	}
+	if len(resp.Body()) == 0 {
+		return nil, errDownloadFileRespBodyIsEmpty
+	}
+	// тело ответа переиспользуется после ReleaseResponse
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+func (t *Telegram) IsChatAdmin(chatID, userID int64) (bool, error) {
+	member, err := t.bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID: chatID,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return member.IsCreator() || member.IsAdministrator(), nil
+}
+
+// AnswerInlineQuery - ответ на inline-запрос: изображения сначала загружаются в служебный чат, так как Telegram
+// принимает в ответе только ссылку или file_id фото; switchPMText - текст кнопки перехода в личный чат с ботом
+// над результатами, пустой - без кнопки
+func (t *Telegram) AnswerInlineQuery(queryID string, results []inlineResult, switchPMText string) error {
+	items := make([]interface{}, 0, len(results))
+	for idx := range results {
+		id := strconv.Itoa(idx)
+		if results[idx].image == nil {
+			article := tgbotapi.NewInlineQueryResultArticle(id, results[idx].title, results[idx].text)
+			article.Description = truncateText(results[idx].text, maxLenInlineDescription)
+			items = append(items, article)
+			continue
+		}
+		if t.cacheChatID == 0 {
+			return errInlineCacheChatIDIsEmpty
+		}
+		sent, err := t.sender.send(t.bot, t.cacheChatID, tgbotapi.NewPhoto(t.cacheChatID, tgbotapi.FileBytes{
+			Name:  results[idx].image.fileName,
+			Bytes: results[idx].image.body,
+		}))
+		if err != nil {
+			return err
+		}
+		if len(sent.Photo) == 0 {
+			return errInlinePhotoIsNotUploaded
+		}
+		photo := tgbotapi.NewInlineQueryResultCachedPhoto(id, sent.Photo[len(sent.Photo)-1].FileID)
+		photo.Title = results[idx].title
+		photo.Caption = truncateText(results[idx].text, maxLenCaption)
+		items = append(items, photo)
+	}
+	inlineCfg := tgbotapi.InlineConfig{
+		InlineQueryID: queryID,
+		Results:       items,
+		IsPersonal:    true,
+	}
+	if switchPMText != "" {
+		inlineCfg.SwitchPMText, inlineCfg.SwitchPMParameter = switchPMText, inlineSwitchPMParameter
+	}
+	_, err := t.bot.Request(inlineCfg)
+	return err
+}
+
+// SetCommands - меню команд для личного чата или участника группы; пустой ключ - меню по умолчанию,
+// languageCode - язык пользователей, которым показывается меню, пустой - всех пользователей.
+// Меню не сообщение в чат, поэтому запрос идет через очередь отправки только с общим лимитом бота
+func (t *Telegram) SetCommands(key sessionKey, languageCode string, commands []commandInfo) error {
+	scope := tgbotapi.NewBotCommandScopeDefault()
+	switch {
+	case key == sessionKey{}:
+	case key.isGroup():
+		scope = tgbotapi.NewBotCommandScopeChatMember(key.chatID, key.userID)
+	default:
+		scope = tgbotapi.NewBotCommandScopeChat(key.chatID)
+	}
+	if len(commands) == 0 {
+		return t.sender.do(0, func() (err error) {
+			_, err = t.bot.Request(tgbotapi.NewDeleteMyCommandsWithScopeAndLanguage(scope, languageCode))
+			return
+		})
+	}
+	botCommands := make([]tgbotapi.BotCommand, 0, len(commands))
+	for idx := range commands {
+		botCommands = append(botCommands, tgbotapi.BotCommand{
+			Command:     strings.ToLower(commands[idx].name),
+			Description: commands[idx].description,
+		})
+	}
+	return t.sender.do(0, func() (err error) {
+		_, err = t.bot.Request(tgbotapi.NewSetMyCommandsWithScopeAndLanguage(scope, languageCode, botCommands...))
+		return
+	})
+}
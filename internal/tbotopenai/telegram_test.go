@@ -0,0 +1,119 @@
+package tbotopenai
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testBotID       = 42
+	testBotUserName = "gptbot"
+)
+
+func newTestGroupTelegram() *Telegram {
+	return &Telegram{
+		bot: &tgbotapi.BotAPI{
+			Self: tgbotapi.User{ID: testBotID, UserName: testBotUserName, IsBot: true},
+		},
+	}
+}
+
+func newTestCommandMessage(text string) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		Text:     text,
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(text)}},
+	}
+}
+
+func TestTelegram_IsAddressedToBot(t *testing.T) {
+	tests := []struct {
+		name       string
+		msg        *tgbotapi.Message
+		expAddress bool
+	}{
+		{
+			name:       "Command without bot name",
+			msg:        newTestCommandMessage("/help"),
+			expAddress: true,
+		},
+		{
+			name:       "Command with the bot name",
+			msg:        newTestCommandMessage("/help@GPTBot"),
+			expAddress: true,
+		},
+		{
+			name:       "Command of another bot",
+			msg:        newTestCommandMessage("/help@otherbot"),
+			expAddress: false,
+		},
+		{
+			name: "Reply to the bot message",
+			msg: &tgbotapi.Message{
+				Text:           "more",
+				ReplyToMessage: &tgbotapi.Message{From: &tgbotapi.User{ID: testBotID}},
+			},
+			expAddress: true,
+		},
+		{
+			name: "Reply to another user",
+			msg: &tgbotapi.Message{
+				Text:           "more",
+				ReplyToMessage: &tgbotapi.Message{From: &tgbotapi.User{ID: 7}},
+			},
+			expAddress: false,
+		},
+		{
+			name:       "Mention in the text",
+			msg:        &tgbotapi.Message{Text: "@gptbot hello"},
+			expAddress: true,
+		},
+		{
+			name:       "Mention in the caption",
+			msg:        &tgbotapi.Message{Caption: "what is it @gptbot"},
+			expAddress: true,
+		},
+		{
+			name:       "Message to the group",
+			msg:        &tgbotapi.Message{Text: "hello everyone"},
+			expAddress: false,
+		},
+	}
+	telegram := newTestGroupTelegram()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expAddress, telegram.isAddressedToBot(tt.msg))
+		})
+	}
+}
+
+func TestTelegram_MessageText(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     *tgbotapi.Message
+		expText string
+	}{
+		{
+			name:    "Mention is removed",
+			msg:     &tgbotapi.Message{Text: "@gptbot  hello"},
+			expText: "hello",
+		},
+		{
+			name:    "Caption is used without text",
+			msg:     &tgbotapi.Message{Caption: "what is it @gptbot"},
+			expText: "what is it",
+		},
+		{
+			name:    "Text without mention",
+			msg:     &tgbotapi.Message{Text: " hello "},
+			expText: "hello",
+		},
+	}
+	telegram := newTestGroupTelegram()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expText, telegram.messageText(tt.msg))
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package tbotopenai
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Темы форума в супергруппах: tgbotapi v5.5.1 не знает о message_thread_id, поэтому обновления
+// разбираются вместе с полями тем, тема запоминается по сообщению клиента, а ответ на это сообщение
+// отправляется в ту же тему с message_thread_id, добавленным в запрос к Bot API.
+
+const (
+	methodGetUpdates     = "getUpdates"
+	paramMessageThreadID = "message_thread_id"
+	// getUpdatesRetryInterval - пауза после ошибки getUpdates, как в tgbotapi.GetUpdatesChan
+	getUpdatesRetryInterval = 3 * time.Second
+	// maxLenMessageTopics - хранятся темы последних сообщений, старые вытесняются
+	maxLenMessageTopics = 10000
+)
+
+// telegramUpdate - обновление Telegram и тема форума его сообщения, 0 - сообщение не в теме
+type telegramUpdate struct {
+	tgbotapi.Update
+	threadID int
+}
+
+type topicMessage struct {
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+}
+
+func (m *topicMessage) threadID() int {
+	if m == nil || !m.IsTopicMessage {
+		return 0
+	}
+	return m.MessageThreadID
+}
+
+func (u *telegramUpdate) UnmarshalJSON(body []byte) error {
+	if err := json.Unmarshal(body, &u.Update); err != nil {
+		return err
+	}
+	var topic struct {
+		Message       *topicMessage `json:"message"`
+		EditedMessage *topicMessage `json:"edited_message"`
+		CallbackQuery *struct {
+			Message *topicMessage `json:"message"`
+		} `json:"callback_query"`
+	}
+	if err := json.Unmarshal(body, &topic); err != nil {
+		return err
+	}
+	switch {
+	case topic.Message != nil:
+		u.threadID = topic.Message.threadID()
+	case topic.EditedMessage != nil:
+		u.threadID = topic.EditedMessage.threadID()
+	case topic.CallbackQuery != nil:
+		u.threadID = topic.CallbackQuery.Message.threadID()
+	}
+	return nil
+}
+
+// messageTopics - темы сообщений клиентов, на которые бот отвечает
+type messageTopics struct {
+	mutex sync.Mutex
+	value map[messageRef]int
+	order []messageRef
+}
+
+func (m *messageTopics) store(chatID int64, messageID, threadID int) {
+	if threadID == 0 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.value == nil {
+		m.value = make(map[messageRef]int)
+	}
+	ref := messageRef{chatID: chatID, messageID: messageID}
+	if _, ok := m.value[ref]; !ok {
+		m.order = append(m.order, ref)
+	}
+	m.value[ref] = threadID
+	if len(m.order) > maxLenMessageTopics {
+		delete(m.value, m.order[0])
+		m.order = m.order[1:]
+	}
+}
+
+func (m *messageTopics) load(chatID int64, messageID int) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.value[messageRef{chatID: chatID, messageID: messageID}]
+}
+
+// threadClient - добавляет message_thread_id в каждый запрос к Bot API
+type threadClient struct {
+	client   tgbotapi.HTTPClient
+	threadID int
+}
+
+func (c threadClient) Do(req *http.Request) (*http.Response, error) {
+	query := req.URL.Query()
+	query.Set(paramMessageThreadID, strconv.Itoa(c.threadID))
+	req.URL.RawQuery = query.Encode()
+	return c.client.Do(req)
+}
+
+// threadBot - бот для ответа на сообщение: ответ на сообщение из темы отправляется в эту тему
+func (t *Telegram) threadBot(chatID int64, messageID int) *tgbotapi.BotAPI {
+	threadID := t.topics.load(chatID, messageID)
+	if threadID == 0 {
+		return t.bot
+	}
+	bot := *t.bot
+	bot.Client = threadClient{client: t.bot.Client, threadID: threadID}
+	return &bot
+}
+
+// pollUpdates - getUpdates вместо tgbotapi.GetUpdatesChan, который теряет поля тем форума.
+// offset - обновление, следующее за последним полученным: если запрашивать с первого необработанного,
+// то за долгой задачей накапливается limit новых обновлений и новые сообщения перестают приходить.
+// Первое необработанное обновление только сохраняется в файл для перезапуска (см. updateOffset)
+func (t *Telegram) pollUpdates(cfg tgbotapi.UpdateConfig, updateChan chan<- telegramUpdate) {
+	defer close(updateChan)
+	next := cfg.Offset
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		default:
+		}
+		params := make(tgbotapi.Params)
+		params.AddNonZero("offset", next)
+		params.AddNonZero("limit", cfg.Limit)
+		params.AddNonZero("timeout", cfg.Timeout)
+		resp, err := t.bot.MakeRequest(methodGetUpdates, params)
+		var updates []telegramUpdate
+		if err == nil {
+			err = json.Unmarshal(resp.Result, &updates)
+		}
+		if err != nil {
+			t.log.Error("Get updates err, retrying:", zap.Error(err))
+			select {
+			case <-t.stopChan:
+				return
+			case <-time.After(getUpdatesRetryInterval):
+			}
+			continue
+		}
+		for _, update := range updates {
+			if update.UpdateID < next {
+				continue
+			}
+			next = update.UpdateID + 1
+			select {
+			case updateChan <- update:
+			case <-t.stopChan:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package tbotopenai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTelegramUpdate_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expThreadID int
+	}{
+		{
+			name:        "Message in a forum topic",
+			body:        `{"update_id":1,"message":{"message_id":1,"message_thread_id":7,"is_topic_message":true,"text":"hi"}}`,
+			expThreadID: 7,
+		},
+		{
+			name:        "Reply thread outside a forum is not a topic",
+			body:        `{"update_id":1,"message":{"message_id":1,"message_thread_id":7,"text":"hi"}}`,
+			expThreadID: 0,
+		},
+		{
+			name:        "Edited message in a forum topic",
+			body:        `{"update_id":1,"edited_message":{"message_id":1,"message_thread_id":8,"is_topic_message":true,"text":"hi"}}`,
+			expThreadID: 8,
+		},
+		{
+			name:        "Button under a message in a forum topic",
+			body:        `{"update_id":1,"callback_query":{"id":"1","data":"x","message":{"message_id":1,"message_thread_id":9,"is_topic_message":true}}}`,
+			expThreadID: 9,
+		},
+		{
+			name:        "Inline button without a message",
+			body:        `{"update_id":1,"callback_query":{"id":"1","data":"x"}}`,
+			expThreadID: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update telegramUpdate
+			assert.NoError(t, json.Unmarshal([]byte(tt.body), &update))
+			assert.Equal(t, 1, update.UpdateID)
+			assert.Equal(t, tt.expThreadID, update.threadID)
+		})
+	}
+}
+
+func TestMessageTopics(t *testing.T) {
+	var topics messageTopics
+	topics.store(1, 1, 0)
+	assert.Len(t, topics.order, 0)
+	for messageID := 1; messageID <= maxLenMessageTopics+1; messageID++ {
+		topics.store(1, messageID, 5)
+	}
+	assert.Equal(t, 0, topics.load(1, 1))
+	assert.Equal(t, 5, topics.load(1, maxLenMessageTopics+1))
+	assert.Equal(t, 0, topics.load(2, maxLenMessageTopics+1))
+	assert.Len(t, topics.order, maxLenMessageTopics)
+}
+
+// testHTTPClient - HTTP клиент Bot API, запоминающий запрос
+type testHTTPClient struct {
+	query url.Values
+}
+
+func (c *testHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.query = req.URL.Query()
+	return &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func TestThreadClient_Do(t *testing.T) {
+	client := &testHTTPClient{}
+	req, err := http.NewRequest(http.MethodPost, "https://api.telegram.org/bot1/sendMessage?a=1", nil)
+	assert.NoError(t, err)
+	_, err = threadClient{client: client, threadID: 7}.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "7", client.query.Get(paramMessageThreadID))
+	assert.Equal(t, "1", client.query.Get("a"))
+}
+
+// testUpdatesClient - Bot API, который отдает обновления 1..count на getUpdates, как Telegram:
+// начиная с offset, не больше limit за запрос
+type testUpdatesClient struct {
+	count int
+}
+
+func (c *testUpdatesClient) Do(req *http.Request) (*http.Response, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+	offset, _ := strconv.Atoi(req.Form.Get("offset"))
+	limit, _ := strconv.Atoi(req.Form.Get("limit"))
+	if offset < 1 {
+		offset = 1
+	}
+	updates := make([]map[string]any, 0, limit)
+	for id := offset; id <= c.count && len(updates) < limit; id++ {
+		updates = append(updates, map[string]any{"update_id": id})
+	}
+	if len(updates) == 0 {
+		// long polling без новых обновлений
+		time.Sleep(time.Millisecond)
+	}
+	result, err := json.Marshal(updates)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]any{"ok": true, "result": json.RawMessage(result)})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func TestTelegram_PollUpdates(t *testing.T) {
+	const (
+		countUpdates = 250
+		// heldUpdateID - долгая задача, которая не завершается, пока приходят новые обновления
+		heldUpdateID = 1
+	)
+	bot := &tgbotapi.BotAPI{Token: "test", Client: &testUpdatesClient{count: countUpdates}}
+	bot.SetAPIEndpoint(tgbotapi.APIEndpoint)
+	offset, err := loadUpdateOffset("")
+	assert.NoError(t, err)
+	telegram := &Telegram{
+		bot:      bot,
+		offset:   offset,
+		stopChan: make(chan struct{}),
+		log:      zap.NewNop(),
+	}
+	cfg := tgbotapi.NewUpdate(offset.next())
+	cfg.Limit = 100
+	updateChan := make(chan telegramUpdate)
+	go telegram.pollUpdates(cfg, updateChan)
+	received := make([]int, 0, countUpdates)
+	timeout := time.After(5 * time.Second)
+	for len(received) < countUpdates {
+		select {
+		case update := <-updateChan:
+			assert.True(t, offset.begin(update.UpdateID))
+			if update.UpdateID != heldUpdateID {
+				offset.done(update.UpdateID)
+			}
+			received = append(received, update.UpdateID)
+		case <-timeout:
+			assert.FailNow(t, "new updates are not received while an update is processed",
+				"received: %d", len(received))
+		}
+	}
+	close(telegram.stopChan)
+	for range updateChan {
+	}
+	for idx, updateID := range received {
+		assert.Equal(t, idx+1, updateID)
+	}
+	// после перезапуска getUpdates начнется с невыполненного обновления
+	assert.Equal(t, updaterOffset, offset.next())
+	offset.done(heldUpdateID)
+	assert.Equal(t, countUpdates+1, offset.next())
+}
@@ -0,0 +1,263 @@
+package tbotopenai
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Ответ клиента на сообщение бота продолжает диалог: Telegram не передает цепочку ответов целиком,
+// поэтому Messenger запоминает, на какой запрос клиента отправлено каждое сообщение бота,
+// а бот - запросы и ответы по номеру сообщения запроса.
+
+const (
+	// maxLenSentReplies, maxLenThreadEntries - хранятся последние сообщения, старые вытесняются
+	maxLenSentReplies   = 10000
+	maxLenThreadEntries = 10000
+	// maxThreadDepth - количество предыдущих запросов и ответов в контексте
+	maxThreadDepth = 10
+	// maxLenThreadContext - длина контекста диалога в символах
+	maxLenThreadContext = 12000
+)
+
+type messageRef struct {
+	chatID    int64
+	messageID int
+}
+
+// replyRef - сообщение бота, на которое ответил клиент
+type replyRef struct {
+	messageID int
+	// requestID - сообщение клиента, на которое отвечало сообщение бота, 0 - неизвестно
+	requestID int
+	text      string
+}
+
+type sentReply struct {
+	requestID int
+	text      string
+}
+
+// sentReplies - сообщения бота и запросы клиентов, на которые они отправлены
+type sentReplies struct {
+	mutex sync.Mutex
+	value map[messageRef]sentReply
+	order []messageRef
+}
+
+func (r *sentReplies) store(chatID int64, sentID, requestID int, text string) {
+	if sentID == 0 || requestID == 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.value == nil {
+		r.value = make(map[messageRef]sentReply)
+	}
+	ref := messageRef{chatID: chatID, messageID: sentID}
+	if _, ok := r.value[ref]; !ok {
+		r.order = append(r.order, ref)
+	}
+	r.value[ref] = sentReply{requestID: requestID, text: text}
+	if len(r.order) > maxLenSentReplies {
+		delete(r.value, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *sentReplies) load(chatID int64, sentID int) (sentReply, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	reply, ok := r.value[messageRef{chatID: chatID, messageID: sentID}]
+	return reply, ok
+}
+
+// threadEntry - запрос клиента, ответ бота и запрос, ответом на который он был отправлен
+type threadEntry struct {
+	command  string
+	prompt   string
+	answer   string
+	parentID int
+}
+
+type threadStore struct {
+	mutex sync.Mutex
+	value map[messageRef]threadEntry
+	order []messageRef
+}
+
+func (s *threadStore) store(chatID int64, requestID int, entry threadEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.value == nil {
+		s.value = make(map[messageRef]threadEntry)
+	}
+	ref := messageRef{chatID: chatID, messageID: requestID}
+	if _, ok := s.value[ref]; !ok {
+		s.order = append(s.order, ref)
+	}
+	s.value[ref] = entry
+	if len(s.order) > maxLenThreadEntries {
+		delete(s.value, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *threadStore) load(chatID int64, requestID int) (threadEntry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.value[messageRef{chatID: chatID, messageID: requestID}]
+	return entry, ok
+}
+
+// history - запросы и ответы цепочки от первого до того, на который ответил клиент
+func (s *threadStore) history(chatID int64, reply *replyRef) []threadEntry {
+	entries := make([]threadEntry, 0, maxThreadDepth)
+	for requestID := reply.requestID; requestID != 0 && len(entries) < maxThreadDepth; {
+		entry, ok := s.load(chatID, requestID)
+		if !ok {
+			break
+		}
+		entries = append(entries, entry)
+		requestID = entry.parentID
+	}
+	if len(entries) == 0 && reply.text != "" {
+		entries = append(entries, threadEntry{answer: reply.text})
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+// rememberThread - запрос и ответ модели сохраняются для продолжения диалога ответом на сообщение бота;
+// ошибки и отмененные запросы не сохраняются
+func (t *TBotOpenAI) rememberThread(msg *message, command string, resp *taskResponse) {
+	if !resp.isAnswer {
+		return
+	}
+	entry := threadEntry{
+		command: command,
+		prompt:  msg.text,
+	}
+	if len(resp.files) == 0 {
+		entry.answer = string(resp.body)
+	}
+	if msg.replyTo != nil {
+		entry.parentID = msg.replyTo.requestID
+	}
+	t.threads.store(msg.chatID, msg.messageID, entry)
+}
+
+// attachThread - предыдущие запросы и ответы цепочки передаются модели сообщениями с ролями
+func (t *TBotOpenAI) attachThread(msg *message, req *aiRequest) {
+	if msg.replyTo == nil {
+		return
+	}
+	entries := t.threads.history(msg.chatID, msg.replyTo)
+	for len(entries) > 1 && lenThreadEntries(entries) > maxLenThreadContext {
+		entries = entries[1:]
+	}
+	if len(entries) == 0 {
+		return
+	}
+	req.history = threadHistory(entries)
+}
+
+func lenThreadEntries(entries []threadEntry) int {
+	var n int
+	for idx := range entries {
+		n += utf8.RuneCountInString(entries[idx].prompt) + utf8.RuneCountInString(entries[idx].answer)
+	}
+	return n
+}
+
+func threadHistory(entries []threadEntry) []chatMessage {
+	history := make([]chatMessage, 0, 2*len(entries))
+	for idx := range entries {
+		if entries[idx].prompt != "" {
+			history = append(history, chatMessage{role: chatRoleUser, content: entries[idx].prompt})
+		}
+		if entries[idx].answer != "" {
+			history = append(history, chatMessage{
+				role:    chatRoleAssistant,
+				content: truncateText(entries[idx].answer, maxLenThreadContext),
+			})
+		}
+	}
+	return history
+}
+
+// refineImageRequest - ответ на сгенерированное изображение уточняет его запрос той же командой,
+// если она доступна клиенту
+func (t *TBotOpenAI) refineImageRequest(msg *message) (string, string, bool) {
+	if msg.replyTo == nil || msg.text == "" {
+		return "", "", false
+	}
+	entry, ok := t.threads.load(msg.chatID, msg.replyTo.requestID)
+	if !ok || !t.isImageCommand(entry.command) {
+		return "", "", false
+	}
+	if !t.checkPermissions(entry.command, msg.username) || !t.isGroupCommandEnabled(msg.session(), entry.command) {
+		return "", "", false
+	}
+	p, ok := t.providers.get(entry.command)
+	if !ok {
+		return "", "", false
+	}
+	return entry.command, refinePrompt(p.cfg.Type, entry.prompt, msg.text), true
+}
+
+// refinePrompt - уточнение дописывается к исходному промпту, параметры запроса сохраняются;
+// в DreamBooth строки уточнения вида "поле: значение" заменяют поля исходного запроса
+func refinePrompt(providerType, prompt, refinement string) string {
+	switch providerType {
+	case providerTypeFusionBrain:
+		rows := strings.Split(prompt, "\n")
+		rows[0] = rows[0] + ", " + refinement
+		return strings.Join(rows, "\n")
+	case providerTypeDreamBooth:
+		return refineDreamBoothPrompt(prompt, refinement)
+	}
+	return prompt + ", " + refinement
+}
+
+func refineDreamBoothPrompt(prompt, refinement string) string {
+	fields := make(map[string]string)
+	texts := make([]string, 0)
+	for _, row := range strings.Split(strings.ReplaceAll(refinement, "\r", ""), "\n") {
+		field, val, found := strings.Cut(row, ":")
+		field = strings.TrimSpace(field)
+		if found && field != "" && !strings.Contains(field, " ") {
+			fields[field] = strings.TrimSpace(val)
+			continue
+		}
+		if row = strings.TrimSpace(row); row != "" {
+			texts = append(texts, row)
+		}
+	}
+	rows := strings.Split(strings.ReplaceAll(prompt, "\r", ""), "\n")
+	for idx, row := range rows {
+		field, val, found := strings.Cut(row, ":")
+		if !found {
+			continue
+		}
+		field = strings.TrimSpace(field)
+		if newVal, ok := fields[field]; ok {
+			val = newVal
+			delete(fields, field)
+		}
+		if field == "prompt" && len(texts) > 0 {
+			val = strings.TrimSpace(val) + ", " + strings.Join(texts, ", ")
+			texts = nil
+		}
+		rows[idx] = field + ": " + strings.TrimSpace(val)
+	}
+	for field, val := range fields {
+		rows = append(rows, field+": "+val)
+	}
+	if len(texts) > 0 {
+		rows = append(rows, "prompt: "+strings.Join(texts, ", "))
+	}
+	return strings.Join(rows, "\n")
+}
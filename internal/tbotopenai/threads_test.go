@@ -0,0 +1,93 @@
+package tbotopenai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThreadHistory(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    []threadEntry
+		expHistory []chatMessage
+	}{
+		{
+			name: "Requests and answers are role messages",
+			entries: []threadEntry{
+				{prompt: "Привет", answer: "Здравствуйте"},
+				{prompt: "Как дела?", answer: "Хорошо"},
+			},
+			expHistory: []chatMessage{
+				{role: chatRoleUser, content: "Привет"},
+				{role: chatRoleAssistant, content: "Здравствуйте"},
+				{role: chatRoleUser, content: "Как дела?"},
+				{role: chatRoleAssistant, content: "Хорошо"},
+			},
+		},
+		{
+			name:    "Only the bot message is known",
+			entries: []threadEntry{{answer: "Ответ бота"}},
+			expHistory: []chatMessage{
+				{role: chatRoleAssistant, content: "Ответ бота"},
+			},
+		},
+		{
+			name:    "Image request has no text answer",
+			entries: []threadEntry{{prompt: "кот"}},
+			expHistory: []chatMessage{
+				{role: chatRoleUser, content: "кот"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expHistory, threadHistory(tt.entries))
+		})
+	}
+}
+
+func TestRefineDreamBoothPrompt(t *testing.T) {
+	tests := []struct {
+		name       string
+		prompt     string
+		refinement string
+		expPrompt  string
+	}{
+		{
+			name:       "Text is appended to the prompt field",
+			prompt:     "prompt: cat\nwidth: 512",
+			refinement: "in a hat",
+			expPrompt:  "prompt: cat, in a hat\nwidth: 512",
+		},
+		{
+			name:       "Field replaces the field of the request",
+			prompt:     "prompt: cat\nwidth: 512",
+			refinement: "width: 768",
+			expPrompt:  "prompt: cat\nwidth: 768",
+		},
+		{
+			name:       "New field is added",
+			prompt:     "prompt: cat",
+			refinement: "seed: 42\nred",
+			expPrompt:  "prompt: cat, red\nseed: 42",
+		},
+		{
+			name:       "Prompt field is added when the request has none",
+			prompt:     "width: 512",
+			refinement: "dog\r\nin the park",
+			expPrompt:  "width: 512\nprompt: dog, in the park",
+		},
+		{
+			name:       "Row with spaces before the colon is text",
+			prompt:     "prompt: cat",
+			refinement: "style is: noir",
+			expPrompt:  "prompt: cat, style is: noir",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expPrompt, refineDreamBoothPrompt(tt.prompt, tt.refinement))
+		})
+	}
+}
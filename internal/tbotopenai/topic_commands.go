@@ -0,0 +1,158 @@
+package tbotopenai
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// topicCommandNone - данные кнопки, отвязывающей тему от команды
+const topicCommandNone = "-"
+
+type topicKey struct {
+	chatID   int64
+	threadID int
+}
+
+// isTopicCommand - администраторы группы могут привязать тему форума к команде провайдера:
+// запросы в теме выполняются этой командой, какая бы команда ни была выбрана у клиента
+func (t *TBotOpenAI) isTopicCommand(command string) bool {
+	return t.isProviderCommand(command)
+}
+
+// topicCommand - команда, к которой привязана тема сообщения, "" - тема не привязана
+func (t *TBotOpenAI) topicCommand(msg *message) string {
+	if msg.threadID == 0 {
+		return ""
+	}
+	val, ok := t.topicCommandByKey.Load(topicKey{chatID: msg.chatID, threadID: msg.threadID})
+	if !ok {
+		return ""
+	}
+	command, _ := val.(string)
+	return command
+}
+
+// taskCommandOf - команда, которой выполняется запрос: команда задачи, затем команда темы, если клиент
+// не ждет ввода для служебной команды (например, /ban), затем текущая команда клиента
+func (t *TBotOpenAI) taskCommandOf(msg *message) (string, error) {
+	if msg.taskCommand != "" {
+		return msg.taskCommand, nil
+	}
+	command, err := t.clientStates.ClientCommand(msg.session())
+	if err != nil {
+		return "", err
+	}
+	if topicCommand := t.topicCommand(msg); topicCommand != "" && (command == "" || t.isTopicCommand(command)) {
+		return topicCommand, nil
+	}
+	return command, nil
+}
+
+func (t *TBotOpenAI) commandTopicCommand(command, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if respBody := t.checkGroupAdmin(key); respBody != "" {
+		return &commandResponse{
+			text: l.text(respBody),
+		}
+	}
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
+		t.log.Error("Update client command err:", zap.Error(err))
+		return &commandResponse{
+			text: l.text(respBodySessionIsNotExist),
+		}
+	}
+	return &commandResponse{
+		text:     l.text(respBodyCommandTopicCommand),
+		keyboard: keyboardTopicCommands(l, t.providers.commands()),
+	}
+}
+
+func (t *TBotOpenAI) processTopicCommand(msg *message) *taskResponse {
+	key := msg.session()
+	l := t.localizer(msg.userID)
+	if respBody := t.checkGroupAdmin(key); respBody != "" {
+		return &taskResponse{body: l.bytes(respBody)}
+	}
+	if msg.threadID == 0 {
+		return &taskResponse{body: l.bytes(respErrBodyTopicOnly)}
+	}
+	command := strings.TrimPrefix(strings.TrimSpace(msg.text), "/")
+	if command != topicCommandNone && !t.isTopicCommand(command) {
+		return &taskResponse{body: l.bytes(respErrBodyInvalidTopicCommand)}
+	}
+	topic := topicKey{chatID: msg.chatID, threadID: msg.threadID}
+	if command == topicCommandNone {
+		t.topicCommandByKey.Delete(topic)
+	} else {
+		t.topicCommandByKey.Store(topic, command)
+	}
+	if err := t.writeTopicCommandsToFile(); err != nil {
+		return &taskResponse{body: l.bytes(respErrBodyTopicCommands)}
+	}
+	if command == topicCommandNone {
+		return &taskResponse{body: l.bytes(respBodyTopicCommandUnbound)}
+	}
+	return &taskResponse{body: l.bytes(respBodyTopicCommandBound, "command", command)}
+}
+
+// storeTopicCommands - файл хранит строки вида "<chatID>:<threadID>:<command>"
+func (t *TBotOpenAI) storeTopicCommands() error {
+	if t.cfg.Groups.PathTopicCommands == "" {
+		return nil
+	}
+	body, err := os.ReadFile(t.cfg.Groups.PathTopicCommands)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.log.Error("Read topic commands file err", zap.Error(err))
+		return err
+	}
+	rows := strings.Split(strings.ReplaceAll(string(body), "\r", ""), "\n")
+	for _, row := range rows {
+		fields := strings.Split(row, ":")
+		if len(fields) != 3 {
+			continue
+		}
+		chatID, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			t.log.Error("Parse topic commands file err", zap.Error(err))
+			continue
+		}
+		threadID, err := strconv.Atoi(fields[1])
+		if err != nil {
+			t.log.Error("Parse topic commands file err", zap.Error(err))
+			continue
+		}
+		t.topicCommandByKey.Store(topicKey{chatID: chatID, threadID: threadID}, fields[2])
+	}
+	return nil
+}
+
+func (t *TBotOpenAI) writeTopicCommandsToFile() error {
+	if t.cfg.Groups.PathTopicCommands == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	t.topicCommandByKey.Range(func(k, v any) bool {
+		topic, ok := k.(topicKey)
+		if !ok {
+			return false
+		}
+		command, ok := v.(string)
+		if !ok {
+			return false
+		}
+		b.WriteString(strconv.FormatInt(topic.chatID, 10) + ":" + strconv.Itoa(topic.threadID) + ":" + command + "\n")
+		return true
+	})
+	err := os.WriteFile(t.cfg.Groups.PathTopicCommands, b.Bytes(), 0644)
+	if err != nil {
+		t.log.Error("Write topic commands file err", zap.Error(err))
+	}
+	return err
+}
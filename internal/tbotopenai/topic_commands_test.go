@@ -0,0 +1,71 @@
+package tbotopenai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTBotOpenAI_TaskCommandOf(t *testing.T) {
+	const (
+		chatID        = -100
+		userID        = 1
+		boundThreadID = 7
+	)
+	tests := []struct {
+		name          string
+		msg           *message
+		clientCommand string
+		expCommand    string
+	}{
+		{
+			name:          "Topic command replaces the client command",
+			msg:           &message{chatID: chatID, userID: userID, threadID: boundThreadID},
+			clientCommand: commandChatGPT,
+			expCommand:    commandFusionBrain,
+		},
+		{
+			name:          "Client waits for input of a service command",
+			msg:           &message{chatID: chatID, userID: userID, threadID: boundThreadID},
+			clientCommand: commandBan,
+			expCommand:    commandBan,
+		},
+		{
+			name:          "Task command is used first",
+			msg:           &message{chatID: chatID, userID: userID, threadID: boundThreadID, taskCommand: commandOpenAIText},
+			clientCommand: commandChatGPT,
+			expCommand:    commandOpenAIText,
+		},
+		{
+			name:          "Topic is not bound",
+			msg:           &message{chatID: chatID, userID: userID, threadID: boundThreadID + 1},
+			clientCommand: commandChatGPT,
+			expCommand:    commandChatGPT,
+		},
+		{
+			name:          "Message is not in a topic",
+			msg:           &message{chatID: chatID, userID: userID},
+			clientCommand: commandChatGPT,
+			expCommand:    commandChatGPT,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &TBotOpenAI{
+				clientStates: clientStateBySession{value: make(map[sessionKey]*clientState)},
+				providers: &providerRegistry{byCommand: map[string]*provider{
+					commandChatGPT:     {},
+					commandOpenAIText:  {},
+					commandFusionBrain: {},
+				}},
+			}
+			bot.topicCommandByKey.Store(topicKey{chatID: chatID, threadID: boundThreadID}, commandFusionBrain)
+			key := tt.msg.session()
+			assert.NoError(t, bot.clientStates.AddClient(key, "user"))
+			assert.NoError(t, bot.clientStates.UpdateClientCommand(key, tt.clientCommand))
+			command, err := bot.taskCommandOf(tt.msg)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expCommand, command)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package tbotopenai
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Политика обработки сообщений, отправленных, пока бот был недоступен
+const (
+	staleUpdatesProcess = "process"
+	staleUpdatesDrop    = "drop"
+	staleUpdatesNotify  = "notify"
+)
+
+const (
+	// maxSeenUpdates - сколько номеров последних полученных обновлений хранится для отсева повторов
+	maxSeenUpdates = 10000
+	// offsetFlushInterval - номер обновления записывается в файл не чаще этого интервала
+	offsetFlushInterval = time.Second
+)
+
+// updateOffset - номер обновления Telegram, до которого включительно все обновления обработаны; хранится
+// в файле, чтобы после перезапуска получить заново обновления, которые были в очереди или выполнялись.
+// Webhook доставляет обновления параллельно и не по порядку, поэтому повторы отсеиваются по множеству
+// полученных номеров, а не по последнему номеру
+type updateOffset struct {
+	mutex sync.Mutex
+	path  string
+	last  int
+	// maxSeen - наибольший полученный номер
+	maxSeen int
+	// pending - полученные, но еще не обработанные обновления
+	pending   map[int]struct{}
+	seen      map[int]struct{}
+	seenOrder []int
+	isDirty   bool
+}
+
+func loadUpdateOffset(path string) (*updateOffset, error) {
+	o := &updateOffset{
+		path:    path,
+		pending: make(map[int]struct{}),
+		seen:    make(map[int]struct{}),
+	}
+	if path == "" {
+		return o, nil
+	}
+	body, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strBody := strings.TrimSpace(string(body)); strBody != "" {
+		if o.last, err = strconv.Atoi(strBody); err != nil {
+			return nil, err
+		}
+	}
+	o.maxSeen = o.last
+	return o, nil
+}
+
+// next - первое обновление, которое еще не обработано: с него getUpdates начинается после перезапуска
+func (o *updateOffset) next() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.last == 0 {
+		return updaterOffset
+	}
+	return o.last + 1
+}
+
+// begin - обновление получено; false - оно уже было получено
+func (o *updateOffset) begin(updateID int) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if _, ok := o.seen[updateID]; ok {
+		return false
+	}
+	if _, ok := o.pending[updateID]; ok {
+		return false
+	}
+	o.pending[updateID] = struct{}{}
+	o.seen[updateID] = struct{}{}
+	o.seenOrder = append(o.seenOrder, updateID)
+	if len(o.seenOrder) > maxSeenUpdates {
+		delete(o.seen, o.seenOrder[0])
+		o.seenOrder = o.seenOrder[1:]
+	}
+	if updateID > o.maxSeen {
+		o.maxSeen = updateID
+	}
+	return true
+}
+
+// done - обновление обработано: номер сдвигается до первого необработанного обновления
+func (o *updateOffset) done(updateID int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	delete(o.pending, updateID)
+	last := o.maxSeen
+	for id := range o.pending {
+		if id-1 < last {
+			last = id - 1
+		}
+	}
+	if last > o.last {
+		o.last = last
+		o.isDirty = true
+	}
+}
+
+// flush - файл перезаписывается через временный, чтобы при падении не остался пустой файл
+func (o *updateOffset) flush() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if !o.isDirty || o.path == "" {
+		return nil
+	}
+	tmpPath := o.path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.Itoa(o.last)), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, o.path); err != nil {
+		return err
+	}
+	o.isDirty = false
+	return nil
+}
+
+// isStaleMessage - сообщение отправлено до запуска бота и раньше, чем maxAge назад
+func isStaleMessage(date time.Time, startedAt time.Time, maxAge time.Duration) bool {
+	return maxAge > 0 && date.Before(startedAt) && time.Since(date) > maxAge
+}
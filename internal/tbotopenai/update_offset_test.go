@@ -0,0 +1,147 @@
+package tbotopenai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateOffset_BeginDone(t *testing.T) {
+	type step struct {
+		begin   int
+		done    int
+		expSeen bool
+	}
+	tests := []struct {
+		name    string
+		steps   []step
+		expNext int
+	}{
+		{
+			name: "Updates in order",
+			steps: []step{
+				{begin: 1}, {done: 1},
+				{begin: 2}, {done: 2},
+			},
+			expNext: 3,
+		},
+		{
+			name: "Offset waits for the oldest pending update",
+			steps: []step{
+				{begin: 1}, {begin: 2}, {begin: 3},
+				{done: 3}, {done: 2},
+			},
+			expNext: updaterOffset,
+		},
+		{
+			name: "Offset moves when the oldest pending update is done",
+			steps: []step{
+				{begin: 1}, {begin: 2}, {begin: 3},
+				{done: 2}, {done: 1},
+			},
+			expNext: 3,
+		},
+		{
+			name: "Webhook delivers updates out of order",
+			steps: []step{
+				{begin: 6}, {done: 6},
+				{begin: 5}, {done: 5},
+			},
+			expNext: 7,
+		},
+		{
+			name: "Duplicate update is skipped",
+			steps: []step{
+				{begin: 1}, {begin: 1, expSeen: true},
+				{done: 1}, {begin: 1, expSeen: true},
+			},
+			expNext: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := loadUpdateOffset("")
+			assert.NoError(t, err)
+			for _, s := range tt.steps {
+				if s.begin != 0 {
+					assert.Equal(t, !s.expSeen, o.begin(s.begin))
+					continue
+				}
+				o.done(s.done)
+			}
+			assert.Equal(t, tt.expNext, o.next())
+		})
+	}
+}
+
+func TestUpdateOffset_SeenIsBounded(t *testing.T) {
+	o, err := loadUpdateOffset("")
+	assert.NoError(t, err)
+	for id := 1; id <= maxSeenUpdates+1; id++ {
+		o.begin(id)
+		o.done(id)
+	}
+	assert.Len(t, o.seen, maxSeenUpdates)
+	// недавнее обновление пропускается как повтор
+	assert.False(t, o.begin(maxSeenUpdates+1))
+}
+
+func TestUpdateOffset_Flush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "update_offset")
+	o, err := loadUpdateOffset(path)
+	assert.NoError(t, err)
+	assert.NoError(t, o.flush())
+	// до первого выполненного обновления смещение не записывается
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	o.begin(10)
+	o.begin(11)
+	o.done(10)
+	assert.NoError(t, o.flush())
+	loaded, err := loadUpdateOffset(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 11, loaded.next())
+}
+
+func TestIsStaleMessage(t *testing.T) {
+	startedAt := time.Now()
+	tests := []struct {
+		name     string
+		date     time.Time
+		maxAge   time.Duration
+		expStale bool
+	}{
+		{
+			name:     "Old message sent before start",
+			date:     startedAt.Add(-time.Hour),
+			maxAge:   time.Minute,
+			expStale: true,
+		},
+		{
+			name:     "Recent message sent before start",
+			date:     startedAt.Add(-time.Second),
+			maxAge:   time.Minute,
+			expStale: false,
+		},
+		{
+			name:     "Message sent after start",
+			date:     startedAt.Add(time.Second),
+			maxAge:   time.Nanosecond,
+			expStale: false,
+		},
+		{
+			name:     "Max age is not set",
+			date:     startedAt.Add(-time.Hour),
+			maxAge:   0,
+			expStale: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expStale, isStaleMessage(tt.date, startedAt, tt.maxAge))
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package tbotopenai
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Язык ответов пользователя: выбранный командой /language, иначе язык клиента Telegram, если для него
+// есть каталог, иначе язык по умолчанию. Выбранные языки хранятся в файле path_user_languages
+// строками "<userID>:<язык>".
+
+type userLanguages struct {
+	mutex    sync.Mutex
+	selected map[int64]string
+	client   map[int64]string
+}
+
+func (u *userLanguages) load(userID int64) (string, string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.selected[userID], u.client[userID]
+}
+
+func (u *userLanguages) setClient(userID int64, lang string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.client == nil {
+		u.client = make(map[int64]string)
+	}
+	u.client[userID] = lang
+}
+
+func (u *userLanguages) setSelected(userID int64, lang string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.selected == nil {
+		u.selected = make(map[int64]string)
+	}
+	u.selected[userID] = lang
+}
+
+func (u *userLanguages) marshal() []byte {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	userIDs := make([]int64, 0, len(u.selected))
+	for userID := range u.selected {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return userIDs[i] < userIDs[j]
+	})
+	var b bytes.Buffer
+	for _, userID := range userIDs {
+		b.WriteString(strconv.FormatInt(userID, 10) + ":" + u.selected[userID] + "\n")
+	}
+	return b.Bytes()
+}
+
+// userLanguage - язык каталога, на котором пользователю отправляются ответы
+func (t *TBotOpenAI) userLanguage(userID int64) string {
+	selected, client := t.languages.load(userID)
+	if lang := t.locales.match(selected); lang != "" {
+		return lang
+	}
+	if lang := t.locales.match(client); lang != "" {
+		return lang
+	}
+	return t.locales.defaultLang
+}
+
+func (t *TBotOpenAI) localizer(userID int64) localizer {
+	return localizer{locales: t.locales, lang: t.userLanguage(userID)}
+}
+
+// defaultLocalizer - ответы, не привязанные к пользователю, например файл статистики
+func (t *TBotOpenAI) defaultLocalizer() localizer {
+	return localizer{locales: t.locales, lang: t.locales.defaultLang}
+}
+
+// rememberClientLanguage - язык клиента Telegram приходит в каждом сообщении; при его смене
+// обновляется меню команд пользователя
+func (t *TBotOpenAI) rememberClientLanguage(msg *message) {
+	if msg.languageCode == "" {
+		return
+	}
+	if _, client := t.languages.load(msg.userID); client == msg.languageCode {
+		return
+	}
+	prevLang := t.userLanguage(msg.userID)
+	t.languages.setClient(msg.userID, msg.languageCode)
+	if t.userLanguage(msg.userID) != prevLang {
+		t.refreshUserIDCommandMenus(msg.userID)
+	}
+}
+
+func (t *TBotOpenAI) commandLanguage(command, _ string, key sessionKey) *commandResponse {
+	l := t.localizer(key.userID)
+	if err := t.clientStates.UpdateClientCommand(key, command); err != nil {
+		t.log.Error("Update client command err:", zap.Error(err))
+		return &commandResponse{
+			text: l.text(respBodySessionIsNotExist),
+		}
+	}
+	return &commandResponse{
+		text:     l.text(respBodyCommandLanguage),
+		keyboard: keyboardLanguages(t.locales),
+	}
+}
+
+func (t *TBotOpenAI) processLanguage(msg *message) *taskResponse {
+	lang := t.locales.match(strings.TrimSpace(msg.text))
+	if lang == "" {
+		return &taskResponse{body: t.localizer(msg.userID).bytes(respErrBodyInvalidLanguage)}
+	}
+	t.languages.setSelected(msg.userID, lang)
+	l := t.localizer(msg.userID)
+	if err := t.writeUserLanguagesToFile(); err != nil {
+		t.log.Error("Write user languages file err", zap.Error(err))
+		return &taskResponse{body: l.bytes(respErrBodyLanguage)}
+	}
+	t.refreshUserIDCommandMenus(msg.userID)
+	return &taskResponse{body: l.bytes(respBodyLanguageChanged, "language", l.text(respBodyLanguageName))}
+}
+
+func (t *TBotOpenAI) storeUserLanguages() error {
+	if t.cfg.Locales.PathUserLanguages == "" {
+		return nil
+	}
+	body, err := os.ReadFile(t.cfg.Locales.PathUserLanguages)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.log.Error("Read user languages file err", zap.Error(err))
+		return err
+	}
+	rows := strings.Split(strings.ReplaceAll(string(body), "\r", ""), "\n")
+	for _, row := range rows {
+		strUserID, lang, found := strings.Cut(row, ":")
+		if !found {
+			continue
+		}
+		userID, err := strconv.ParseInt(strUserID, 10, 64)
+		if err != nil {
+			t.log.Error("Parse user languages file err", zap.Error(err))
+			continue
+		}
+		t.languages.setSelected(userID, lang)
+	}
+	return nil
+}
+
+func (t *TBotOpenAI) writeUserLanguagesToFile() error {
+	if t.cfg.Locales.PathUserLanguages == "" {
+		return nil
+	}
+	return os.WriteFile(t.cfg.Locales.PathUserLanguages, t.languages.marshal(), 0644)
+}
@@ -0,0 +1,147 @@
+package tbotopenai
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	telegramModePolling = "polling"
+	telegramModeWebhook = "webhook"
+)
+
+const (
+	defaultWebhookListen = ":80"
+	defaultWebhookPath   = "/"
+
+	headerSecretToken = "X-Telegram-Bot-Api-Secret-Token"
+	methodSetWebhook  = "setWebhook"
+)
+
+var (
+	errWebhookURLIsEmpty          = errors.New("Telegram webhook url is empty")
+	errWebhookCertFileIsEmpty     = errors.New("Telegram webhook cert_file is empty, but upload_certificate is enabled")
+	errUnsupportedTelegramMode    = errors.New("unsupported Telegram mode")
+	errWebhookTLSSettingsNotMatch = errors.New("Telegram webhook cert_file and key_file must be set together")
+)
+
+// Webhook - HTTP сервер, принимающий обновления от Telegram: https://core.telegram.org/bots/api#setwebhook
+type Webhook struct {
+	app         *fiber.App
+	log         *zap.Logger
+	listen      string
+	path        string
+	secretToken string
+	certFile    string
+	keyFile     string
+	updateChan  chan telegramUpdate
+}
+
+func NewWebhook(cfg *WebhookSettings, log *zap.Logger, lenUpdateChan int) (*Webhook, error) {
+	if cfg.URL == "" {
+		return nil, errWebhookURLIsEmpty
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errWebhookTLSSettingsNotMatch
+	}
+	if cfg.UploadCertificate && cfg.CertFile == "" {
+		return nil, errWebhookCertFileIsEmpty
+	}
+	w := &Webhook{
+		app: fiber.New(fiber.Config{
+			DisableStartupMessage:   true,
+			ProxyHeader:             cfg.ProxyHeader,
+			EnableTrustedProxyCheck: len(cfg.TrustedProxies) > 0,
+			TrustedProxies:          cfg.TrustedProxies,
+		}),
+		log:         log,
+		listen:      cfg.Listen,
+		path:        cfg.Path,
+		secretToken: cfg.SecretToken,
+		certFile:    cfg.CertFile,
+		keyFile:     cfg.KeyFile,
+		updateChan:  make(chan telegramUpdate, lenUpdateChan),
+	}
+	if w.listen == "" {
+		w.listen = defaultWebhookListen
+	}
+	if w.path == "" {
+		w.path = defaultWebhookPath
+	}
+	w.app.Post(w.path, w.handleUpdate)
+	return w, nil
+}
+
+func (w *Webhook) Updates() <-chan telegramUpdate {
+	return w.updateChan
+}
+
+func (w *Webhook) Run() {
+	go func() {
+		var err error
+		w.log.Info("Starting Telegram webhook server",
+			zap.String("listen", w.listen),
+			zap.String("path", w.path))
+		if w.certFile != "" {
+			err = w.app.ListenTLS(w.listen, w.certFile, w.keyFile)
+		} else {
+			err = w.app.Listen(w.listen)
+		}
+		if err != nil {
+			w.log.Error("Telegram webhook server err:", zap.Error(err))
+		}
+	}()
+}
+
+func (w *Webhook) Stop() {
+	if err := w.app.Shutdown(); err != nil {
+		w.log.Error("Shutdown Telegram webhook server err:", zap.Error(err))
+	}
+	close(w.updateChan)
+}
+
+func (w *Webhook) handleUpdate(c *fiber.Ctx) error {
+	if w.secretToken != "" && subtle.ConstantTimeCompare([]byte(c.Get(headerSecretToken)), []byte(w.secretToken)) != 1 {
+		w.log.Warn("Telegram webhook invalid secret token", zap.String("ip", c.IP()))
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	var update telegramUpdate
+	if err := json.Unmarshal(c.Body(), &update); err != nil {
+		w.log.Error("Parsing Telegram webhook update err:", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	w.updateChan <- update
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// deleteWebhook - getUpdates возвращает ошибку, пока у бота установлен webhook, например после запуска
+// в режиме webhook; ожидающие обновления не удаляются
+func deleteWebhook(bot *tgbotapi.BotAPI) error {
+	_, err := bot.Request(tgbotapi.DeleteWebhookConfig{})
+	return err
+}
+
+func setWebhook(bot *tgbotapi.BotAPI, cfg *WebhookSettings) error {
+	params := make(tgbotapi.Params)
+	params["url"] = cfg.URL
+	params.AddNonEmpty("secret_token", cfg.SecretToken)
+	params.AddNonZero("max_connections", cfg.MaxConnections)
+	params.AddBool("drop_pending_updates", cfg.DropPendingUpdates)
+	if !cfg.UploadCertificate {
+		_, err := bot.MakeRequest(methodSetWebhook, params)
+		return err
+	}
+	files := []tgbotapi.RequestFile{
+		{
+			Name: "certificate",
+			Data: tgbotapi.FilePath(cfg.CertFile),
+		},
+	}
+	_, err := bot.UploadFiles(methodSetWebhook, params, files)
+	return err
+}
@@ -0,0 +1,143 @@
+package tbotopenai
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNewWebhook(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      WebhookSettings
+		expError error
+	}{
+		{
+			name:     "URL is empty",
+			cfg:      WebhookSettings{},
+			expError: errWebhookURLIsEmpty,
+		},
+		{
+			name:     "Key file without cert file",
+			cfg:      WebhookSettings{URL: "https://example.com/bot", KeyFile: "bot.key"},
+			expError: errWebhookTLSSettingsNotMatch,
+		},
+		{
+			name:     "Certificate upload without cert file",
+			cfg:      WebhookSettings{URL: "https://example.com/bot", UploadCertificate: true},
+			expError: errWebhookCertFileIsEmpty,
+		},
+		{
+			name: "Defaults are set",
+			cfg:  WebhookSettings{URL: "https://example.com/bot"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWebhook(&tt.cfg, zap.NewNop(), 1)
+			assert.Equal(t, tt.expError, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, defaultWebhookListen, w.listen)
+			assert.Equal(t, defaultWebhookPath, w.path)
+		})
+	}
+}
+
+func TestWebhook_HandleUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		secretToken string
+		header      string
+		body        string
+		expStatus   int
+		expUpdateID int
+	}{
+		{
+			name:        "Valid secret token",
+			secretToken: "secret",
+			header:      "secret",
+			body:        `{"update_id":10,"message":{"message_id":1,"text":"hi"}}`,
+			expStatus:   http.StatusOK,
+			expUpdateID: 10,
+		},
+		{
+			name:        "Invalid secret token",
+			secretToken: "secret",
+			header:      "other",
+			body:        `{"update_id":11}`,
+			expStatus:   http.StatusUnauthorized,
+		},
+		{
+			name:        "Missing secret token",
+			secretToken: "secret",
+			body:        `{"update_id":12}`,
+			expStatus:   http.StatusUnauthorized,
+		},
+		{
+			name:        "Secret token is not configured",
+			body:        `{"update_id":13}`,
+			expStatus:   http.StatusOK,
+			expUpdateID: 13,
+		},
+		{
+			name:      "Invalid body",
+			body:      `{"update_id":`,
+			expStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWebhook(&WebhookSettings{
+				URL:         "https://example.com/bot",
+				Path:        "/bot",
+				SecretToken: tt.secretToken,
+			}, zap.NewNop(), 1)
+			assert.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/bot", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(headerSecretToken, tt.header)
+			}
+			resp, err := w.app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expStatus, resp.StatusCode)
+			if tt.expUpdateID == 0 {
+				assert.Len(t, w.updateChan, 0)
+				return
+			}
+			update := <-w.updateChan
+			assert.Equal(t, tt.expUpdateID, update.UpdateID)
+		})
+	}
+}
+
+func TestWebhook_Stop(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	listen := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+	w, err := NewWebhook(&WebhookSettings{URL: "https://example.com/bot", Listen: listen}, zap.NewNop(), 1)
+	assert.NoError(t, err)
+	w.Run()
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", listen)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+	w.Stop()
+	_, ok := <-w.Updates()
+	assert.False(t, ok)
+	_, err = net.Dial("tcp", listen)
+	assert.Error(t, err)
+}
@@ -1,11 +1,12 @@
 package chatgptfree
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
-	"strconv"
 
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fastjson"
@@ -13,6 +14,9 @@ import (
 
 const chatGPTTextURI = "https://origin.nextway.top/api/openai/v1/chat/completions"
 
+// DefaultModel - модель, которая используется, если модель запроса не задана
+const DefaultModel = "gpt-4o-mini"
+
 var (
 	errResponseCodeIsNot200 = errors.New("response code is not 200")
 	errEmptyRespChoices     = errors.New("response's choices are empty")
@@ -22,27 +26,60 @@ var client = fasthttp.Client{
 	TLSConfig: &tls.Config{InsecureSkipVerify: true},
 }
 
-func GenerateText(ctx context.Context, prompt string) ([]byte, error) {
+var streamClient = fasthttp.Client{
+	TLSConfig:          &tls.Config{InsecureSkipVerify: true},
+	StreamResponseBody: true,
+}
+
+// Message - предыдущее сообщение диалога; Role - system, user или assistant
+type Message struct {
+	Role    string
+	Content string
+}
+
+type requestBody struct {
+	Messages         []requestMessage `json:"messages"`
+	Stream           bool             `json:"stream"`
+	Model            string           `json:"model"`
+	Temperature      float64          `json:"temperature"`
+	PresencePenalty  float64          `json:"presence_penalty"`
+	FrequencyPenalty float64          `json:"frequency_penalty"`
+	TopP             float64          `json:"top_p"`
+	ChatToken        int              `json:"chat_token"`
+	CaptchaToken     string           `json:"captchaToken"`
+}
+
+// requestMessage - Content - текст или, если к запросу приложены изображения, список частей contentPart
+type requestMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type contentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+var (
+	eventDataPrefix = []byte("data:")
+	eventDataDone   = []byte("[DONE]")
+)
+
+// GenerateText - генерация текста; model - модель, "" - DefaultModel, history - предыдущие сообщения диалога,
+// imageURLs - изображения к запросу (URL или data URL) для модели с vision
+func GenerateText(ctx context.Context, model string, history []Message, prompt string, imageURLs []string) ([]byte, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
-	req.Header.SetMethod(fasthttp.MethodPost)
-	req.SetRequestURI(chatGPTTextURI)
-	req.Header.Set("Accept", "application/json, text/event-stream")
-	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Origin", "https://gpt-chatbotru-chat-main.ru")
-	req.Header.Set("Priority", "u=1, i")
-	req.Header.Set("Referer", "https://gpt-chatbotru-chat-main.ru/")
-	req.Header.Set("Sec-CH-UA", `"Not/A)Brand";v="8", "Chromium";v="126", "Google Chrome";v="126"`)
-	req.Header.Set("Sec-CH-UA-Mobile", "?0")
-	req.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
-	req.Header.Set("Sec-Fetch-Dest", "empty")
-	req.Header.Set("Sec-Fetch-Mode", "cors")
-	req.Header.Set("Sec-Fetch-Site", "same-origin")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36")
-	req.SetBody(prepareRequestBody(prompt))
+	if err := prepareRequest(req, model, history, prompt, imageURLs, false); err != nil {
+		return nil, err
+	}
 	bodyChan := make(chan []byte, 1)
 	errChan := make(chan error, 1)
 	go func() {
@@ -77,10 +114,129 @@ func GenerateText(ctx context.Context, prompt string) ([]byte, error) {
 	}
 }
 
-func prepareRequestBody(content string) []byte {
+// GenerateTextStream - генерация текста с потоковой передачей ответа (text/event-stream).
+// onDelta вызывается для каждой полученной части ответа, возвращается весь ответ целиком.
+func GenerateTextStream(ctx context.Context, model string, history []Message, prompt string, imageURLs []string,
+	onDelta func(delta string)) ([]byte, error) {
+	deltaChan := make(chan string)
+	errChan := make(chan error, 1)
+	go func() {
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		if err := prepareRequest(req, model, history, prompt, imageURLs, true); err != nil {
+			errChan <- err
+			return
+		}
+		if err := streamClient.Do(req, resp); err != nil {
+			errChan <- err
+			return
+		}
+		if resp.StatusCode() != fasthttp.StatusOK {
+			errChan <- errResponseCodeIsNot200
+			return
+		}
+		var p fastjson.Parser
+		scanner := bufio.NewScanner(resp.BodyStream())
+		for scanner.Scan() {
+			data, ok := bytes.CutPrefix(scanner.Bytes(), eventDataPrefix)
+			if !ok {
+				continue
+			}
+			data = bytes.TrimSpace(data)
+			if bytes.Equal(data, eventDataDone) {
+				break
+			}
+			v, err := p.ParseBytes(data)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			choices := v.GetArray("choices")
+			if len(choices) == 0 {
+				continue
+			}
+			delta := choices[0].Get("delta").GetStringBytes("content")
+			if len(delta) == 0 {
+				continue
+			}
+			select {
+			case deltaChan <- string(delta):
+			case <-ctx.Done():
+				return
+			}
+		}
+		errChan <- scanner.Err()
+	}()
 	var b bytes.Buffer
-	b.WriteString(`{"messages":[{"role":"user","content":`)
-	b.WriteString(strconv.Quote(content))
-	b.WriteString(`}],"stream":false,"model":"gpt-4o-mini","temperature":0.5,"presence_penalty":0,"frequency_penalty":0,"top_p":1,"chat_token":126,"captchaToken":"1"}`)
-	return b.Bytes()
+	for {
+		select {
+		case <-ctx.Done():
+			return b.Bytes(), ctx.Err()
+		case delta := <-deltaChan:
+			b.WriteString(delta)
+			onDelta(delta)
+		case err := <-errChan:
+			if err != nil {
+				return b.Bytes(), err
+			}
+			if b.Len() == 0 {
+				return nil, errEmptyRespChoices
+			}
+			return b.Bytes(), nil
+		}
+	}
+}
+
+func prepareRequest(req *fasthttp.Request, model string, history []Message, prompt string, imageURLs []string, stream bool) error {
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.SetRequestURI(chatGPTTextURI)
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "https://gpt-chatbotru-chat-main.ru")
+	req.Header.Set("Priority", "u=1, i")
+	req.Header.Set("Referer", "https://gpt-chatbotru-chat-main.ru/")
+	req.Header.Set("Sec-CH-UA", `"Not/A)Brand";v="8", "Chromium";v="126", "Google Chrome";v="126"`)
+	req.Header.Set("Sec-CH-UA-Mobile", "?0")
+	req.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
+	req.Header.Set("Sec-Fetch-Dest", "empty")
+	req.Header.Set("Sec-Fetch-Mode", "cors")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36")
+	body, err := prepareRequestBody(model, history, prompt, imageURLs, stream)
+	if err != nil {
+		return err
+	}
+	req.SetBody(body)
+	return nil
+}
+
+func prepareRequestBody(model string, history []Message, content string, imageURLs []string, stream bool) ([]byte, error) {
+	if model == "" {
+		model = DefaultModel
+	}
+	messages := make([]requestMessage, 0, len(history)+1)
+	for _, msg := range history {
+		messages = append(messages, requestMessage{Role: msg.Role, Content: msg.Content})
+	}
+	userMessage := requestMessage{Role: "user", Content: content}
+	if len(imageURLs) > 0 {
+		parts := make([]contentPart, 0, len(imageURLs)+1)
+		parts = append(parts, contentPart{Type: "text", Text: content})
+		for _, url := range imageURLs {
+			parts = append(parts, contentPart{Type: "image_url", ImageURL: &imageURL{URL: url}})
+		}
+		userMessage.Content = parts
+	}
+	return json.Marshal(requestBody{
+		Messages:     append(messages, userMessage),
+		Stream:       stream,
+		Model:        model,
+		Temperature:  0.5,
+		TopP:         1,
+		ChatToken:    126,
+		CaptchaToken: "1",
+	})
 }
@@ -0,0 +1,68 @@
+package chatgptfree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepareRequestBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		model       string
+		history     []Message
+		content     string
+		imageURLs   []string
+		expModel    string
+		expMessages []map[string]any
+	}{
+		{
+			name:     "Control characters and characters outside BMP",
+			content:  "line\x01\ttab \"quoted\" 😀 \\  ",
+			expModel: DefaultModel,
+			expMessages: []map[string]any{
+				{"role": "user", "content": "line\x01\ttab \"quoted\" 😀 \\  "},
+			},
+		},
+		{
+			name:     "History is sent before the request",
+			model:    "gpt-4o",
+			history:  []Message{{Role: "system", Content: "be brief"}, {Role: "assistant", Content: "ok\x00"}},
+			content:  "hi",
+			expModel: "gpt-4o",
+			expMessages: []map[string]any{
+				{"role": "system", "content": "be brief"},
+				{"role": "assistant", "content": "ok\x00"},
+				{"role": "user", "content": "hi"},
+			},
+		},
+		{
+			name:      "Images are content parts",
+			content:   "what is it?",
+			imageURLs: []string{"data:image/jpeg;base64,AAA="},
+			expModel:  DefaultModel,
+			expMessages: []map[string]any{
+				{"role": "user", "content": []any{
+					map[string]any{"type": "text", "text": "what is it?"},
+					map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/jpeg;base64,AAA="}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := prepareRequestBody(tt.model, tt.history, tt.content, tt.imageURLs, true)
+			assert.NoError(t, err)
+			var req struct {
+				Messages []map[string]any `json:"messages"`
+				Stream   bool             `json:"stream"`
+				Model    string           `json:"model"`
+			}
+			assert.NoError(t, json.Unmarshal(body, &req))
+			assert.Equal(t, tt.expMessages, req.Messages)
+			assert.True(t, req.Stream)
+			assert.Equal(t, tt.expModel, req.Model)
+		})
+	}
+}
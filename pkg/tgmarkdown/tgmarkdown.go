@@ -0,0 +1,130 @@
+package tgmarkdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Преобразование распространенного Markdown (ответы LLM) в HTML, поддерживаемый Telegram:
+// https://core.telegram.org/bots/api#html-style
+
+const codeFence = "```"
+
+var (
+	reCodeSpanOrLink = regexp.MustCompile("`[^`\n]+`|\\[[^\\]\n]+\\]\\([^)\\s]+\\)")
+	reLink           = regexp.MustCompile(`^\[([^\]]+)\]\(([^)\s]+)\)$`)
+	reBoldStars      = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	reBoldUnderline  = regexp.MustCompile(`__(\S(?:.*?\S)?)__`)
+	reStrike         = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	reItalicStar     = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*`)
+	reItalicUnder    = regexp.MustCompile(`(^|[^\p{L}\p{N}_])_(\S(?:[^_]*?\S)?)_([^\p{L}\p{N}_]|$)`)
+	reHeading        = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	reBullet         = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	reQuote          = regexp.MustCompile(`^>\s?(.*)$`)
+	reRule           = regexp.MustCompile(`^(?:-{3,}|\*{3,}|_{3,})$`)
+)
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// ToHTML - преобразует Markdown в HTML Telegram с экранированием спецсимволов
+func ToHTML(md string) string {
+	md = strings.ReplaceAll(md, "\r", "")
+	lines := strings.Split(md, "\n")
+	out := make([]string, 0, len(lines))
+	quote := make([]string, 0)
+	flushQuote := func() {
+		if len(quote) == 0 {
+			return
+		}
+		out = append(out, "<blockquote>"+strings.Join(quote, "\n")+"</blockquote>")
+		quote = quote[:0]
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, codeFence) {
+			flushQuote()
+			code := make([]string, 0)
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != codeFence; i++ {
+				code = append(code, lines[i])
+			}
+			out = append(out, codeBlock(strings.TrimPrefix(trimmed, codeFence), code))
+			continue
+		}
+		if m := reQuote.FindStringSubmatch(trimmed); m != nil {
+			quote = append(quote, convertLine(m[1]))
+			continue
+		}
+		flushQuote()
+		out = append(out, convertLine(line))
+	}
+	flushQuote()
+	return strings.Join(out, "\n")
+}
+
+func codeBlock(lang string, code []string) string {
+	var b strings.Builder
+	b.WriteString("<pre>")
+	lang = strings.TrimSpace(lang)
+	if lang != "" {
+		b.WriteString(`<code class="language-`)
+		b.WriteString(attrEscaper.Replace(lang))
+		b.WriteString(`">`)
+	} else {
+		b.WriteString("<code>")
+	}
+	b.WriteString(textEscaper.Replace(strings.Join(code, "\n")))
+	b.WriteString("</code></pre>")
+	return b.String()
+}
+
+func convertLine(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if reRule.MatchString(trimmed) {
+		return "——————"
+	}
+	if m := reHeading.FindStringSubmatch(trimmed); m != nil {
+		return "<b>" + convertInline(m[1]) + "</b>"
+	}
+	if m := reBullet.FindStringSubmatch(line); m != nil {
+		return m[1] + "• " + convertInline(m[2])
+	}
+	return convertInline(line)
+}
+
+// convertInline - ссылки и код обрабатываются отдельно, чтобы выделение не затрагивало URL и код
+func convertInline(text string) string {
+	var b strings.Builder
+	var last int
+	for _, loc := range reCodeSpanOrLink.FindAllStringIndex(text, -1) {
+		b.WriteString(convertEmphasis(text[last:loc[0]]))
+		token := text[loc[0]:loc[1]]
+		if strings.HasPrefix(token, "`") {
+			b.WriteString("<code>")
+			b.WriteString(textEscaper.Replace(strings.Trim(token, "`")))
+			b.WriteString("</code>")
+		} else {
+			m := reLink.FindStringSubmatch(token)
+			b.WriteString(`<a href="`)
+			b.WriteString(attrEscaper.Replace(m[2]))
+			b.WriteString(`">`)
+			b.WriteString(convertEmphasis(m[1]))
+			b.WriteString("</a>")
+		}
+		last = loc[1]
+	}
+	b.WriteString(convertEmphasis(text[last:]))
+	return b.String()
+}
+
+func convertEmphasis(text string) string {
+	text = textEscaper.Replace(text)
+	text = reBoldStars.ReplaceAllString(text, "<b>$1</b>")
+	text = reBoldUnderline.ReplaceAllString(text, "<b>$1</b>")
+	text = reStrike.ReplaceAllString(text, "<s>$1</s>")
+	text = reItalicStar.ReplaceAllString(text, "<i>$1</i>")
+	return reItalicUnder.ReplaceAllString(text, "$1<i>$2</i>$3")
+}
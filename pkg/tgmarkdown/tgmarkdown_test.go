@@ -0,0 +1,71 @@
+package tgmarkdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		md      string
+		expHTML string
+	}{
+		{
+			name:    "Special characters are escaped",
+			md:      "a < b && c > d",
+			expHTML: "a &lt; b &amp;&amp; c &gt; d",
+		},
+		{
+			name:    "Bold, italic and strikethrough",
+			md:      "**bold** __bold__ *italic* _italic_ ~~strike~~",
+			expHTML: "<b>bold</b> <b>bold</b> <i>italic</i> <i>italic</i> <s>strike</s>",
+		},
+		{
+			name:    "Underscores inside words are kept",
+			md:      "snake_case_name",
+			expHTML: "snake_case_name",
+		},
+		{
+			name:    "Heading is bold",
+			md:      "## Title ##",
+			expHTML: "<b>Title</b>",
+		},
+		{
+			name:    "List items and rule",
+			md:      "- one\n  * two\n---",
+			expHTML: "• one\n  • two\n——————",
+		},
+		{
+			name:    "Inline code is not formatted",
+			md:      "run `a **b** <c>`",
+			expHTML: "run <code>a **b** &lt;c&gt;</code>",
+		},
+		{
+			name:    "Link URL is escaped and not formatted",
+			md:      `[**docs**](https://example.com/?a=1&b="2"_x_)`,
+			expHTML: `<a href="https://example.com/?a=1&amp;b=&quot;2&quot;_x_"><b>docs</b></a>`,
+		},
+		{
+			name:    "Code block with language",
+			md:      "```go\nif a < b {\n}\n```",
+			expHTML: "<pre><code class=\"language-go\">if a &lt; b {\n}</code></pre>",
+		},
+		{
+			name:    "Unclosed code block ends with the text",
+			md:      "```\n**x**",
+			expHTML: "<pre><code>**x**</code></pre>",
+		},
+		{
+			name:    "Quote lines are joined",
+			md:      "> first\r\n> *second*\ntext",
+			expHTML: "<blockquote>first\n<i>second</i></blockquote>\ntext",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expHTML, ToHTML(tt.md))
+		})
+	}
+}